@@ -0,0 +1,98 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	auditStart  uint64
+	auditEnd    uint64
+	auditReport string
+	auditRepair bool
+	auditNode   string
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Audit the continuity of the canonical chain stored in the DB.",
+	Long: `Walk the proposed slots in eth_beacon.slots in order, and check that the parent of each block is the previous proposed block.
+	Broken links, slots with more than one proposed row and orphaned blocks are written to the report.
+	With --repair, the statuses are rewritten to follow the chain stored in the DB, once the beacon node provided
+	with --beacon-node confirms the rewritten statuses are canonical. Proposed slots without a block, and broken links
+	whose parent is not in the DB, are added to the eth_beacon.known_gaps table.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		startAudit()
+	},
+}
+
+// Audit the provided range of slots and write the report.
+func startAudit() {
+	log.Info("Auditing the continuity of the chain.")
+	db := connectToDb()
+	defer db.Close()
+
+	report, err := beaconclient.AuditChainContinuity(context.Background(), db, viper.GetString("audit.beaconNode"), beaconclient.Slot(viper.GetUint64("audit.start")),
+		beaconclient.Slot(viper.GetUint64("audit.end")), viper.GetBool("audit.repair"))
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	writeJsonReport(viper.GetString("audit.report"), report, db)
+
+	fmt.Printf("Checked %d proposed slots, found %d issues.\n", report.SlotsChecked, len(report.Issues))
+	if len(report.Repaired) > 0 {
+		fmt.Printf("Repaired the statuses of %d ranges of slots.\n", len(report.Repaired))
+	}
+	if len(report.Unconfirmed) > 0 {
+		fmt.Printf("The beacon node did not confirm %d repairs, they were not applied.\n", len(report.Unconfirmed))
+	}
+	if len(report.Enqueued) > 0 {
+		fmt.Printf("Added %d entries to the known_gaps table.\n", len(report.Enqueued))
+	}
+	fmt.Printf("The report was written to %s\n", viper.GetString("audit.report"))
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().Uint64VarP(&auditStart, "start", "", 0, "The first slot to audit.")
+	auditCmd.Flags().Uint64VarP(&auditEnd, "end", "", 0, "The last slot to audit, inclusive (required).")
+	auditCmd.Flags().StringVarP(&auditReport, "report", "", "audit-report.json", "The file to write the report to.")
+	auditCmd.Flags().BoolVarP(&auditRepair, "repair", "", false, "Rewrite the statuses to follow the stored chain, and add the slots without a block to the eth_beacon.known_gaps table.")
+	auditCmd.Flags().StringVarP(&auditNode, "beacon-node", "", "", "The beacon node that confirms the repairs, for example http://localhost:5052 (required with --repair).")
+	err := auditCmd.MarkFlagRequired("end")
+	exitErr(err)
+
+	err = viper.BindPFlag("audit.start", auditCmd.Flags().Lookup("start"))
+	exitErr(err)
+	err = viper.BindPFlag("audit.end", auditCmd.Flags().Lookup("end"))
+	exitErr(err)
+	err = viper.BindPFlag("audit.report", auditCmd.Flags().Lookup("report"))
+	exitErr(err)
+	err = viper.BindPFlag("audit.repair", auditCmd.Flags().Lookup("repair"))
+	exitErr(err)
+	err = viper.BindPFlag("audit.beaconNode", auditCmd.Flags().Lookup("beacon-node"))
+	exitErr(err)
+}
@@ -23,15 +23,11 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
 )
 
 var (
-	dbUsername                 string
-	dbPassword                 string
-	dbName                     string
-	dbAddress                  string
-	dbDriver                   string
-	dbPort                     int
 	bcAddress                  string
 	bcPort                     int
 	bcBootRetryInterval        int
@@ -41,9 +37,17 @@ var (
 	bcMaxHistoricProcessWorker int
 	bcUniqueNodeIdentifier     int
 	bcCheckDb                  bool
+	bcMemoryBudget             int
+	bcStateCadence             string
+	bcCheckoutLease            int
+	bcHeadBuffer               int
+	bcBatchWriteSize           int
+	bcBatchWriteInterval       int
 	kgMaxWorker                int
 	kgTableIncrement           int
 	kgProcessGaps              bool
+	kgMaxAttempts              int
+	kgRetryBackoff             int
 	pmMetrics                  bool
 	pmAddress                  string
 	pmPort                     int
@@ -67,29 +71,9 @@ func init() {
 
 	// Required Flags
 
-	//// DB Specific
-	captureCmd.PersistentFlags().StringVarP(&dbUsername, "db.username", "", "", "Database username (required)")
-	captureCmd.PersistentFlags().StringVarP(&dbPassword, "db.password", "", "", "Database Password (required)")
-	captureCmd.PersistentFlags().StringVarP(&dbAddress, "db.address", "", "", "Port to connect to DB(required)")
-	captureCmd.PersistentFlags().StringVarP(&dbName, "db.name", "n", "", "Database name connect to DB(required)")
-	captureCmd.PersistentFlags().StringVarP(&dbDriver, "db.driver", "", "", "Database Driver to connect to DB(required)")
-	captureCmd.PersistentFlags().IntVarP(&dbPort, "db.port", "", 0, "Port to connect to DB(required)")
-	//err := captureCmd.MarkPersistentFlagRequired("db.username")
-	// exitErr(err)
-	// err = captureCmd.MarkPersistentFlagRequired("db.password")
-	// exitErr(err)
-	// err = captureCmd.MarkPersistentFlagRequired("db.address")
-	// exitErr(err)
-	// err = captureCmd.MarkPersistentFlagRequired("db.port")
-	// exitErr(err)
-	// err = captureCmd.MarkPersistentFlagRequired("db.name")
-	// exitErr(err)
-	// err = captureCmd.MarkPersistentFlagRequired("db.driver")
-	// exitErr(err)
-
 	//// Beacon Client Specific
 	captureCmd.PersistentFlags().StringVarP(&bcAddress, "bc.address", "l", "", "Address to connect to beacon node (required)")
-	captureCmd.PersistentFlags().StringVarP(&bcType, "bc.type", "", "lighthouse", "The beacon client we are using, options are prysm and lighthouse.")
+	captureCmd.PersistentFlags().StringVarP(&bcType, "bc.type", "", "lighthouse", "The beacon client we are using, options are lighthouse, prysm, teku, nimbus and lodestar.")
 	captureCmd.PersistentFlags().IntVarP(&bcPort, "bc.port", "r", 0, "Port to connect to beacon node (required )")
 	captureCmd.PersistentFlags().StringVarP(&bcConnectionProtocol, "bc.connectionProtocol", "", "http", "protocol for connecting to the beacon node.")
 	captureCmd.PersistentFlags().IntVarP(&bcBootRetryInterval, "bc.bootRetryInterval", "", 30, "The amount of time to wait between retries while booting the application")
@@ -97,6 +81,12 @@ func init() {
 	captureCmd.PersistentFlags().IntVarP(&bcMaxHistoricProcessWorker, "bc.maxHistoricProcessWorker", "", 30, "The number of workers that should be actively processing slots from the eth-beacon.historic_process table. Be careful of system memory.")
 	captureCmd.PersistentFlags().IntVarP(&bcUniqueNodeIdentifier, "bc.uniqueNodeIdentifier", "", 0, "The unique identifier of this application. Each application connecting to the DB should have a unique identifier.")
 	captureCmd.PersistentFlags().BoolVarP(&bcCheckDb, "bc.checkDb", "", true, "Should we check to see if the slot exists in the DB before writing it?")
+	captureCmd.PersistentFlags().IntVarP(&bcBatchWriteSize, "bc.batchWriteSize", "", 0, "The number of historic and known gaps slots to write to the DB in a single batch. 0 writes each slot in its own transaction.")
+	captureCmd.PersistentFlags().IntVarP(&bcBatchWriteInterval, "bc.batchWriteInterval", "", 5, "The maximum number of seconds a slot waits for its batch to be written to the DB.")
+	captureCmd.PersistentFlags().StringVarP(&bcStateCadence, "bc.stateCadence", "", "slot", "Which slots to store BeaconStates for: slot, epoch, finalized (finalized epoch boundaries, stored by known gaps processing when tracking head) or a number of slots.")
+	captureCmd.PersistentFlags().IntVarP(&bcCheckoutLease, "bc.checkoutLease", "", 300, "The number of seconds a checked out historic_process or known_gaps row is held without a heartbeat before other nodes can reclaim it.")
+	captureCmd.PersistentFlags().IntVarP(&bcHeadBuffer, "bc.headBuffer", "", 32, "The number of head slots that can be fetched while an earlier head slot is being written to the DB.")
+	captureCmd.PersistentFlags().IntVarP(&bcMemoryBudget, "bc.memoryBudget", "", 0, "The maximum memory, in MiB, that head, historic and known gaps processing can reserve for blocks and states at once. 0 means unlimited.")
 	// err = captureCmd.MarkPersistentFlagRequired("bc.address")
 	// exitErr(err)
 	// err = captureCmd.MarkPersistentFlagRequired("bc.port")
@@ -106,6 +96,8 @@ func init() {
 	captureCmd.PersistentFlags().BoolVarP(&kgProcessGaps, "kg.processKnownGaps", "", true, "Should we process the slots within the eth-beacon.known_gaps table.")
 	captureCmd.PersistentFlags().IntVarP(&kgTableIncrement, "kg.increment", "", 10000, "The max slots within a single entry to the known_gaps table.")
 	captureCmd.PersistentFlags().IntVarP(&kgMaxWorker, "kg.maxKnownGapsWorker", "", 30, "The number of workers that should be actively processing slots from the eth-beacon.known_gaps table. Be careful of system memory.")
+	captureCmd.PersistentFlags().IntVarP(&kgMaxAttempts, "kg.maxAttempts", "", 10, "The number of failed attempts before a known_gaps entry is moved to the dead letter table, 0 means unlimited.")
+	captureCmd.PersistentFlags().IntVarP(&kgRetryBackoff, "kg.retryBackoff", "", 60, "The number of seconds to wait after the first failed attempt to reprocess a known_gaps entry, it doubles after every failed attempt.")
 
 	// Prometheus Specific
 	captureCmd.PersistentFlags().BoolVarP(&pmMetrics, "pm.metrics", "", true, "Should we capture prometheus metrics.")
@@ -116,22 +108,8 @@ func init() {
 	captureCmd.PersistentFlags().BoolVar(&testDisregardSync, "t.skipSync", false, "Should we disregard the head sync?")
 
 	// Bind Flags with Viper
-	//// DB Flags
-	err := viper.BindPFlag("db.username", captureCmd.PersistentFlags().Lookup("db.username"))
-	exitErr(err)
-	err = viper.BindPFlag("db.password", captureCmd.PersistentFlags().Lookup("db.password"))
-	exitErr(err)
-	err = viper.BindPFlag("db.address", captureCmd.PersistentFlags().Lookup("db.address"))
-	exitErr(err)
-	err = viper.BindPFlag("db.port", captureCmd.PersistentFlags().Lookup("db.port"))
-	exitErr(err)
-	err = viper.BindPFlag("db.name", captureCmd.PersistentFlags().Lookup("db.name"))
-	exitErr(err)
-	err = viper.BindPFlag("db.driver", captureCmd.PersistentFlags().Lookup("db.driver"))
-	exitErr(err)
-
 	//// Testing Specific
-	err = viper.BindPFlag("t.skipSync", captureCmd.PersistentFlags().Lookup("t.skipSync"))
+	err := viper.BindPFlag("t.skipSync", captureCmd.PersistentFlags().Lookup("t.skipSync"))
 	exitErr(err)
 
 	//// LH specific
@@ -153,6 +131,18 @@ func init() {
 	exitErr(err)
 	err = viper.BindPFlag("bc.checkDb", captureCmd.PersistentFlags().Lookup("bc.checkDb"))
 	exitErr(err)
+	err = viper.BindPFlag("bc.stateCadence", captureCmd.PersistentFlags().Lookup("bc.stateCadence"))
+	exitErr(err)
+	err = viper.BindPFlag("bc.checkoutLease", captureCmd.PersistentFlags().Lookup("bc.checkoutLease"))
+	exitErr(err)
+	err = viper.BindPFlag("bc.memoryBudget", captureCmd.PersistentFlags().Lookup("bc.memoryBudget"))
+	exitErr(err)
+	err = viper.BindPFlag("bc.headBuffer", captureCmd.PersistentFlags().Lookup("bc.headBuffer"))
+	exitErr(err)
+	err = viper.BindPFlag("bc.batchWriteSize", captureCmd.PersistentFlags().Lookup("bc.batchWriteSize"))
+	exitErr(err)
+	err = viper.BindPFlag("bc.batchWriteInterval", captureCmd.PersistentFlags().Lookup("bc.batchWriteInterval"))
+	exitErr(err)
 	// Here you will define your flags and configuration settings.
 
 	//// Known Gap Specific
@@ -162,6 +152,10 @@ func init() {
 	exitErr(err)
 	err = viper.BindPFlag("kg.processKnownGaps", captureCmd.PersistentFlags().Lookup("kg.maxKnownGapsWorker"))
 	exitErr(err)
+	err = viper.BindPFlag("kg.maxAttempts", captureCmd.PersistentFlags().Lookup("kg.maxAttempts"))
+	exitErr(err)
+	err = viper.BindPFlag("kg.retryBackoff", captureCmd.PersistentFlags().Lookup("kg.retryBackoff"))
+	exitErr(err)
 
 	// Prometheus Specific
 	err = viper.BindPFlag("pm.metrics", captureCmd.PersistentFlags().Lookup("pm.metrics"))
@@ -180,3 +174,24 @@ func exitErr(err error) {
 		os.Exit(1)
 	}
 }
+
+// Apply the capture flags that are not passed to boot.BootApplicationWithRetry to the booted Beacon Client.
+// This is shared by the head, historic and full commands.
+func configureBeaconClient(Bc *beaconclient.BeaconClient, Db sql.Database) error {
+	var err error
+	// The flag is provided in MiB.
+	Bc.MemoryBudget.SetLimit(viper.GetInt64("bc.memoryBudget") * 1024 * 1024)
+	Bc.StateCadence, err = beaconclient.ParseStateCadence(viper.GetString("bc.stateCadence"))
+	if err != nil {
+		return err
+	}
+	Bc.CheckoutLeaseDuration = time.Duration(viper.GetInt("bc.checkoutLease")) * time.Second
+	Bc.HeadBufferSize = viper.GetInt("bc.headBuffer")
+	Bc.KnownGapsRetryPolicy.MaxAttempts = viper.GetInt("kg.maxAttempts")
+	Bc.KnownGapsRetryPolicy.Backoff = time.Duration(viper.GetInt("kg.retryBackoff")) * time.Second
+	if viper.GetInt("bc.batchWriteSize") > 0 {
+		Bc.BatchWriter = beaconclient.CreateBatchDatabaseWriter(Db, Bc.Metrics, viper.GetInt("bc.batchWriteSize"),
+			time.Duration(viper.GetInt("bc.batchWriteInterval"))*time.Second)
+	}
+	return nil
+}
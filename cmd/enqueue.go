@@ -0,0 +1,85 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	enqueueStart     uint64
+	enqueueEnd       uint64
+	enqueuePriority  int
+	enqueueChunkSize int
+)
+
+// enqueueCmd represents the enqueue command
+var enqueueCmd = &cobra.Command{
+	Use:   "enqueue",
+	Short: "Add a range of slots to the eth_beacon.historic_process table.",
+	Long: `Add a range of slots to the eth_beacon.historic_process table, so they are captured by historic processing.
+	Slots that are already in the DB, or already enqueued, are skipped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		startEnqueue()
+	},
+}
+
+// Enqueue the provided range of slots.
+func startEnqueue() {
+	log.Info("Enqueuing slots for historic processing.")
+	ctx := context.Background()
+
+	Db := connectToDb()
+	defer Db.Close()
+
+	report, err := beaconclient.EnqueueHistoricSlots(ctx, Db, beaconclient.Slot(viper.GetUint64("enqueue.start")),
+		beaconclient.Slot(viper.GetUint64("enqueue.end")), viper.GetInt("enqueue.priority"), viper.GetInt("enqueue.chunkSize"))
+	if err != nil {
+		StopApplicationPreBoot(err, Db)
+	}
+
+	for _, entry := range report.Enqueued {
+		fmt.Printf("Enqueued slots %d to %d\n", entry.StartSlot, entry.EndSlot)
+	}
+	fmt.Printf("Enqueued %d entries, skipped %d slots that were already present.\n", len(report.Enqueued), report.SkippedSlots)
+}
+
+func init() {
+	captureCmd.AddCommand(enqueueCmd)
+
+	enqueueCmd.Flags().Uint64VarP(&enqueueStart, "start", "", 0, "The first slot to enqueue.")
+	enqueueCmd.Flags().Uint64VarP(&enqueueEnd, "end", "", 0, "The last slot to enqueue, inclusive (required).")
+	enqueueCmd.Flags().IntVarP(&enqueuePriority, "priority", "", 10, "The priority of the entries, entries with a lower priority are processed first.")
+	enqueueCmd.Flags().IntVarP(&enqueueChunkSize, "chunk-size", "", 10000, "The max slots within a single entry to the historic_process table.")
+	err := enqueueCmd.MarkFlagRequired("end")
+	exitErr(err)
+
+	err = viper.BindPFlag("enqueue.start", enqueueCmd.Flags().Lookup("start"))
+	exitErr(err)
+	err = viper.BindPFlag("enqueue.end", enqueueCmd.Flags().Lookup("end"))
+	exitErr(err)
+	err = viper.BindPFlag("enqueue.priority", enqueueCmd.Flags().Lookup("priority"))
+	exitErr(err)
+	err = viper.BindPFlag("enqueue.chunkSize", enqueueCmd.Flags().Lookup("chunk-size"))
+	exitErr(err)
+}
@@ -0,0 +1,120 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	executionStartSlot uint64
+	executionEndSlot   uint64
+	executionRpc       string
+)
+
+// executionCmd represents the execution command
+var executionCmd = &cobra.Command{
+	Use:   "execution",
+	Short: "Link the execution payloads of the stored blocks to the execution layer.",
+	Long: `Link the execution payloads of the stored blocks to the execution layer.
+	The payloads can be checked against an execution client, or against the eth.header_cids table of ipld-eth-db when
+	it shares the DB. Mismatches are recorded in the eth_beacon.execution_mismatch table.`,
+}
+
+var executionCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the execution payloads of the canonical blocks within a range of slots.",
+	Long: `Check that the block hash of each execution payload is known at its block number.
+	When --rpc is provided the payloads are checked with eth_getBlockByNumber, otherwise against eth.header_cids.
+	When eth.header_cids is in the DB, the eth_beacon.execution_link view is created if it does not exist yet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("end") {
+			StopApplicationPreBoot(fmt.Errorf("The --end flag is required"), nil)
+		}
+		ctx := context.Background()
+		db := connectToDb()
+		defer db.Close()
+
+		// The migration can only create the view when ipld-eth-db was migrated first.
+		if _, err := beaconclient.CreateExecutionLinkView(ctx, db); err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+
+		var source beaconclient.ExecutionSource
+		if executionRpc != "" {
+			rpcSource, err := beaconclient.DialRpcExecutionSource(ctx, executionRpc)
+			if err != nil {
+				StopApplicationPreBoot(err, db)
+			}
+			defer rpcSource.Close()
+			source = rpcSource
+		} else {
+			dbSource, err := beaconclient.NewHeaderCidsExecutionSource(ctx, db)
+			if err != nil {
+				StopApplicationPreBoot(err, db)
+			}
+			source = dbSource
+		}
+
+		report, err := beaconclient.CheckExecutionPayloads(ctx, db, source, beaconclient.Slot(executionStartSlot), beaconclient.Slot(executionEndSlot))
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		fmt.Printf("Checked %d execution payloads against %s: %d matched, %d with a different hash, %d missing.\n",
+			report.Checked, report.Source, report.Matched, report.Mismatched, report.Missing)
+	},
+}
+
+var executionMismatchesCmd = &cobra.Command{
+	Use:   "mismatches",
+	Short: "List the recorded execution mismatches.",
+	Run: func(cmd *cobra.Command, args []string) {
+		endSlot := uint64(math.MaxInt64)
+		if cmd.Flags().Changed("end") {
+			endSlot = executionEndSlot
+		}
+		db := connectToDb()
+		defer db.Close()
+		mismatches, err := beaconclient.ListExecutionMismatches(context.Background(), db, beaconclient.Slot(executionStartSlot), beaconclient.Slot(endSlot))
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "SLOT\tSOURCE\tKIND\tBLOCK NUMBER\tPAYLOAD BLOCK HASH\tEXECUTION BLOCK HASH\tDETECTED AT")
+		for _, m := range mismatches {
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", m.Slot, m.Source, m.Kind, m.PayloadBlockNumber, m.PayloadBlockHash,
+				formatOptionalString(m.ExecutionBlockHash), m.DetectedAt.Format("2006-01-02 15:04:05"))
+		}
+		_ = w.Flush()
+		fmt.Printf("%d mismatches\n", len(mismatches))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(executionCmd)
+	executionCmd.AddCommand(executionCheckCmd, executionMismatchesCmd)
+
+	executionCmd.PersistentFlags().Uint64VarP(&executionStartSlot, "start", "", 0, "The first slot to select.")
+	executionCmd.PersistentFlags().Uint64VarP(&executionEndSlot, "end", "", 0, "The last slot to select.")
+	executionCheckCmd.Flags().StringVarP(&executionRpc, "rpc", "", "", "The JSON-RPC endpoint of an execution client, e.g. http://localhost:8545.")
+}
@@ -0,0 +1,56 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	exportStart uint64
+	exportEnd   uint64
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the data stored in the DB for a range of slots.",
+	Long: `Export the SignedBeaconBlocks and BeaconStates stored in public.blocks for a range of slots, to CAR or era files,
+	or the rows of the relational tables to CSV files.`,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.PersistentFlags().Uint64VarP(&exportStart, "start", "", 0, "The first slot to export.")
+	exportCmd.PersistentFlags().Uint64VarP(&exportEnd, "end", "", 0, "The last slot to export, inclusive.")
+
+	err := viper.BindPFlag("export.start", exportCmd.PersistentFlags().Lookup("start"))
+	exitErr(err)
+	err = viper.BindPFlag("export.end", exportCmd.PersistentFlags().Lookup("end"))
+	exitErr(err)
+}
+
+// Stop unless the last slot to export was provided. Only some subcommands can determine it on their own.
+func requireExportEnd(cmd *cobra.Command) {
+	if !cmd.Flags().Changed("end") && !viper.InConfig("export.end") {
+		exitErr(fmt.Errorf("required flag(s) \"end\" not set"))
+	}
+}
@@ -0,0 +1,97 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	exportCarOutput  string
+	exportCarVersion int
+	exportCarBlocks  bool
+	exportCarStates  bool
+)
+
+// exportCarCmd represents the export car command
+var exportCarCmd = &cobra.Command{
+	Use:   "car",
+	Short: "Export the objects for a range of slots to a CAR file.",
+	Long: `Stream the SignedBeaconBlocks and/or BeaconStates for a range of slots from public.blocks into a CARv1 or CARv2 file.
+	The roots of the file are the CIDs of the canonical blocks. CARv2 files include a MultihashIndexSorted index.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireExportEnd(cmd)
+		startExportCar()
+	},
+}
+
+// Export the provided range of slots to a CAR file.
+func startExportCar() {
+	log.Info("Exporting the slots to a CAR file.")
+	db := connectToDb()
+	defer db.Close()
+
+	output := viper.GetString("export.car.output")
+	f, err := os.Create(output)
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+
+	report, err := beaconclient.ExportCar(context.Background(), db, beaconclient.Slot(viper.GetUint64("export.start")),
+		beaconclient.Slot(viper.GetUint64("export.end")), f, beaconclient.CarExportOptions{
+			Version: viper.GetInt("export.car.version"),
+			Blocks:  viper.GetBool("export.car.blocks"),
+			States:  viper.GetBool("export.car.states"),
+		})
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	if err = f.Close(); err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+
+	fmt.Printf("Wrote %d blocks and %d states (%d bytes) with %d roots to %s\n",
+		report.Blocks, report.States, report.Bytes, report.Roots, output)
+	if len(report.Missing) > 0 {
+		fmt.Printf("The objects for %d slots are missing from public.blocks: %v\n", len(report.Missing), report.Missing)
+	}
+}
+
+func init() {
+	exportCmd.AddCommand(exportCarCmd)
+
+	exportCarCmd.Flags().StringVarP(&exportCarOutput, "output", "", "export.car", "The file to write the CAR to.")
+	exportCarCmd.Flags().IntVarP(&exportCarVersion, "version", "", 2, "The version of the CAR format, 1 or 2.")
+	exportCarCmd.Flags().BoolVarP(&exportCarBlocks, "blocks", "", true, "Export the SignedBeaconBlocks.")
+	exportCarCmd.Flags().BoolVarP(&exportCarStates, "states", "", true, "Export the BeaconStates.")
+
+	err := viper.BindPFlag("export.car.output", exportCarCmd.Flags().Lookup("output"))
+	exitErr(err)
+	err = viper.BindPFlag("export.car.version", exportCarCmd.Flags().Lookup("version"))
+	exitErr(err)
+	err = viper.BindPFlag("export.car.blocks", exportCarCmd.Flags().Lookup("blocks"))
+	exitErr(err)
+	err = viper.BindPFlag("export.car.states", exportCarCmd.Flags().Lookup("states"))
+	exitErr(err)
+}
@@ -0,0 +1,113 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	exportColumnarDir         string
+	exportColumnarIncremental bool
+	exportColumnarDecoded     bool
+	exportColumnarBeaconNode  string
+)
+
+// exportColumnarCmd represents the export columnar command
+var exportColumnarCmd = &cobra.Command{
+	Use:   "columnar",
+	Short: "Export the slots, signed_block and state tables to CSV files.",
+	Long: `Export the rows of the eth_beacon.slots, eth_beacon.signed_block and eth_beacon.state tables for a range of slots to CSV files.
+	The columns of each table are fixed by the schema version recorded in the manifest of the output directory.
+	With --incremental, the export starts after the last slot exported to the directory. With --beacon-node, the export
+	stops at the first slot of the latest finalized epoch, and --end can be omitted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if viper.GetString("export.columnar.beaconNode") == "" {
+			requireExportEnd(cmd)
+		}
+		startExportColumnar(cmd.Flags().Changed("end") || viper.InConfig("export.end"))
+	},
+}
+
+// Export the provided range of slots to CSV files.
+func startExportColumnar(hasEnd bool) {
+	log.Info("Exporting the tables to CSV files.")
+	db := connectToDb()
+	defer db.Close()
+
+	endSlot := beaconclient.Slot(viper.GetUint64("export.end"))
+	if beaconNode := viper.GetString("export.columnar.beaconNode"); beaconNode != "" {
+		finalizedSlot, err := beaconclient.QueryFinalizedSlot(beaconNode)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		if !hasEnd || finalizedSlot < endSlot {
+			endSlot = finalizedSlot
+		}
+	}
+
+	dir := viper.GetString("export.columnar.dir")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	report, err := beaconclient.ExportColumnar(context.Background(), db, beaconclient.Slot(viper.GetUint64("export.start")), endSlot,
+		beaconclient.ColumnarExportOptions{
+			Dir:         dir,
+			Incremental: viper.GetBool("export.columnar.incremental"),
+			Decoded:     viper.GetBool("export.columnar.decoded"),
+		})
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+
+	if len(report.Files) == 0 {
+		fmt.Printf("There are no new slots to export to %s\n", dir)
+		return
+	}
+	fmt.Printf("Exported slots %d to %d to %s\n", report.StartSlot, report.EndSlot, dir)
+	for _, file := range report.Files {
+		fmt.Printf("%s: %d rows\n", file.Path, file.Rows)
+	}
+	if len(report.Missing) > 0 {
+		fmt.Printf("The SignedBeaconBlocks for %d slots could not be decoded: %v\n", len(report.Missing), report.Missing)
+	}
+}
+
+func init() {
+	exportCmd.AddCommand(exportColumnarCmd)
+
+	exportColumnarCmd.Flags().StringVarP(&exportColumnarDir, "dir", "", "columnar", "The directory to write the CSV files and the manifest to.")
+	exportColumnarCmd.Flags().BoolVarP(&exportColumnarIncremental, "incremental", "", false, "Start after the last slot exported to the directory.")
+	exportColumnarCmd.Flags().BoolVarP(&exportColumnarDecoded, "decoded", "", false, "Also export the block_fields table, decoded from the stored SignedBeaconBlocks.")
+	exportColumnarCmd.Flags().StringVarP(&exportColumnarBeaconNode, "beacon-node", "", "", "The beacon node to query for the latest finalized slot, e.g. http://localhost:5052.")
+
+	err := viper.BindPFlag("export.columnar.dir", exportColumnarCmd.Flags().Lookup("dir"))
+	exitErr(err)
+	err = viper.BindPFlag("export.columnar.incremental", exportColumnarCmd.Flags().Lookup("incremental"))
+	exitErr(err)
+	err = viper.BindPFlag("export.columnar.decoded", exportColumnarCmd.Flags().Lookup("decoded"))
+	exitErr(err)
+	err = viper.BindPFlag("export.columnar.beaconNode", exportColumnarCmd.Flags().Lookup("beacon-node"))
+	exitErr(err)
+}
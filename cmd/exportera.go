@@ -0,0 +1,81 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	exportEraDir     string
+	exportEraNetwork string
+)
+
+// exportEraCmd represents the export era command
+var exportEraCmd = &cobra.Command{
+	Use:   "era",
+	Short: "Export the complete eras within a range of slots to era files.",
+	Long: `Write the canonical SignedBeaconBlocks and the BeaconState at the end of each era to era files.
+	Only the eras whose slots are all within the range are exported, and every slot of these eras must be in the DB.
+	Era N contains the blocks of the slots from (N-1)*8192 to N*8192-1, and the BeaconState stored for slot N*8192.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireExportEnd(cmd)
+		startExportEra()
+	},
+}
+
+// Export the provided range of slots to era files.
+func startExportEra() {
+	log.Info("Exporting the slots to era files.")
+	db := connectToDb()
+	defer db.Close()
+
+	dir := viper.GetString("export.era.dir")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	report, err := beaconclient.ExportEra(context.Background(), db, beaconclient.Slot(viper.GetUint64("export.start")),
+		beaconclient.Slot(viper.GetUint64("export.end")), dir, viper.GetString("export.era.network"))
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+
+	fmt.Printf("Wrote eras %d to %d, with %d blocks (%d bytes of SSZ), to %s\n",
+		report.StartEra, report.EndEra, report.Blocks, report.Bytes, dir)
+	for _, path := range report.Files {
+		fmt.Println(path)
+	}
+}
+
+func init() {
+	exportCmd.AddCommand(exportEraCmd)
+
+	exportEraCmd.Flags().StringVarP(&exportEraDir, "dir", "", "era", "The directory to write the era files to.")
+	exportEraCmd.Flags().StringVarP(&exportEraNetwork, "network", "", "mainnet", "The network name used in the era file names.")
+
+	err := viper.BindPFlag("export.era.dir", exportEraCmd.Flags().Lookup("dir"))
+	exitErr(err)
+	err = viper.BindPFlag("export.era.network", exportEraCmd.Flags().Lookup("network"))
+	exitErr(err)
+}
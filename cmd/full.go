@@ -69,6 +69,10 @@ func startFullProcessing() {
 		StopApplicationPreBoot(err, Db)
 	}
 
+	if err := configureBeaconClient(Bc, Db); err != nil {
+		StopApplicationPreBoot(err, Db)
+	}
+
 	if viper.GetBool("pm.metrics") {
 		addr := viper.GetString("pm.address") + ":" + strconv.Itoa(viper.GetInt("pm.port"))
 		serveProm(addr)
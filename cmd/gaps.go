@@ -0,0 +1,270 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql/postgres"
+)
+
+var (
+	gapsStartSlot    uint64
+	gapsEndSlot      uint64
+	gapsProcess      string
+	gapsErrorText    string
+	gapsCheckedOutBy int
+	gapsPriority     int
+	gapsDeleteAll    bool
+	gapsRequeueAll   bool
+	gapsReleaseNode  int
+	gapsErrorClass   string
+)
+
+// gapsCmd represents the gaps command
+var gapsCmd = &cobra.Command{
+	Use:   "gaps",
+	Short: "Inspect and manage the eth_beacon.known_gaps table.",
+	Long: `Inspect and manage the eth_beacon.known_gaps table.
+	The --start, --end, --process, --error and --checked-out-by flags select the entries to operate on.`,
+}
+
+var gapsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the selected known_gaps entries.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := connectToDb()
+		defer db.Close()
+		entries, err := beaconclient.ListKnownGaps(context.Background(), db, gapsFilter(cmd))
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "START\tEND\tPRIORITY\tATTEMPTS\tCHECKED OUT BY\tPROCESS\tENTRY TIME\tENTRY ERROR\tREPROCESSING ERROR")
+		for _, entry := range entries {
+			_, _ = fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", entry.StartSlot, entry.EndSlot, formatOptionalInt(entry.Priority),
+				entry.Attempts, formatOptionalInt(entry.CheckedOutBy), formatOptionalString(entry.EntryProcess), entry.EntryTime.Format("2006-01-02 15:04:05"),
+				formatOptionalString(entry.EntryError), formatOptionalString(entry.ReprocessingError))
+		}
+		_ = w.Flush()
+		fmt.Printf("%d entries\n", len(entries))
+	},
+}
+
+var gapsRequeueCmd = &cobra.Command{
+	Use:   "requeue",
+	Short: "Release the selected entries and clear their reprocessing error, so they are processed again. Entries with a live lease are skipped.",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := gapsFilter(cmd)
+		if filter.IsEmpty() && !gapsRequeueAll {
+			StopApplicationPreBoot(fmt.Errorf("Refusing to requeue every entry, select entries or provide --all"), nil)
+		}
+		db := connectToDb()
+		defer db.Close()
+		rows, err := beaconclient.RequeueKnownGaps(context.Background(), db, filter, time.Duration(viper.GetInt("bc.checkoutLease"))*time.Second)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		fmt.Printf("Requeued %d entries\n", rows)
+	},
+}
+
+var gapsPriorityCmd = &cobra.Command{
+	Use:   "priority",
+	Short: "Set the priority of the selected entries.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := connectToDb()
+		defer db.Close()
+		rows, err := beaconclient.SetKnownGapsPriority(context.Background(), db, gapsFilter(cmd), gapsPriority)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		fmt.Printf("Set the priority of %d entries to %d\n", rows, gapsPriority)
+	},
+}
+
+var gapsDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the selected entries. Only use this for gaps that are confirmed resolved.",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := gapsFilter(cmd)
+		if filter.IsEmpty() && !gapsDeleteAll {
+			StopApplicationPreBoot(fmt.Errorf("Refusing to delete every entry, select entries or provide --all"), nil)
+		}
+		db := connectToDb()
+		defer db.Close()
+		rows, err := beaconclient.DeleteKnownGaps(context.Background(), db, filter)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		fmt.Printf("Deleted %d entries\n", rows)
+	},
+}
+
+var gapsReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Release every entry checked out by the given node identifier.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := connectToDb()
+		defer db.Close()
+		rows, err := beaconclient.ReleaseKnownGaps(context.Background(), db, gapsReleaseNode)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		fmt.Printf("Released %d entries checked out by %d\n", rows, gapsReleaseNode)
+	},
+}
+
+var gapsDeadLetterCmd = &cobra.Command{
+	Use:   "dead-letter",
+	Short: "Inspect and release the entries that exhausted their attempts.",
+	Long: `Inspect and release the entries in the eth_beacon.known_gaps_dead_letter table.
+	The --start, --end and --error-class flags select the entries to operate on.`,
+}
+
+var gapsDeadLetterListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the selected dead letter entries.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := connectToDb()
+		defer db.Close()
+		entries, err := beaconclient.ListDeadLetters(context.Background(), db, deadLetterFilter(cmd))
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "START\tEND\tATTEMPTS\tERROR CLASS\tSTATUS\tPROCESS\tDEAD LETTERED AT\tLAST ERROR")
+		for _, entry := range entries {
+			_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", entry.StartSlot, entry.EndSlot, entry.Attempts,
+				formatOptionalString(entry.ErrorClass), formatOptionalInt(entry.ResponseStatus), formatOptionalString(entry.EntryProcess),
+				entry.DeadLetteredAt.Format("2006-01-02 15:04:05"), formatOptionalString(entry.LastError))
+		}
+		_ = w.Flush()
+		fmt.Printf("%d entries\n", len(entries))
+	},
+}
+
+var gapsDeadLetterReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Move the selected dead letter entries back to the known_gaps table. Use this once a fix has been deployed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := connectToDb()
+		defer db.Close()
+		rows, err := beaconclient.ReleaseDeadLetters(context.Background(), db, deadLetterFilter(cmd), gapsPriority)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		fmt.Printf("Released %d entries\n", rows)
+	},
+}
+
+// Build the filter from the selection flags that were provided.
+func deadLetterFilter(cmd *cobra.Command) beaconclient.DeadLetterFilter {
+	filter := beaconclient.DeadLetterFilter{ErrorClass: gapsErrorClass}
+	if cmd.Flags().Changed("start") {
+		filter.StartSlot = &gapsStartSlot
+	}
+	if cmd.Flags().Changed("end") {
+		filter.EndSlot = &gapsEndSlot
+	}
+	return filter
+}
+
+// Build the filter from the selection flags that were provided.
+func gapsFilter(cmd *cobra.Command) beaconclient.KnownGapsFilter {
+	filter := beaconclient.KnownGapsFilter{Process: gapsProcess, ErrorText: gapsErrorText}
+	if cmd.Flags().Changed("start") {
+		filter.StartSlot = &gapsStartSlot
+	}
+	if cmd.Flags().Changed("end") {
+		filter.EndSlot = &gapsEndSlot
+	}
+	if cmd.Flags().Changed("checked-out-by") {
+		filter.CheckedOutBy = &gapsCheckedOutBy
+	}
+	return filter
+}
+
+// Connect to the DB using the db flags.
+func connectToDb() sql.Database {
+	db, err := postgres.SetupPostgresDb(viper.GetString("db.address"), viper.GetInt("db.port"), viper.GetString("db.name"),
+		viper.GetString("db.username"), viper.GetString("db.password"), viper.GetString("db.driver"))
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	return db
+}
+
+// Write a report to the given file as JSON.
+func writeJsonReport(path string, report interface{}, db sql.Database) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+}
+
+func formatOptionalString(v *string) string {
+	if v == nil {
+		return "-"
+	}
+	return *v
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.Itoa(*v)
+}
+
+func init() {
+	rootCmd.AddCommand(gapsCmd)
+	gapsCmd.AddCommand(gapsListCmd, gapsRequeueCmd, gapsPriorityCmd, gapsDeleteCmd, gapsReleaseCmd, gapsDeadLetterCmd)
+	gapsDeadLetterCmd.AddCommand(gapsDeadLetterListCmd, gapsDeadLetterReleaseCmd)
+
+	//// Selection
+	gapsCmd.PersistentFlags().Uint64VarP(&gapsStartSlot, "start", "", 0, "Only select entries starting at or after this slot.")
+	gapsCmd.PersistentFlags().Uint64VarP(&gapsEndSlot, "end", "", 0, "Only select entries ending at or before this slot.")
+	gapsCmd.PersistentFlags().StringVarP(&gapsProcess, "process", "", "", "Only select entries added by this process, for example StartUp or HeadGap.")
+	gapsCmd.PersistentFlags().StringVarP(&gapsErrorText, "error", "", "", "Only select entries whose entry or reprocessing error contains this text.")
+	gapsCmd.PersistentFlags().IntVarP(&gapsCheckedOutBy, "checked-out-by", "", 0, "Only select entries checked out by this node identifier.")
+
+	gapsPriorityCmd.Flags().IntVarP(&gapsPriority, "priority", "", 0, "The new priority, entries with a lower priority are processed first.")
+	err := gapsPriorityCmd.MarkFlagRequired("priority")
+	exitErr(err)
+	gapsRequeueCmd.Flags().BoolVarP(&gapsRequeueAll, "all", "", false, "Requeue every entry when no entries are selected.")
+	gapsDeleteCmd.Flags().BoolVarP(&gapsDeleteAll, "all", "", false, "Delete every entry when no entries are selected.")
+	gapsReleaseCmd.Flags().IntVarP(&gapsReleaseNode, "node", "", 0, "The unique identifier of the node whose checkouts should be released.")
+	err = gapsReleaseCmd.MarkFlagRequired("node")
+	exitErr(err)
+
+	gapsDeadLetterCmd.PersistentFlags().StringVarP(&gapsErrorClass, "error-class", "", "", "Only select entries whose last error has this class, for example request, response or decode.")
+	gapsDeadLetterReleaseCmd.Flags().IntVarP(&gapsPriority, "priority", "", 0, "The priority of the released entries, entries with a lower priority are processed first.")
+}
@@ -57,6 +57,10 @@ func startHistoricProcessing() {
 		StopApplicationPreBoot(err, Db)
 	}
 
+	if err := configureBeaconClient(Bc, Db); err != nil {
+		StopApplicationPreBoot(err, Db)
+	}
+
 	if viper.GetBool("pm.metrics") {
 		addr := viper.GetString("pm.address") + ":" + strconv.Itoa(viper.GetInt("pm.port"))
 		serveProm(addr)
@@ -0,0 +1,63 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+// importEraCmd represents the import era command
+var importEraCmd = &cobra.Command{
+	Use:   "era <file>...",
+	Short: "Import the slots contained in era files.",
+	Long: `Read the SignedBeaconBlocks and BeaconStates from era files, and write them to the DB.
+	Every slot covered by a file is marked as proposed or skipped, and the known_gaps entries for those slots are cleared.
+	The BeaconState of a file is written with the first block of the next file, so provide consecutive files together.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		startImportEra(args)
+	},
+}
+
+// Import the provided era files.
+func startImportEra(paths []string) {
+	log.Info("Importing the era files.")
+	db := connectToDb()
+	defer db.Close()
+
+	metrics, err := beaconclient.CreateBeaconClientMetrics()
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	report, err := beaconclient.ImportEra(context.Background(), db, metrics, paths)
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+
+	fmt.Printf("Imported %d era files covering slots %d to %d: %d proposed, %d skipped, %d states.\n",
+		report.Files, report.StartSlot, report.EndSlot, report.Proposed, report.Skipped, report.States)
+	fmt.Printf("Removed %d entries from the known_gaps table.\n", report.KnownGapsCleared)
+}
+
+func init() {
+	importCmd.AddCommand(importEraCmd)
+}
@@ -0,0 +1,139 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	proofPaths  []string
+	proofOutput string
+)
+
+// proofCmd represents the proof command
+var proofCmd = &cobra.Command{
+	Use:   "proof",
+	Short: "Build and verify SSZ Merkle proofs for the blocks and states in the DB.",
+	Long: `Build and verify SSZ Merkle proofs for the blocks and states in the DB.
+	Paths use the field names of the consensus specs, for example body.execution_payload.block_hash for a block,
+	or balances[42], validators[42].effective_balance and finalized_checkpoint.root for a state.`,
+}
+
+var proofBlockCmd = &cobra.Command{
+	Use:   "block <block_id>",
+	Short: "Prove fields of a block against its block root. The block_id is head, genesis, a slot or a root.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		buildProofs("block", args[0])
+	},
+}
+
+var proofStateCmd = &cobra.Command{
+	Use:   "state <state_id>",
+	Short: "Prove fields of a state against its state root. The state_id is head, genesis, a slot or a root.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		buildProofs("state", args[0])
+	},
+}
+
+var proofVerifyCmd = &cobra.Command{
+	Use:   "verify <file>",
+	Short: "Verify the proofs in a file written by the proof command or the proof endpoints.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		verifyProofs(args[0])
+	},
+}
+
+// Build the proofs for the paths, and write them to the output file or stdout.
+func buildProofs(kind string, id string) {
+	db := connectToDb()
+	defer db.Close()
+	proofs, err := beaconclient.BuildStoredProofs(context.Background(), db, kind, id, proofPaths)
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	response := beaconclient.ProofResponse{Data: proofs}
+	if proofOutput != "" {
+		writeJsonReport(proofOutput, response, db)
+		fmt.Printf("Wrote %d proofs to %s\n", len(proofs), proofOutput)
+		return
+	}
+	data, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+	fmt.Println(string(data))
+}
+
+// Verify every proof in a file, and exit with an error if any of them is invalid.
+func verifyProofs(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		StopApplicationPreBoot(err, nil)
+	}
+	var proofs []beaconclient.MerkleProof
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &proofs)
+	} else {
+		var response beaconclient.ProofResponse
+		if err = json.Unmarshal(data, &response); err == nil {
+			proofs = response.Data
+		}
+	}
+	if err != nil {
+		StopApplicationPreBoot(err, nil)
+	}
+
+	invalid := 0
+	for _, proof := range proofs {
+		valid, err := beaconclient.VerifyMerkleProof(proof)
+		if err != nil {
+			StopApplicationPreBoot(err, nil)
+		}
+		result := "valid"
+		if !valid {
+			result = "INVALID"
+			invalid++
+		}
+		fmt.Printf("%s\t%s (gindex %d) against %s\n", result, proof.Path, proof.Gindex, proof.Root)
+	}
+	if invalid > 0 {
+		StopApplicationPreBoot(fmt.Errorf("%d of %d proofs are invalid", invalid, len(proofs)), nil)
+	}
+	fmt.Printf("%d proofs are valid\n", len(proofs))
+}
+
+func init() {
+	rootCmd.AddCommand(proofCmd)
+	proofCmd.AddCommand(proofBlockCmd, proofStateCmd, proofVerifyCmd)
+
+	for _, cmd := range []*cobra.Command{proofBlockCmd, proofStateCmd} {
+		cmd.Flags().StringArrayVarP(&proofPaths, "path", "", nil, "The path of a field to prove, can be repeated.")
+		cmd.Flags().StringVarP(&proofOutput, "output", "", "", "Write the proofs to this file instead of stdout.")
+		err := cmd.MarkFlagRequired("path")
+		exitErr(err)
+	}
+}
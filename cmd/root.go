@@ -27,7 +27,13 @@ import (
 )
 
 var (
-	cfgFile string
+	cfgFile    string
+	dbUsername string
+	dbPassword string
+	dbName     string
+	dbAddress  string
+	dbDriver   string
+	dbPort     int
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -133,6 +139,15 @@ func init() {
 	rootCmd.PersistentFlags().Bool("log.output", true, "Should we log to STDOUT")
 	rootCmd.PersistentFlags().String("log.format", "json", "json or text")
 
+	//// DB Specific
+	// The DB flags are shared by the capture and gaps commands.
+	rootCmd.PersistentFlags().StringVarP(&dbUsername, "db.username", "", "", "Database username (required)")
+	rootCmd.PersistentFlags().StringVarP(&dbPassword, "db.password", "", "", "Database Password (required)")
+	rootCmd.PersistentFlags().StringVarP(&dbAddress, "db.address", "", "", "Port to connect to DB(required)")
+	rootCmd.PersistentFlags().StringVarP(&dbName, "db.name", "n", "", "Database name connect to DB(required)")
+	rootCmd.PersistentFlags().StringVarP(&dbDriver, "db.driver", "", "", "Database Driver to connect to DB(required)")
+	rootCmd.PersistentFlags().IntVarP(&dbPort, "db.port", "", 0, "Port to connect to DB(required)")
+
 	// Bind Flags with Viper
 	// Optional
 	err := viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log.level"))
@@ -143,6 +158,19 @@ func init() {
 	exitErr(err)
 	err = viper.BindPFlag("log.format", rootCmd.PersistentFlags().Lookup("log.format"))
 	exitErr(err)
+	//// DB Flags
+	err = viper.BindPFlag("db.username", rootCmd.PersistentFlags().Lookup("db.username"))
+	exitErr(err)
+	err = viper.BindPFlag("db.password", rootCmd.PersistentFlags().Lookup("db.password"))
+	exitErr(err)
+	err = viper.BindPFlag("db.address", rootCmd.PersistentFlags().Lookup("db.address"))
+	exitErr(err)
+	err = viper.BindPFlag("db.port", rootCmd.PersistentFlags().Lookup("db.port"))
+	exitErr(err)
+	err = viper.BindPFlag("db.name", rootCmd.PersistentFlags().Lookup("db.name"))
+	exitErr(err)
+	err = viper.BindPFlag("db.driver", rootCmd.PersistentFlags().Lookup("db.driver"))
+	exitErr(err)
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,112 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/internal/shutdown"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+const (
+	// How long a client has to send the request headers.
+	serveReadHeaderTimeout = 10 * time.Second
+	// How long a response can take to write, long enough for a BeaconState over a slow connection.
+	serveWriteTimeout = 5 * time.Minute
+)
+
+var (
+	serveAddress string
+	servePort    int
+	serveGraphQL bool
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a read-only subset of the beacon API from the DB.",
+	Long: `Serve the SignedBeaconBlocks, block headers and BeaconStates stored in the DB over the standard beacon API:
+	/eth/v2/beacon/blocks/{block_id}, /eth/v1/beacon/blocks/{block_id}/root, /eth/v1/beacon/headers/{block_id}
+	and /eth/v2/debug/beacon/states/{state_id}. Requests that prefer application/octet-stream to application/json receive SSZ, all others JSON.
+	A GraphQL API over the slots, blocks, states, known gaps and reorgs in the DB is served at /graphql.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		startServe()
+	},
+}
+
+// Serve the beacon API until the application is stopped.
+func startServe() {
+	log.Info("Starting the beacon API server.")
+	ctx := context.Background()
+	db := connectToDb()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", beaconclient.NewBeaconApiServer(db))
+	if viper.GetBool("serve.graphql") {
+		gql, err := beaconclient.NewGraphQLHandler(db)
+		if err != nil {
+			StopApplicationPreBoot(err, db)
+		}
+		mux.Handle("/graphql", gql)
+	}
+
+	addr := viper.GetString("serve.address") + ":" + strconv.Itoa(viper.GetInt("serve.port"))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		WriteTimeout:      serveWriteTimeout,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			loghelper.LogError(err).WithField("endpoint", addr).Error("Error with the beacon API server")
+			notifierCh <- syscall.SIGTERM
+		}
+	}()
+	log.WithField("endpoint", addr).Info("The beacon API server is listening.")
+
+	err := shutdown.ShutdownServe(ctx, notifierCh, maxWaitSecondsShutdown, db, srv)
+	if err != nil {
+		loghelper.LogError(err).Error("Ungracefully Shutdown ipld-eth-beacon-indexer!")
+	} else {
+		log.Info("Gracefully shutdown ipld-eth-beacon-indexer")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVarP(&serveAddress, "address", "", "0.0.0.0", "The address to serve the beacon API on.")
+	serveCmd.Flags().IntVarP(&servePort, "port", "", 5052, "The port to serve the beacon API on.")
+	serveCmd.Flags().BoolVarP(&serveGraphQL, "graphql", "", true, "Serve the GraphQL API at /graphql.")
+
+	err := viper.BindPFlag("serve.address", serveCmd.Flags().Lookup("address"))
+	exitErr(err)
+	err = viper.BindPFlag("serve.port", serveCmd.Flags().Lookup("port"))
+	exitErr(err)
+	err = viper.BindPFlag("serve.graphql", serveCmd.Flags().Lookup("graphql"))
+	exitErr(err)
+}
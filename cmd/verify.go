@@ -0,0 +1,88 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var (
+	verifyStart   uint64
+	verifyEnd     uint64
+	verifyReport  string
+	verifyEnqueue bool
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the SignedBeaconBlocks and BeaconStates stored in the DB against their roots.",
+	Long: `Load the SignedBeaconBlocks and BeaconStates stored in public.blocks for a range of slots,
+	recompute their roots, and compare them with the roots in the eth_beacon tables.
+	Mismatches and missing objects are written to the report, and can be added to the eth_beacon.known_gaps table.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		startVerify()
+	},
+}
+
+// Verify the provided range of slots and write the report.
+func startVerify() {
+	log.Info("Verifying the stored slots.")
+	db := connectToDb()
+	defer db.Close()
+
+	report, err := beaconclient.VerifySlots(context.Background(), db, beaconclient.Slot(viper.GetUint64("verify.start")),
+		beaconclient.Slot(viper.GetUint64("verify.end")), viper.GetBool("verify.enqueue"))
+	if err != nil {
+		StopApplicationPreBoot(err, db)
+	}
+
+	writeJsonReport(viper.GetString("verify.report"), report, db)
+
+	fmt.Printf("Checked %d slots, verified %d blocks and %d states, found %d issues.\n",
+		report.SlotsChecked, report.BlocksVerified, report.StatesVerified, len(report.Issues))
+	if len(report.Enqueued) > 0 {
+		fmt.Printf("Added %d slots to the known_gaps table.\n", len(report.Enqueued))
+	}
+	fmt.Printf("The report was written to %s\n", viper.GetString("verify.report"))
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().Uint64VarP(&verifyStart, "start", "", 0, "The first slot to verify.")
+	verifyCmd.Flags().Uint64VarP(&verifyEnd, "end", "", 0, "The last slot to verify, inclusive (required).")
+	verifyCmd.Flags().StringVarP(&verifyReport, "report", "", "verify-report.json", "The file to write the report to.")
+	verifyCmd.Flags().BoolVarP(&verifyEnqueue, "enqueue", "", false, "Remove the damaged objects, and add their slots to the eth_beacon.known_gaps table so they are written again.")
+	err := verifyCmd.MarkFlagRequired("end")
+	exitErr(err)
+
+	err = viper.BindPFlag("verify.start", verifyCmd.Flags().Lookup("start"))
+	exitErr(err)
+	err = viper.BindPFlag("verify.end", verifyCmd.Flags().Lookup("end"))
+	exitErr(err)
+	err = viper.BindPFlag("verify.report", verifyCmd.Flags().Lookup("report"))
+	exitErr(err)
+	err = viper.BindPFlag("verify.enqueue", verifyCmd.Flags().Lookup("enqueue"))
+	exitErr(err)
+}
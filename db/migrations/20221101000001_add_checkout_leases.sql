@@ -0,0 +1,8 @@
+-- +goose Up
+-- The last heartbeat of the node holding a checked out row.
+ALTER TABLE eth_beacon.historic_process ADD COLUMN checked_out_at TIMESTAMPTZ;
+ALTER TABLE eth_beacon.known_gaps ADD COLUMN checked_out_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE eth_beacon.known_gaps DROP COLUMN checked_out_at;
+ALTER TABLE eth_beacon.historic_process DROP COLUMN checked_out_at;
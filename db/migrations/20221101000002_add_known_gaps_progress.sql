@@ -0,0 +1,14 @@
+-- +goose Up
+-- A bitmap of the slots within the row that are done. Bit n is set once start_slot + n has been processed,
+-- or written to eth_beacon.known_gaps.
+ALTER TABLE eth_beacon.historic_process ADD COLUMN completed_slots BYTEA;
+ALTER TABLE eth_beacon.known_gaps ADD COLUMN completed_slots BYTEA;
+-- The failed attempts to reprocess an entry, and when it can be checked out again.
+ALTER TABLE eth_beacon.known_gaps ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE eth_beacon.known_gaps ADD COLUMN next_attempt_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE eth_beacon.known_gaps DROP COLUMN next_attempt_at;
+ALTER TABLE eth_beacon.known_gaps DROP COLUMN attempts;
+ALTER TABLE eth_beacon.known_gaps DROP COLUMN completed_slots;
+ALTER TABLE eth_beacon.historic_process DROP COLUMN completed_slots;
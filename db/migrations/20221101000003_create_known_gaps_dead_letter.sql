@@ -0,0 +1,18 @@
+-- +goose Up
+-- The known_gaps entries that have exhausted their attempts.
+CREATE TABLE eth_beacon.known_gaps_dead_letter (
+    start_slot BIGINT NOT NULL,
+    end_slot BIGINT NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT,
+    error_class TEXT,
+    response_status INT,
+    entry_error TEXT,
+    entry_process TEXT,
+    entry_time TIMESTAMPTZ,
+    dead_lettered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (start_slot, end_slot)
+);
+
+-- +goose Down
+DROP TABLE eth_beacon.known_gaps_dead_letter;
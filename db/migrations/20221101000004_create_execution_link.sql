@@ -0,0 +1,35 @@
+-- +goose Up
+-- The mismatches found between the execution payloads and an execution source.
+CREATE TABLE eth_beacon.execution_mismatch (
+    slot BIGINT NOT NULL,
+    block_root VARCHAR(66) NOT NULL,
+    source TEXT NOT NULL,
+    payload_block_number BIGINT NOT NULL,
+    payload_block_hash VARCHAR(66) NOT NULL,
+    execution_block_hash VARCHAR(66),
+    kind TEXT NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (slot, block_root, source)
+);
+
+-- Link each canonical execution payload to the header indexed by ipld-eth-db. The view is only created when
+-- ipld-eth-db shares the DB, and its migrations have already run. Otherwise `execution check` creates it later.
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF to_regclass('eth.header_cids') IS NOT NULL THEN
+        CREATE VIEW eth_beacon.execution_link AS
+        SELECT s.epoch, s.slot, s.block_root, sb.payload_block_number, sb.payload_block_hash,
+        hc.block_number AS execution_block_number, hc.cid AS execution_header_cid, hc.block_hash IS NOT NULL AS linked
+        FROM eth_beacon.slots s
+        JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+        LEFT JOIN eth.header_cids hc ON hc.block_hash=sb.payload_block_hash
+        WHERE s.status='proposed' AND sb.payload_block_hash IS NOT NULL;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP VIEW IF EXISTS eth_beacon.execution_link;
+DROP TABLE eth_beacon.execution_mismatch;
@@ -123,24 +123,30 @@ func BootApplicationWithRetry(ctx context.Context, dbHostname string, dbPort int
 		}
 	}
 
+	// Historic and known gaps processing defer the slots the beacon server has not backfilled, in every mode.
+	BC.BeaconServerType = bcType
 	switch strings.ToLower(startUpMode) {
 	case "head":
 		BC.PerformHeadTracking = true
 	case "historic":
 		log.Debug("Performing additional boot steps for historical processing")
 		BC.PerformHistoricalProcessing = true
-		// This field is not currently used.
-		// The idea is, that if we are doing historially processing and we get a slot
-		// greater than this slot, then we would rerun this function.
-		// this would ensure that we have the slots necessary for processing
-		// within the beacon server.
-
-		// We can implement this feature if we notice any errors.
-		headSlot, err := BC.GetLatestSlotInBeaconServer(bcType)
+		// The latest slot is refreshed periodically while processing. Slots greater than it
+		// are deferred until the beacon server reaches them.
+
+		// If the beacon server is still backfilling, we will process the slots it has
+		// and defer the rest until they are available.
+		slots, err := BC.UpdateBeaconServerAvailability()
 		if err != nil {
 			return BC, DB, err
 		}
-		BC.UpdateLatestSlotInBeaconServer(int64(headSlot))
+		if !BC.BeaconServerAvailability.IsComplete(BC.PerformBeaconBlockProcessing, BC.PerformBeaconStateProcessing) {
+			log.WithFields(log.Fields{
+				"BeaconServerType": bcType,
+				"slots":            slots,
+			}).Warn("The beacon server is missing slots. Slots that are not available will be deferred until they are backfilled.")
+		}
+		BC.UpdateLatestSlotInBeaconServer(int64(slots.HeadSlot))
 		// Add another switch case for bcType if its ever needed.
 	case "boot":
 		log.Debug("Running application in boot mode.")
@@ -17,6 +17,7 @@ package shutdown
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"time"
 
@@ -117,3 +118,18 @@ func ShutdownBoot(ctx context.Context, notifierCh chan os.Signal, waitTime time.
 		},
 	})
 }
+
+// Wrapper function for shutting down the beacon API server.
+func ShutdownServe(ctx context.Context, notifierCh chan os.Signal, waitTime time.Duration, DB sql.Database, srv *http.Server) error {
+	return ShutdownServices(ctx, notifierCh, waitTime, DB, nil, map[string]gracefulshutdown.Operation{
+		// The DB is closed once the in flight requests are done with it.
+		"apiServer": func(ctx context.Context) error {
+			defer DB.Close()
+			err := srv.Shutdown(ctx)
+			if err != nil {
+				loghelper.LogError(err).Error("Unable to shutdown the beacon API server")
+			}
+			return err
+		},
+	})
+}
@@ -0,0 +1,306 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to audit the continuity of the canonical chain stored in the DB.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Get the proposed slots, in order, along with the parent of their block. The parent is null when
+	// the eth_beacon.signed_block row does not exist.
+	queryAuditProposedStmt string = `SELECT s.slot, s.block_root, sb.parent_block_root
+	FROM eth_beacon.slots s
+	LEFT JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.slot >= $1 AND s.slot <= $2 AND s.status='proposed'
+	ORDER BY s.slot ASC, s.block_root ASC;`
+	// Get the last proposed slot before the range, it is the parent of the first proposed slot in the range.
+	queryAuditPreviousProposedStmt string = `SELECT slot, block_root
+	FROM eth_beacon.slots
+	WHERE slot < $1 AND status='proposed'
+	ORDER BY slot DESC
+	LIMIT 1;`
+	// Get the blocks that do not have a row in eth_beacon.slots.
+	queryAuditOrphanedBlocksStmt string = `SELECT sb.slot, sb.block_root, sb.parent_block_root
+	FROM eth_beacon.signed_block sb
+	WHERE sb.slot >= $1 AND sb.slot <= $2
+	AND NOT EXISTS (SELECT 1 FROM eth_beacon.slots s WHERE s.slot=sb.slot AND s.block_root=sb.block_root)
+	ORDER BY sb.slot ASC;`
+	// Find the slot of a block, it must be before the slot of its child.
+	queryAuditBlockSlotStmt string = `SELECT slot
+	FROM eth_beacon.slots
+	WHERE block_root=$1 AND slot < $2
+	ORDER BY slot DESC
+	LIMIT 1;`
+)
+
+// The problems that the audit can find.
+const (
+	AuditBrokenLink        = "brokenLink"        // The parent_block_root of a block is not the block_root of the previous proposed slot.
+	AuditDuplicateProposed = "duplicateProposed" // There is more than one proposed row for the slot.
+	AuditMissingBlock      = "missingBlock"      // The proposed slot has no eth_beacon.signed_block row.
+	AuditOrphanedBlock     = "orphanedBlock"     // The eth_beacon.signed_block row has no eth_beacon.slots row.
+)
+
+// A single problem found by the audit.
+type AuditIssue struct {
+	Slot      uint64 `json:"slot"`      // The slot.
+	BlockRoot string `json:"blockRoot"` // The block_root of the block.
+	Kind      string `json:"kind"`      // The kind of problem, for example brokenLink.
+	Detail    string `json:"detail"`    // Additional details, for example the expected parent.
+}
+
+// The outcome of auditing a range of slots.
+type AuditReport struct {
+	StartSlot    uint64       `json:"startSlot"`    // The first slot audited.
+	EndSlot      uint64       `json:"endSlot"`      // The last slot audited.
+	SlotsChecked uint64       `json:"slotsChecked"` // The number of proposed rows checked.
+	Issues       []AuditIssue `json:"issues"`       // The problems that were found.
+	Repaired     []SlotRange  `json:"repaired"`     // The ranges whose statuses were rewritten to follow the stored chain.
+	Unconfirmed  []SlotRange  `json:"unconfirmed"`  // The repairs the beacon node did not confirm, they are only reported.
+	Enqueued     []SlotRange  `json:"enqueued"`     // The slots whose blocks are missing from the DB, added to eth_beacon.known_gaps.
+}
+
+// A repair of the statuses of a range of slots. The block is marked as proposed at the first slot of the range,
+// and every other row in the range is marked as forked.
+type auditRepair struct {
+	Range     SlotRange
+	BlockRoot string
+}
+
+// A row returned by queryAuditProposedStmt and queryAuditOrphanedBlocksStmt.
+type auditBlockRow struct {
+	Slot            uint64
+	BlockRoot       string
+	ParentBlockRoot *string
+}
+
+// Walk the proposed slots from startSlot to endSlot in order, and check that the parent of each block is the
+// previous proposed block, and that each slot has at most one proposed row. Blocks without a row in eth_beacon.slots
+// are flagged as orphaned.
+//
+// When repair is true, the statuses are rewritten to follow the chain stored in the DB. Of the duplicate proposed
+// rows, the parent of the next proposed block is kept, and the parent of a block with a broken link becomes the
+// proposed block of its slot, with every slot after it marked as forked. The later block may itself be on a fork,
+// so each repair is only applied once the beacon node at serverEndpoint confirms that the kept block is canonical
+// and that the forked slots have no canonical block. Repairs the node does not confirm are only reported.
+// Proposed slots without a block, and the slots between a broken link and a parent that is not in the DB, are added
+// to eth_beacon.known_gaps, so their blocks are written. Orphaned blocks are only reported.
+func AuditChainContinuity(ctx context.Context, db sql.Database, serverEndpoint string, startSlot Slot, endSlot Slot, repair bool) (AuditReport, error) {
+	if endSlot < startSlot {
+		return AuditReport{}, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+	if repair && serverEndpoint == "" {
+		return AuditReport{}, fmt.Errorf("A beacon node is required to confirm the repairs")
+	}
+	var proposed []auditBlockRow
+	if err := db.Select(ctx, &proposed, queryAuditProposedStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to get the proposed slots to audit")
+		return AuditReport{}, err
+	}
+	var orphaned []auditBlockRow
+	if err := db.Select(ctx, &orphaned, queryAuditOrphanedBlocksStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to get the orphaned blocks")
+		return AuditReport{}, err
+	}
+
+	var (
+		prevSlot      uint64
+		prevBlockRoot string
+	)
+	err := db.QueryRow(ctx, queryAuditPreviousProposedStmt, startSlot.Number()).Scan(&prevSlot, &prevBlockRoot)
+	if err != nil && err != pgx.ErrNoRows {
+		loghelper.LogSlotError(startSlot.Number(), err).Error("Unable to get the proposed slot before the audit")
+		return AuditReport{}, err
+	}
+
+	report := AuditReport{StartSlot: startSlot.Number(), EndSlot: endSlot.Number(), Issues: []AuditIssue{}, Repaired: []SlotRange{}, Unconfirmed: []SlotRange{}, Enqueued: []SlotRange{}}
+	var (
+		repairs  []auditRepair
+		missing  []SlotRange
+		unlinked []SlotRange
+	)
+	flag := func(issue AuditIssue) {
+		log.WithFields(log.Fields{
+			"slot":      issue.Slot,
+			"blockRoot": issue.BlockRoot,
+			"kind":      issue.Kind,
+			"detail":    issue.Detail,
+		}).Warn("The audit found a problem with the chain")
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for i := 0; i < len(proposed); i++ {
+		row := proposed[i]
+		report.SlotsChecked++
+		// Every row after the first for the same slot is a duplicate.
+		if i+1 < len(proposed) && proposed[i+1].Slot == row.Slot {
+			roots := map[string]bool{row.BlockRoot: true}
+			for ; i+1 < len(proposed) && proposed[i+1].Slot == row.Slot; i++ {
+				report.SlotsChecked++
+				roots[proposed[i+1].BlockRoot] = true
+				flag(AuditIssue{Slot: row.Slot, BlockRoot: proposed[i+1].BlockRoot, Kind: AuditDuplicateProposed, Detail: row.BlockRoot})
+			}
+			// The parent of the next proposed block is the canonical one. Without it, the next link is not checked.
+			prevSlot, prevBlockRoot = row.Slot, ""
+			if i+1 < len(proposed) && proposed[i+1].ParentBlockRoot != nil && roots[*proposed[i+1].ParentBlockRoot] {
+				prevBlockRoot = *proposed[i+1].ParentBlockRoot
+				repairs = append(repairs, auditRepair{Range: SlotRange{StartSlot: Slot(row.Slot), EndSlot: Slot(row.Slot)}, BlockRoot: prevBlockRoot})
+			}
+			continue
+		}
+
+		switch {
+		case row.ParentBlockRoot == nil:
+			flag(AuditIssue{Slot: row.Slot, BlockRoot: row.BlockRoot, Kind: AuditMissingBlock})
+			missing = append(missing, SlotRange{StartSlot: Slot(row.Slot), EndSlot: Slot(row.Slot)})
+		case prevBlockRoot != "" && *row.ParentBlockRoot != prevBlockRoot:
+			flag(AuditIssue{Slot: row.Slot, BlockRoot: row.BlockRoot, Kind: AuditBrokenLink,
+				Detail: fmt.Sprintf("parent %s, previous proposed slot %d has %s", *row.ParentBlockRoot, prevSlot, prevBlockRoot)})
+			var parentSlot uint64
+			err := db.QueryRow(ctx, queryAuditBlockSlotStmt, *row.ParentBlockRoot, row.Slot).Scan(&parentSlot)
+			if err != nil && err != pgx.ErrNoRows {
+				loghelper.LogSlotError(row.Slot, err).Error("Unable to find the slot of the parent block")
+				return report, err
+			}
+			if err == nil {
+				repairs = append(repairs, auditRepair{Range: SlotRange{StartSlot: Slot(parentSlot), EndSlot: Slot(row.Slot - 1)}, BlockRoot: *row.ParentBlockRoot})
+			} else {
+				// The parent was never written, so the slots up to the block are written again.
+				unlinked = append(unlinked, SlotRange{StartSlot: Slot(prevSlot + 1), EndSlot: Slot(row.Slot)})
+			}
+		}
+		prevSlot, prevBlockRoot = row.Slot, row.BlockRoot
+	}
+
+	for _, row := range orphaned {
+		flag(AuditIssue{Slot: row.Slot, BlockRoot: row.BlockRoot, Kind: AuditOrphanedBlock})
+	}
+
+	if repair {
+		for _, r := range repairs {
+			confirmed, err := confirmAuditRepair(serverEndpoint, r)
+			if err != nil {
+				loghelper.LogSlotRangeError(r.Range.StartSlot.Number(), r.Range.EndSlot.Number(), err).Error("Unable to confirm the repair with the beacon node")
+				return report, err
+			}
+			if !confirmed {
+				log.WithFields(log.Fields{
+					"startSlot": r.Range.StartSlot,
+					"endSlot":   r.Range.EndSlot,
+					"blockRoot": r.BlockRoot,
+				}).Warn("The beacon node did not confirm the repair, the statuses are left as they are")
+				report.Unconfirmed = append(report.Unconfirmed, r.Range)
+				continue
+			}
+			if err := repairAuditedSlots(ctx, db, r); err != nil {
+				return report, err
+			}
+			report.Repaired = append(report.Repaired, r.Range)
+		}
+		for i, affected := range append(missing, unlinked...) {
+			kind := AuditMissingBlock
+			if i >= len(missing) {
+				kind = AuditBrokenLink
+			}
+			if err := enqueueKnownGap(ctx, db, affected.StartSlot, affected.EndSlot, fmt.Errorf("audit found %s", kind), "audit"); err != nil {
+				return report, err
+			}
+			report.Enqueued = append(report.Enqueued, affected)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"startSlot":    startSlot,
+		"endSlot":      endSlot,
+		"slotsChecked": report.SlotsChecked,
+		"issues":       len(report.Issues),
+	}).Info("Audited the continuity of the chain")
+	return report, nil
+}
+
+// Check with the beacon node that the block of the repair is canonical at the first slot of the range, and that
+// no other slot in the range has a canonical block.
+func confirmAuditRepair(serverEndpoint string, r auditRepair) (bool, error) {
+	var header BlockHeaderResponse
+	rc, err := queryJson(serverEndpoint+BcHeaderEndpoint(r.Range.StartSlot.Format()), &header)
+	if rc == 404 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if header.Data.Root != r.BlockRoot {
+		return false, nil
+	}
+	for slot := r.Range.StartSlot + 1; slot <= r.Range.EndSlot; slot++ {
+		rc, err := queryJson(serverEndpoint+BcHeaderEndpoint(slot.Format()), &header)
+		if rc == 404 {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// Rewrite the statuses of a range of slots within a single transaction.
+func repairAuditedSlots(ctx context.Context, db sql.Database, r auditRepair) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
+		return err
+	}
+	defer func() {
+		err := tx.Rollback(ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction")
+		}
+	}()
+
+	if _, err := updateForked(tx, ctx, r.Range.StartSlot, r.BlockRoot); err != nil {
+		return err
+	}
+	proposedCount, err := updateProposed(tx, ctx, r.Range.StartSlot, r.BlockRoot)
+	if err != nil {
+		return err
+	}
+	if proposedCount != 1 {
+		return fmt.Errorf("Expected a single row for block %s at slot %d, found %d", r.BlockRoot, r.Range.StartSlot, proposedCount)
+	}
+	// The later slots are not on the chain of the trusted block.
+	for slot := r.Range.StartSlot + 1; slot <= r.Range.EndSlot; slot++ {
+		if _, err := updateForked(tx, ctx, slot, ""); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		loghelper.LogSlotRangeError(r.Range.StartSlot.Number(), r.Range.EndSlot.Number(), err).Error("Unable to commit the repaired statuses")
+		return err
+	}
+	loghelper.LogReorg(r.Range.StartSlot.Number(), r.BlockRoot).WithField("endSlot", r.Range.EndSlot).Info("Repaired the statuses of the slots")
+	return nil
+}
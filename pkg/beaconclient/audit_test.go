@@ -0,0 +1,159 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Audit", Label("unit", "behavioral", "audit"), func() {
+	var (
+		bc           *beaconclient.BeaconClient
+		nodeEndpoint string
+	)
+	BeforeEach(func() {
+		bc = setUpTest(BeaconNodeTester.TestConfig, "99")
+		nodeEndpoint = BeaconNodeTester.TestConfig.protocol + "://" + BeaconNodeTester.TestConfig.address + ":" + strconv.Itoa(BeaconNodeTester.TestConfig.port)
+	})
+
+	// Mock the canonical block of each slot in the beacon node, the other slots are skipped.
+	mockCanonicalChain := func(canonical map[string]string) {
+		httpmock.Activate()
+		DeferCleanup(httpmock.DeactivateAndReset)
+		httpmock.RegisterResponder("GET", `=~^`+nodeEndpoint+beaconclient.BcHeaderEndpoint("")+`([^/]+)\z`,
+			func(req *http.Request) (*http.Response, error) {
+				slot := httpmock.MustGetSubmatch(req, 1)
+				root, ok := canonical[slot]
+				if !ok {
+					return httpmock.NewStringResponse(404, "Block not found"), nil
+				}
+				return httpmock.NewJsonResponse(200, beaconclient.BlockHeaderResponse{
+					Data: beaconclient.BlockHeaderData{Root: root, Canonical: true, Header: beaconclient.SignedHeaderMessage{Message: beaconclient.HeaderMessage{Slot: slot}}},
+				})
+			},
+		)
+	}
+
+	// Write a slot, along with its block when the parent is provided.
+	writeBlock := func(slot string, blockRoot string, parentRoot string, status string) {
+		ctx := context.Background()
+		_, err := bc.Db.Exec(ctx, beaconclient.UpsertSlotsStmt, "1", slot, blockRoot, blockRoot, status)
+		Expect(err).ToNot(HaveOccurred())
+		if parentRoot == "" {
+			return
+		}
+		mhKey := "/blocks/" + blockRoot
+		_, err = bc.Db.Exec(ctx, beaconclient.UpsertBlocksStmt, mhKey, []byte{1})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = bc.Db.Exec(ctx, beaconclient.UpsertSignedBeaconBlockStmt, slot, blockRoot, parentRoot, "0x00", mhKey)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Context("When auditing the continuity of the chain", func() {
+		It("Should flag duplicate proposed rows, broken links and missing blocks", func() {
+			writeBlock("50", "0x01", "", "proposed")
+			writeBlock("50", "0x02", "", "proposed")
+			writeBlock("51", "0x03", "0x02", "proposed")
+			writeBlock("52", "0x04", "0x03", "proposed")
+			writeBlock("52", "0x06", "0x03", "forked")
+			writeBlock("53", "0x05", "0x06", "proposed")
+			writeBlock("54", "0x07", "", "proposed")
+
+			report, err := beaconclient.AuditChainContinuity(context.Background(), bc.Db, nodeEndpoint, 40, 60, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.SlotsChecked).To(Equal(uint64(6)))
+			Expect(report.Issues).To(HaveLen(3))
+			Expect(report.Issues[0].Kind).To(Equal(beaconclient.AuditDuplicateProposed))
+			Expect(report.Issues[1].Kind).To(Equal(beaconclient.AuditBrokenLink))
+			Expect(report.Issues[1].Slot).To(Equal(uint64(53)))
+			Expect(report.Issues[2].Kind).To(Equal(beaconclient.AuditMissingBlock))
+			Expect(report.Repaired).To(BeEmpty())
+			Expect(report.Enqueued).To(BeEmpty())
+		})
+		It("Should repair the statuses from the stored chain", func() {
+			writeBlock("50", "0x01", "", "proposed")
+			writeBlock("50", "0x02", "", "proposed")
+			writeBlock("51", "0x03", "0x02", "proposed")
+			writeBlock("52", "0x04", "0x03", "proposed")
+			writeBlock("52", "0x06", "0x03", "forked")
+			writeBlock("53", "0x05", "0x06", "proposed")
+			writeBlock("54", "0x07", "", "proposed")
+			mockCanonicalChain(map[string]string{"50": "0x02", "51": "0x03", "52": "0x06", "53": "0x05", "54": "0x07"})
+
+			report, err := beaconclient.AuditChainContinuity(context.Background(), bc.Db, nodeEndpoint, 40, 60, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Repaired).To(Equal([]beaconclient.SlotRange{{StartSlot: 50, EndSlot: 50}, {StartSlot: 52, EndSlot: 52}}))
+			Expect(report.Enqueued).To(Equal([]beaconclient.SlotRange{{StartSlot: 54, EndSlot: 54}}))
+			Expect(countKnownGapsTable(bc.Db)).To(Equal(1))
+
+			for root, status := range map[string]string{"0x01": "forked", "0x02": "proposed", "0x04": "forked", "0x06": "proposed"} {
+				var dbStatus string
+				err := bc.Db.QueryRow(context.Background(), `SELECT status FROM eth_beacon.slots WHERE block_root=$1`, root).Scan(&dbStatus)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dbStatus).To(Equal(status), root)
+			}
+
+			report, err = beaconclient.AuditChainContinuity(context.Background(), bc.Db, nodeEndpoint, 40, 60, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Issues).To(HaveLen(1))
+			Expect(report.Issues[0].Kind).To(Equal(beaconclient.AuditMissingBlock))
+		})
+		It("Should not repair the statuses the beacon node does not confirm", func() {
+			writeBlock("51", "0x03", "0x02", "proposed")
+			writeBlock("52", "0x04", "0x03", "proposed")
+			writeBlock("52", "0x06", "0x03", "forked")
+			writeBlock("53", "0x05", "0x06", "proposed")
+			// The block at slot 53 is on a fork, the stored proposed block at slot 52 is canonical.
+			mockCanonicalChain(map[string]string{"51": "0x03", "52": "0x04", "53": "0x08"})
+
+			report, err := beaconclient.AuditChainContinuity(context.Background(), bc.Db, nodeEndpoint, 40, 60, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Repaired).To(BeEmpty())
+			Expect(report.Unconfirmed).To(Equal([]beaconclient.SlotRange{{StartSlot: 52, EndSlot: 52}}))
+
+			for root, status := range map[string]string{"0x04": "proposed", "0x06": "forked"} {
+				var dbStatus string
+				err := bc.Db.QueryRow(context.Background(), `SELECT status FROM eth_beacon.slots WHERE block_root=$1`, root).Scan(&dbStatus)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dbStatus).To(Equal(status), root)
+			}
+		})
+		It("Should enqueue the slots up to a block whose parent is not stored", func() {
+			writeBlock("50", "0x01", "0x00", "proposed")
+			writeBlock("53", "0x05", "0x04", "proposed")
+			mockCanonicalChain(map[string]string{"50": "0x01", "52": "0x04", "53": "0x05"})
+
+			report, err := beaconclient.AuditChainContinuity(context.Background(), bc.Db, nodeEndpoint, 40, 60, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Issues).To(HaveLen(1))
+			Expect(report.Issues[0].Kind).To(Equal(beaconclient.AuditBrokenLink))
+			Expect(report.Repaired).To(BeEmpty())
+			Expect(report.Enqueued).To(Equal([]beaconclient.SlotRange{{StartSlot: 51, EndSlot: 53}}))
+			Expect(countKnownGapsTable(bc.Db)).To(Equal(1))
+		})
+		It("Should require a beacon node to repair", func() {
+			_, err := beaconclient.AuditChainContinuity(context.Background(), bc.Db, "", 40, 60, true)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,254 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the batched writer used when backfilling historic slots.
+
+package beaconclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Statements to create the staging tables. They are dropped when the transaction commits.
+	createSlotsStagingStmt string = `CREATE TEMP TABLE slots_staging
+	(LIKE eth_beacon.slots INCLUDING DEFAULTS) ON COMMIT DROP;`
+	createSignedBeaconBlockStagingStmt string = `CREATE TEMP TABLE signed_block_staging
+	(LIKE eth_beacon.signed_block INCLUDING DEFAULTS) ON COMMIT DROP;`
+	createBeaconStateStagingStmt string = `CREATE TEMP TABLE state_staging
+	(LIKE eth_beacon.state INCLUDING DEFAULTS) ON COMMIT DROP;`
+	createBlocksStagingStmt string = `CREATE TEMP TABLE blocks_staging
+	(LIKE public.blocks INCLUDING DEFAULTS) ON COMMIT DROP;`
+	// Statements to merge the staging tables into their final tables.
+	mergeSlotsStagingStmt string = `
+INSERT INTO eth_beacon.slots (epoch, slot, block_root, state_root, status)
+SELECT epoch, slot, block_root, state_root, status FROM slots_staging
+ON CONFLICT (slot, block_root) DO NOTHING`
+	mergeSignedBeaconBlockStagingStmt string = `
+INSERT INTO eth_beacon.signed_block (slot, block_root, parent_block_root, eth1_data_block_hash, mh_key,
+                                     payload_block_number, payload_timestamp, payload_block_hash,
+                                     payload_parent_hash, payload_state_root, payload_receipts_root,
+                                     payload_transactions_root)
+SELECT slot, block_root, parent_block_root, eth1_data_block_hash, mh_key,
+       payload_block_number, payload_timestamp, payload_block_hash,
+       payload_parent_hash, payload_state_root, payload_receipts_root,
+       payload_transactions_root
+FROM signed_block_staging
+ON CONFLICT (slot, block_root) DO NOTHING`
+	mergeBeaconStateStagingStmt string = `
+INSERT INTO eth_beacon.state (slot, state_root, mh_key)
+SELECT slot, state_root, mh_key FROM state_staging
+ON CONFLICT (slot, state_root) DO NOTHING`
+	mergeBlocksStagingStmt string = `
+INSERT INTO public.blocks (key, data)
+SELECT key, data FROM blocks_staging
+ON CONFLICT (key) DO NOTHING`
+
+	slotsStagingColumns       = []string{"epoch", "slot", "block_root", "state_root", "status"}
+	signedBlockStagingColumns = []string{"slot", "block_root", "parent_block_root", "eth1_data_block_hash", "mh_key",
+		"payload_block_number", "payload_timestamp", "payload_block_hash", "payload_parent_hash", "payload_state_root",
+		"payload_receipts_root", "payload_transactions_root"}
+	stateStagingColumns  = []string{"slot", "state_root", "mh_key"}
+	blocksStagingColumns = []string{"key", "data"}
+)
+
+// A writer that accumulates the slots processed by historic and known gaps workers and writes them
+// together. Each flush copies the slots into staging tables using COPY FROM, and merges them into
+// eth_beacon.slots, eth_beacon.signed_block, eth_beacon.state and public.blocks within a single transaction.
+//
+// A batch is flushed once it holds maxSlots slots, or flushInterval after its first slot was added.
+// Head tracking continues to write each slot in its own transaction.
+type BatchDatabaseWriter struct {
+	db            sql.Database         // The DB to write to.
+	metrics       *BeaconClientMetrics // Used to keep track of the slots inserted.
+	maxSlots      int                  // The maximum number of slots within a single batch.
+	flushInterval time.Duration        // The maximum time a slot waits before its batch is flushed.
+
+	mu      sync.Mutex
+	current *writeBatch // The batch that new slots are added to.
+}
+
+// The slots that will be written within a single transaction.
+type writeBatch struct {
+	writers []*DatabaseWriter // The models for each slot.
+	timer   *time.Timer       // Flushes the batch once the flushInterval has passed.
+	done    chan struct{}     // Closed once the batch has been written.
+	err     error             // The error that occurred when writing the batch.
+}
+
+// Create a new BatchDatabaseWriter.
+func CreateBatchDatabaseWriter(db sql.Database, metrics *BeaconClientMetrics, maxSlots int, flushInterval time.Duration) *BatchDatabaseWriter {
+	if maxSlots < 1 {
+		maxSlots = 1
+	}
+	return &BatchDatabaseWriter{
+		db:            db,
+		metrics:       metrics,
+		maxSlots:      maxSlots,
+		flushInterval: flushInterval,
+	}
+}
+
+// Add the slot to the current batch, and wait until the batch has been written to the DB.
+func (bw *BatchDatabaseWriter) write(ctx context.Context, dw *DatabaseWriter) error {
+	bw.mu.Lock()
+	if bw.current == nil {
+		batch := &writeBatch{done: make(chan struct{})}
+		batch.timer = time.AfterFunc(bw.flushInterval, func() {
+			bw.flushIfCurrent(batch)
+		})
+		bw.current = batch
+	}
+	batch := bw.current
+	batch.writers = append(batch.writers, dw)
+	if len(batch.writers) >= bw.maxSlots {
+		bw.current = nil
+		batch.timer.Stop()
+		bw.mu.Unlock()
+		bw.flush(batch)
+	} else {
+		bw.mu.Unlock()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-batch.done:
+		return batch.err
+	}
+}
+
+// Flush the batch if it has not been flushed already.
+func (bw *BatchDatabaseWriter) flushIfCurrent(batch *writeBatch) {
+	bw.mu.Lock()
+	if bw.current != batch {
+		bw.mu.Unlock()
+		return
+	}
+	bw.current = nil
+	bw.mu.Unlock()
+	bw.flush(batch)
+}
+
+// Write the batch and notify every slot within it.
+func (bw *BatchDatabaseWriter) flush(batch *writeBatch) {
+	start := time.Now()
+	batch.err = bw.transactBatch(batch.writers)
+	if batch.err != nil {
+		loghelper.LogError(batch.err).WithField("slotCount", len(batch.writers)).Error("Unable to write the batch of slots to the DB")
+	} else {
+		bw.metrics.IncrementSlotInserts(uint64(len(batch.writers)))
+		log.WithFields(log.Fields{
+			"slotCount": len(batch.writers),
+			"duration":  time.Since(start),
+		}).Debug("Wrote a batch of slots to the DB")
+	}
+	close(batch.done)
+}
+
+// Copy every slot within the batch to the staging tables, and merge them into their final tables.
+func (bw *BatchDatabaseWriter) transactBatch(writers []*DatabaseWriter) error {
+	ctx := context.Background()
+	tx, err := bw.db.Begin(ctx)
+	if err != nil {
+		loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
+		return err
+	}
+	defer func() {
+		err := tx.Rollback(ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction")
+		}
+	}()
+
+	slotRows := make([][]interface{}, 0, len(writers))
+	signedBlockRows := make([][]interface{}, 0, len(writers))
+	stateRows := make([][]interface{}, 0, len(writers))
+	blocksRows := make([][]interface{}, 0, 2*len(writers))
+	for _, dw := range writers {
+		slotRows = append(slotRows, []interface{}{dw.DbSlots.Epoch, dw.DbSlots.Slot, dw.DbSlots.BlockRoot, dw.DbSlots.StateRoot, dw.DbSlots.Status})
+		if dw.DbSlots.Status == "skipped" {
+			continue
+		}
+		if dw.rawSignedBeaconBlock != nil && len(*dw.rawSignedBeaconBlock) != 0 {
+			blocksRows = append(blocksRows, []interface{}{dw.DbSignedBeaconBlock.MhKey, *dw.rawSignedBeaconBlock})
+			signedBlockRows = append(signedBlockRows, signedBeaconBlockRow(dw.DbSignedBeaconBlock))
+		}
+		if dw.rawBeaconState != nil && len(*dw.rawBeaconState) != 0 {
+			blocksRows = append(blocksRows, []interface{}{dw.DbBeaconState.MhKey, *dw.rawBeaconState})
+			stateRows = append(stateRows, []interface{}{dw.DbBeaconState.Slot, dw.DbBeaconState.StateRoot, dw.DbBeaconState.MhKey})
+		}
+	}
+
+	// The order matters, public.blocks must be written before the tables that reference it.
+	stages := []struct {
+		createStmt string
+		table      string
+		columns    []string
+		rows       [][]interface{}
+		mergeStmt  string
+	}{
+		{createBlocksStagingStmt, "blocks_staging", blocksStagingColumns, blocksRows, mergeBlocksStagingStmt},
+		{createSlotsStagingStmt, "slots_staging", slotsStagingColumns, slotRows, mergeSlotsStagingStmt},
+		{createSignedBeaconBlockStagingStmt, "signed_block_staging", signedBlockStagingColumns, signedBlockRows, mergeSignedBeaconBlockStagingStmt},
+		{createBeaconStateStagingStmt, "state_staging", stateStagingColumns, stateRows, mergeBeaconStateStagingStmt},
+	}
+	for _, stage := range stages {
+		if len(stage.rows) == 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, stage.createStmt); err != nil {
+			loghelper.LogError(err).WithField("table", stage.table).Error("Unable to create the staging table")
+			return err
+		}
+		if _, err := tx.CopyFrom(ctx, []string{stage.table}, stage.columns, stage.rows); err != nil {
+			loghelper.LogError(err).WithField("table", stage.table).Error("Unable to copy the batch into the staging table")
+			return err
+		}
+		if _, err := tx.Exec(ctx, stage.mergeStmt); err != nil {
+			loghelper.LogError(err).WithField("table", stage.table).Error("Unable to merge the staging table")
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		loghelper.LogError(err).Error("Unable to commit the batch of slots")
+		return err
+	}
+	return nil
+}
+
+// Create the row for the signed_block staging table. The payload columns are null prior to Bellatrix.
+func signedBeaconBlockRow(block *DbSignedBeaconBlock) []interface{} {
+	row := []interface{}{block.Slot, block.BlockRoot, block.ParentBlock, block.Eth1DataBlockHash, block.MhKey,
+		nil, nil, nil, nil, nil, nil, nil}
+	if payload := block.ExecutionPayloadHeader; payload != nil {
+		row[5] = payload.BlockNumber
+		row[6] = payload.Timestamp
+		row[7] = payload.BlockHash
+		row[8] = payload.ParentHash
+		row[9] = payload.StateRoot
+		row[10] = payload.ReceiptsRoot
+		row[11] = payload.TransactionsRoot
+	}
+	return row
+}
@@ -0,0 +1,44 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Batchdatabasewrite", Label("unit", "behavioral", "batch"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpMockedTest()
+	})
+
+	Context("Phase0 + Altairs: When we write the historic slots in batches.", func() {
+		It("Successfully Process the Blocks", func() {
+			bc.BatchWriter = beaconclient.CreateBatchDatabaseWriter(bc.Db, bc.Metrics, 2, time.Second)
+			BeaconNodeTester.writeEventToHistoricProcess(bc, 100, 101, 10)
+			BeaconNodeTester.runHistoricalProcess(bc, 2, 2, 0, 0, 0)
+			// A single slot is written once the flush interval passes.
+			BeaconNodeTester.writeEventToHistoricProcess(bc, 2375703, 2375703, 10)
+			BeaconNodeTester.runHistoricalProcess(bc, 2, 3, 0, 0, 0)
+
+			time.Sleep(2 * time.Second)
+			validatePopularBatchBlocks(bc)
+		})
+	})
+})
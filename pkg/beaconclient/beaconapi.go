@@ -0,0 +1,466 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a read-only subset of the beacon API, served from the objects stored in the DB.
+
+package beaconclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/protolambda/ztyp/codec"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+)
+
+const (
+	// The content type of SSZ encoded responses.
+	sszContentType = "application/octet-stream"
+	// The largest number of BeaconStates served at once, as each one can be hundreds of MB.
+	maxApiStateRequests = 4
+)
+
+var (
+	// Get the canonical block at a slot.
+	queryApiBlockBySlotStmt string = `SELECT s.slot, s.block_root AS root, s.status='proposed' AS canonical, sb.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.slot=$1 AND s.status='proposed';`
+	// Get a block by its root, canonical or not.
+	queryApiBlockByRootStmt string = `SELECT s.slot, s.block_root AS root, s.status='proposed' AS canonical, sb.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.block_root=$1
+	ORDER BY s.status='proposed' DESC
+	LIMIT 1;`
+	// Get the latest canonical block.
+	queryApiHeadBlockStmt string = `SELECT s.slot, s.block_root AS root, s.status='proposed' AS canonical, sb.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.status='proposed'
+	ORDER BY s.slot DESC
+	LIMIT 1;`
+	// Get the state of the canonical block at a slot.
+	queryApiStateBySlotStmt string = `SELECT st.slot, st.state_root AS root, true AS canonical, st.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root
+	WHERE s.slot=$1 AND s.status='proposed';`
+	// Get a state by its root.
+	queryApiStateByRootStmt string = `SELECT slot, state_root AS root, true AS canonical, mh_key
+	FROM eth_beacon.state
+	WHERE state_root=$1
+	LIMIT 1;`
+	// Get the state of the latest canonical block.
+	queryApiHeadStateStmt string = `SELECT st.slot, st.state_root AS root, true AS canonical, st.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root
+	WHERE s.slot=(SELECT MAX(slot) FROM eth_beacon.slots WHERE status='proposed') AND s.status='proposed';`
+)
+
+// A stored object, as returned by the queryApi statements.
+type apiObject struct {
+	Slot      uint64
+	Root      string
+	Canonical bool
+	MhKey     string
+}
+
+// An error returned by the beacon API.
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// The response of the v2 block and state endpoints.
+type VersionedResponse struct {
+	Version             string      `json:"version"`
+	ExecutionOptimistic bool        `json:"execution_optimistic"`
+	Data                interface{} `json:"data"`
+}
+
+// BeaconApiServer serves a read-only subset of the beacon API from the DB:
+//
+//	/eth/v2/beacon/blocks/{block_id}
+//	/eth/v1/beacon/blocks/{block_id}/root
+//	/eth/v1/beacon/headers/{block_id}
+//	/eth/v2/debug/beacon/states/{state_id}
+//	/eth/v0/beacon/proof/block/{block_id}?path=...
+//	/eth/v0/beacon/proof/state/{state_id}?path=...
+//
+// Responses are JSON encoded, unless the request accepts application/octet-stream, in which case the SSZ encoding
+// is returned. Since the DB does not track finality, the finalized and justified identifiers are not supported.
+type BeaconApiServer struct {
+	db     sql.Database
+	mux    *http.ServeMux
+	states chan struct{} // The BeaconStates being served, requests for more are rejected.
+}
+
+// Create a new BeaconApiServer.
+func NewBeaconApiServer(db sql.Database) *BeaconApiServer {
+	s := &BeaconApiServer{db: db, mux: http.NewServeMux(), states: make(chan struct{}, maxApiStateRequests)}
+	s.mux.HandleFunc("/eth/v2/beacon/blocks/", s.handleBlock)
+	s.mux.HandleFunc("/eth/v1/beacon/blocks/", s.handleBlockRoot)
+	s.mux.HandleFunc("/eth/v1/beacon/headers/", s.handleHeader)
+	s.mux.HandleFunc("/eth/v2/debug/beacon/states/", s.handleState)
+	s.mux.HandleFunc("/eth/v0/beacon/proof/block/", s.handleProof("block"))
+	s.mux.HandleFunc("/eth/v0/beacon/proof/state/", s.handleProof("state"))
+	return s
+}
+
+func (s *BeaconApiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeApiError(w, &apiError{Code: http.StatusMethodNotAllowed, Message: "Only GET requests are supported"})
+		return
+	}
+	log.WithFields(log.Fields{"path": r.URL.Path}).Debug("Serving beacon API request")
+	s.mux.ServeHTTP(w, r)
+}
+
+// GET /eth/v2/beacon/blocks/{block_id}
+func (s *BeaconApiServer) handleBlock(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "/eth/v2/beacon/blocks/", "")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	_, data, block, err := s.loadBlock(r, id)
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	w.Header().Set("Eth-Consensus-Version", block.Version())
+	if acceptsSsz(r) {
+		writeSsz(w, data)
+		return
+	}
+	writeJson(w, VersionedResponse{Version: block.Version(), Data: signedBlockJson(block)})
+}
+
+// GET /eth/v1/beacon/blocks/{block_id}/root
+func (s *BeaconApiServer) handleBlockRoot(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "/eth/v1/beacon/blocks/", "/root")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	obj, err := findApiObject(r.Context(), s.db, id, queryApiHeadBlockStmt, queryApiBlockBySlotStmt, queryApiBlockByRootStmt, "block")
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	if acceptsSsz(r) {
+		root, err := hex.DecodeString(strings.TrimPrefix(obj.Root, "0x"))
+		if err != nil {
+			writeApiError(w, err)
+			return
+		}
+		writeSsz(w, root)
+		return
+	}
+	writeJson(w, BlockRootResponse{Data: BlockRootMessage{Root: obj.Root}})
+}
+
+// GET /eth/v1/beacon/headers/{block_id}
+func (s *BeaconApiServer) handleHeader(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "/eth/v1/beacon/headers/", "")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	obj, _, block, err := s.loadBlock(r, id)
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	header := block.SignedHeader()
+	if acceptsSsz(r) {
+		var buf bytes.Buffer
+		if err := header.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+			writeApiError(w, err)
+			return
+		}
+		writeSsz(w, buf.Bytes())
+		return
+	}
+	writeJson(w, BlockHeaderResponse{Data: BlockHeaderData{
+		Root:      obj.Root,
+		Canonical: obj.Canonical,
+		Header: SignedHeaderMessage{
+			Message: HeaderMessage{
+				Slot:          strconv.FormatUint(uint64(header.Message.Slot), 10),
+				ProposerIndex: strconv.FormatUint(uint64(header.Message.ProposerIndex), 10),
+				ParentRoot:    toHex(header.Message.ParentRoot),
+				StateRoot:     toHex(header.Message.StateRoot),
+				BodyRoot:      toHex(header.Message.BodyRoot),
+			},
+			Signature: "0x" + hex.EncodeToString(header.Signature[:]),
+		},
+	}})
+}
+
+// GET /eth/v2/debug/beacon/states/{state_id}
+func (s *BeaconApiServer) handleState(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathId(r, "/eth/v2/debug/beacon/states/", "")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	release, err := s.acquireState()
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	defer release()
+	obj, err := findApiObject(r.Context(), s.db, id, queryApiHeadStateStmt, queryApiStateBySlotStmt, queryApiStateByRootStmt, "state")
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	data, err := loadApiData(r.Context(), s.db, obj, "state")
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	// Every state in the DB was written with the default spec, so its fork version names the fork.
+	fork, ok := beaconStateFork(nil, data)
+	if !ok {
+		writeApiError(w, fmt.Errorf("Unknown fork version in the BeaconState for slot %d", obj.Slot))
+		return
+	}
+	w.Header().Set("Eth-Consensus-Version", fork)
+	if acceptsSsz(r) {
+		writeSsz(w, data)
+		return
+	}
+	var state BeaconState
+	if err := state.UnmarshalSSZForFork(nil, fork, data); err != nil {
+		writeApiError(w, err)
+		return
+	}
+	writeJson(w, VersionedResponse{Version: state.Version(), Data: beaconStateJson(&state)})
+}
+
+// Take one of the BeaconStates that can be served at once, the returned function gives it back.
+func (s *BeaconApiServer) acquireState() (func(), error) {
+	select {
+	case s.states <- struct{}{}:
+		return func() { <-s.states }, nil
+	default:
+		return nil, &apiError{Code: http.StatusServiceUnavailable, Message: "Too many states are being served, try again later"}
+	}
+}
+
+// GET /eth/v0/beacon/proof/{block|state}/{id}?path=...
+// Each path parameter is proven against the block root or state root. This endpoint is not part of the standard beacon API.
+func (s *BeaconApiServer) handleProof(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathId(r, "/eth/v0/beacon/proof/"+kind+"/", "")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if kind == "state" {
+			release, err := s.acquireState()
+			if err != nil {
+				writeApiError(w, err)
+				return
+			}
+			defer release()
+		}
+		proofs, err := BuildStoredProofs(r.Context(), s.db, kind, id, r.URL.Query()["path"])
+		if err != nil {
+			writeApiError(w, err)
+			return
+		}
+		writeJson(w, ProofResponse{Data: proofs})
+	}
+}
+
+// Find and decode the SignedBeaconBlock for a block identifier.
+func (s *BeaconApiServer) loadBlock(r *http.Request, id string) (*apiObject, []byte, *SignedBeaconBlock, error) {
+	obj, err := findApiObject(r.Context(), s.db, id, queryApiHeadBlockStmt, queryApiBlockBySlotStmt, queryApiBlockByRootStmt, "block")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	data, err := loadApiData(r.Context(), s.db, obj, "block")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var block SignedBeaconBlock
+	if err := block.UnmarshalSSZ(data); err != nil {
+		return nil, nil, nil, err
+	}
+	return obj, data, &block, nil
+}
+
+// Find the stored object for a block or state identifier: head, genesis, a slot or a 0x prefixed root.
+func findApiObject(ctx context.Context, db sql.Database, id string, headStmt string, slotStmt string, rootStmt string, kind string) (*apiObject, error) {
+	var (
+		query string
+		args  []interface{}
+	)
+	switch {
+	case id == "head":
+		query = headStmt
+	case id == "genesis":
+		query, args = slotStmt, []interface{}{uint64(0)}
+	case id == "finalized" || id == "justified":
+		return nil, &apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("The %s %s is not tracked by this server", id, kind)}
+	case strings.HasPrefix(id, "0x"):
+		if _, err := hex.DecodeString(id[2:]); err != nil || len(id) != 66 {
+			return nil, &apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid %s id: %s", kind, id)}
+		}
+		query, args = rootStmt, []interface{}{strings.ToLower(id)}
+	default:
+		slot, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, &apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid %s id: %s", kind, id)}
+		}
+		query, args = slotStmt, []interface{}{slot}
+	}
+
+	var objects []apiObject
+	if err := db.Select(ctx, &objects, query, args...); err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, &apiError{Code: http.StatusNotFound, Message: fmt.Sprintf("The %s was not found", kind)}
+	}
+	return &objects[0], nil
+}
+
+// Load the SSZ encoding of a stored object from public.blocks.
+func loadApiData(ctx context.Context, db sql.Database, obj *apiObject, kind string) ([]byte, error) {
+	data, err := loadBlocksData(ctx, db, obj.MhKey)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, &apiError{Code: http.StatusNotFound, Message: fmt.Sprintf("The %s is not in public.blocks", kind)}
+	}
+	return data, nil
+}
+
+// Get the identifier from a request path, between the prefix and the suffix.
+func pathId(r *http.Request, prefix string, suffix string) (string, bool) {
+	if !strings.HasPrefix(r.URL.Path, prefix) || !strings.HasSuffix(r.URL.Path, suffix) {
+		return "", false
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), suffix)
+	return id, id != "" && !strings.Contains(id, "/")
+}
+
+// Does the request prefer the SSZ encoding? The quality values of the Accept header are compared, JSON is used when
+// they are equal.
+func acceptsSsz(r *http.Request) bool {
+	accept := r.Header.Values("Accept")
+	sszQuality := acceptQuality(accept, sszContentType)
+	return sszQuality > 0 && sszQuality > acceptQuality(accept, "application/json")
+}
+
+// The quality value the Accept header gives a media type, from the most specific media range that matches it.
+func acceptQuality(accept []string, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, header := range accept {
+		for _, mediaRange := range strings.Split(header, ",") {
+			rangeType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+			rangeSpecificity := -1
+			switch {
+			case rangeType == mediaType:
+				rangeSpecificity = 2
+			case rangeType == strings.SplitN(mediaType, "/", 2)[0]+"/*":
+				rangeSpecificity = 1
+			case rangeType == "*/*":
+				rangeSpecificity = 0
+			}
+			if rangeSpecificity <= specificity {
+				continue
+			}
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			quality, specificity = q, rangeSpecificity
+		}
+	}
+	return quality
+}
+
+// The zrnt object of the fork the block belongs to, which has the JSON encoding used by the beacon API.
+func signedBlockJson(block *SignedBeaconBlock) interface{} {
+	if block.IsBellatrix() {
+		return block.GetBellatrix()
+	}
+	if block.IsAltair() {
+		return block.GetAltair()
+	}
+	return block.GetPhase0()
+}
+
+// The zrnt object of the fork the state belongs to, which has the JSON encoding used by the beacon API.
+func beaconStateJson(state *BeaconState) interface{} {
+	if state.IsBellatrix() {
+		return state.GetBellatrix()
+	}
+	if state.IsAltair() {
+		return state.GetAltair()
+	}
+	return state.GetPhase0()
+}
+
+func writeSsz(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", sszContentType)
+	if _, err := w.Write(data); err != nil {
+		log.WithField("err", err).Debug("Unable to write the response")
+	}
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithField("err", err).Debug("Unable to write the response")
+	}
+}
+
+// Write an error in the format used by the beacon API. Errors that are not an apiError are internal errors.
+func writeApiError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		log.WithField("err", err).Error("Unable to serve the beacon API request")
+		apiErr = &apiError{Code: http.StatusInternalServerError, Message: "Internal server error"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	if err := json.NewEncoder(w).Encode(apiErr); err != nil {
+		log.WithField("err", err).Debug("Unable to write the response")
+	}
+}
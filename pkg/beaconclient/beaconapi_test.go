@@ -0,0 +1,150 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Beaconapi", Label("unit", "behavioral", "serve"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When serving the beacon API", func() {
+		It("Should serve the stored blocks, headers and states", func() {
+			srv := httptest.NewServer(beaconclient.NewBeaconApiServer(bc.Db))
+			defer srv.Close()
+			head := BeaconNodeTester.TestEvents["100"].HeadMessage
+
+			var root beaconclient.BlockRootResponse
+			Expect(getApiJson(srv.URL+"/eth/v1/beacon/blocks/100/root", &root)).To(Equal(http.StatusOK))
+			Expect(root.Data.Root).To(Equal(head.Block))
+
+			var header beaconclient.BlockHeaderResponse
+			Expect(getApiJson(srv.URL+"/eth/v1/beacon/headers/"+head.Block, &header)).To(Equal(http.StatusOK))
+			Expect(header.Data.Canonical).To(BeTrue())
+			Expect(header.Data.Header.Message.Slot).To(Equal("100"))
+			Expect(header.Data.Header.Message.StateRoot).To(Equal(head.State))
+
+			var block beaconclient.VersionedResponse
+			Expect(getApiJson(srv.URL+"/eth/v2/beacon/blocks/100", &block)).To(Equal(http.StatusOK))
+			Expect(block.Version).To(Equal("phase0"))
+
+			ssz, err := os.ReadFile(BeaconNodeTester.TestEvents["100"].BeaconState)
+			Expect(err).ToNot(HaveOccurred())
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/eth/v2/debug/beacon/states/"+head.State, nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Accept", "application/octet-stream")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(Equal(ssz))
+
+			var proofs beaconclient.ProofResponse
+			Expect(getApiJson(srv.URL+"/eth/v0/beacon/proof/state/100?path=slot&path=finalized_checkpoint.root&path=balances[3]", &proofs)).To(Equal(http.StatusOK))
+			Expect(proofs.Data).To(HaveLen(3))
+			for _, proof := range proofs.Data {
+				Expect(proof.Root).To(Equal(head.State))
+				valid, err := beaconclient.VerifyMerkleProof(proof)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(valid).To(BeTrue())
+			}
+			Expect(getApiJson(srv.URL+"/eth/v0/beacon/proof/block/100?path=body.graffiti", &proofs)).To(Equal(http.StatusOK))
+			Expect(proofs.Data[0].Root).To(Equal(head.Block))
+			Expect(getApiJson(srv.URL+"/eth/v0/beacon/proof/block/100?path=body.nope", &proofs)).To(Equal(http.StatusBadRequest))
+
+			Expect(getApiJson(srv.URL+"/eth/v2/beacon/blocks/99", &block)).To(Equal(http.StatusNotFound))
+			Expect(getApiJson(srv.URL+"/eth/v2/beacon/blocks/finalized", &block)).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
+
+// Query the beacon API served from the DB, and decode the JSON response. The status of the response is returned.
+func getApiJson(url string, v interface{}) int {
+	resp, err := http.Get(url)
+	Expect(err).ToNot(HaveOccurred())
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(v)).To(Succeed())
+	}
+	return resp.StatusCode
+}
+
+var _ = Describe("Accept header", Label("unit"), func() {
+	accepts := func(accept ...string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/eth/v2/debug/beacon/states/head", nil)
+		for _, v := range accept {
+			r.Header.Add("Accept", v)
+		}
+		return beaconclient.AcceptsSsz(r)
+	}
+
+	It("Should prefer JSON when SSZ is not accepted", func() {
+		Expect(accepts()).To(BeFalse())
+		Expect(accepts("*/*")).To(BeFalse())
+		Expect(accepts("application/json")).To(BeFalse())
+		Expect(accepts("application/octet-stream;q=0")).To(BeFalse())
+	})
+	It("Should compare the quality values", func() {
+		Expect(accepts("application/octet-stream")).To(BeTrue())
+		Expect(accepts("application/json;q=0.9, application/octet-stream")).To(BeTrue())
+		Expect(accepts("application/octet-stream;q=0.5, application/json")).To(BeFalse())
+		Expect(accepts("application/octet-stream;q=0.5, */*;q=0.1")).To(BeTrue())
+		Expect(accepts("application/json;q=0.2", "application/octet-stream;q=0.8")).To(BeTrue())
+	})
+})
+
+var _ = Describe("State fork", Label("unit"), func() {
+	// The SSZ encoding of a BeaconState up to the end of its fork field.
+	stateWithVersion := func(version common.Version) []byte {
+		ssz := make([]byte, 64)
+		copy(ssz[52:], version[:])
+		return ssz
+	}
+
+	It("Should name the fork from the current version of the state", func() {
+		for version, fork := range map[common.Version]string{
+			configs.Mainnet.GENESIS_FORK_VERSION:   "phase0",
+			configs.Mainnet.ALTAIR_FORK_VERSION:    "altair",
+			configs.Mainnet.BELLATRIX_FORK_VERSION: "bellatrix",
+		} {
+			name, ok := beaconclient.BeaconStateFork(nil, stateWithVersion(version))
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal(fork))
+		}
+	})
+	It("Should not name an unknown or truncated state", func() {
+		_, ok := beaconclient.BeaconStateFork(nil, stateWithVersion(common.Version{0xff, 0, 0, 0}))
+		Expect(ok).To(BeFalse())
+		_, ok = beaconclient.BeaconStateFork(nil, make([]byte, 55))
+		Expect(ok).To(BeFalse())
+	})
+})
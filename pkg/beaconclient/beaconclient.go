@@ -22,6 +22,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -37,7 +38,22 @@ var (
 	BcBlockRootEndpoint  = func(slot string) string {
 		return "/eth/v1/beacon/blocks/" + slot + "/root"
 	}
-	bcSlotsPerEpoch uint64 = 32 // Number of slots in a single Epoch
+	BcHeaderEndpoint = func(blockId string) string { // Endpoint to query individual block headers.
+		return "/eth/v1/beacon/headers/" + blockId
+	}
+	BcStateRootEndpoint = func(stateId string) string { // Endpoint to query the root of individual states.
+		return "/eth/v1/beacon/states/" + stateId + "/root"
+	}
+	BcFinalityCheckpointsEndpoint        = "/eth/v1/beacon/states/head/finality_checkpoints" // Endpoint to query the latest finalized checkpoint.
+	bcSlotsPerEpoch               uint64 = 32                                                // Number of slots in a single Epoch
+	bcAvailabilityPollInterval           = 30 * time.Second                                  // How often to check if the beacon server has finished backfilling.
+	bcLatestSlotPollInterval             = 12 * time.Second                                  // How often to refresh the latest slot in the beacon server, once per slot.
+	bcDeferredSlotDelay                  = 30 * time.Second                                  // How long a slot the beacon server does not have yet waits in eth_beacon.known_gaps.
+	bcDefaultCheckoutLease               = 5 * time.Minute                                   // How long a checked out row is held without a heartbeat, by default.
+	bcDefaultMaxAttempts                 = 10                                                // The number of failed attempts before a known gap is moved to the dead letter table, by default.
+	bcDefaultRetryBackoff                = time.Minute                                       // How long to wait after the first failed attempt to reprocess a known gap, by default.
+	bcDefaultMaxRetryBackoff             = time.Hour                                         // The longest wait between attempts to reprocess a known gap, by default.
+	bcDefaultHeadBufferSize              = 32                                                // The number of head slots fetched ahead of the slot being committed, by default.
 	//bcSlotPerHistoricalVector = 8192                                // The number of slots in a historic vector.
 	//bcFinalizedTopicEndpoint  = "/eth/v1/events?topics=finalized_checkpoint" // Endpoint used to subscribe to the head of the chain
 )
@@ -63,15 +79,36 @@ type BeaconClient struct {
 	PreviousBlockRoot   string                 // Whats the previous block root, used to check the next blocks parent.
 	HeadTracking        *SseEvents[Head]       // Track the head block
 	ReOrgTracking       *SseEvents[ChainReorg] // Track all Reorgs
+	HeadBufferSize      int                    // The number of head slots that can be fetched while an earlier slot is being committed.
+	previousLock        sync.RWMutex           // Guards StartingSlot, PreviousSlot and PreviousBlockRoot.
+	headInFlight        sync.WaitGroup         // The head slots that were received but not committed yet.
+	headStopLock        sync.Mutex             // Guards headStopped, so no slot is added to headInFlight while we wait on it.
+	headStopped         bool                   // Is head tracking stopping, new head slots are no longer processed.
 	//FinalizationTracking        *SseEvents[FinalizedCheckpoint] // Track all finalization checkpoints
 
 	// Used for Historical Processing
 
 	// The latest available slot within the Beacon Server. We can't query any slot greater than this.
-	// This value is lazily updated. Therefore at times it will be outdated.
+	// This value is periodically refreshed during batch processing. Therefore at times it will be outdated.
+	// Use atomic operations when accessing it.
 	LatestSlotInBeaconServer    int64
-	PerformHistoricalProcessing bool               // Should we perform historical processing?
-	HistoricalProcess           HistoricProcessing // object keeping track of historical processing
+	PerformHistoricalProcessing bool                      // Should we perform historical processing?
+	HistoricalProcess           HistoricProcessing        // object keeping track of historical processing
+	BeaconServerType            string                    // The beacon client we are using, lighthouse, prysm, teku, nimbus or lodestar.
+	BeaconServerAvailability    *BeaconServerAvailability // The slots the beacon server has backfilled, slots that are not available are deferred.
+	availabilityTracking        sync.Once                 // Starts tracking the slots available in the beacon server once, for every processing entry point.
+	BatchWriter                 *BatchDatabaseWriter      // Writes historic and known gaps slots in batches. When nil, each slot is written in its own transaction.
+	CheckoutLeaseDuration       time.Duration             // How long a checked out historic_process or known_gaps row is held without a heartbeat before other nodes can reclaim it.
+	KnownGapsRetryPolicy        RetryPolicy               // How many times a known_gaps entry is reprocessed before it is moved to the dead letter table.
+
+	// Shared by head, historic and known gaps processing.
+
+	MemoryBudget *MemoryBudget // The memory that slot processing can reserve before downloading objects.
+	StateCadence StateCadence  // Which slots we store BeaconStates for.
+
+	// The latest finalized epoch, only tracked when StateCadence only stores finalized epoch boundaries.
+	// Use atomic operations when accessing it.
+	FinalizedEpoch uint64
 }
 
 // A struct to keep track of relevant the head event topic.
@@ -115,6 +152,11 @@ func CreateBeaconClient(ctx context.Context, connectionProtocol string, bcAddres
 		CheckDb:                      checkDb,
 		PerformBeaconBlockProcessing: performBeaconBlockProcessing,
 		PerformBeaconStateProcessing: performBeaconStateProcessing,
+		BeaconServerAvailability:     &BeaconServerAvailability{},
+		MemoryBudget:                 CreateMemoryBudget(0, metrics),
+		CheckoutLeaseDuration:        bcDefaultCheckoutLease,
+		HeadBufferSize:               bcDefaultHeadBufferSize,
+		KnownGapsRetryPolicy:         RetryPolicy{MaxAttempts: bcDefaultMaxAttempts, Backoff: bcDefaultRetryBackoff, MaxBackoff: bcDefaultMaxRetryBackoff},
 		//FinalizationTracking: createSseEvent[FinalizedCheckpoint](endpoint, bcFinalizedTopicEndpoint),
 	}, nil
 }
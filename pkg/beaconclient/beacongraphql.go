@@ -0,0 +1,733 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a GraphQL API over the eth_beacon schema.
+
+package beaconclient
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+const (
+	// The largest number of entries returned by a single list field.
+	maxGraphQLResults = 1000
+	// The largest number of BeaconStates decoded by a single query, as each one can be hundreds of MB.
+	maxGraphQLStateDecodes = 4
+	// The deepest nesting of fields in a query.
+	maxGraphQLDepth = 8
+	// The largest number of resolvers run in parallel by a single query.
+	maxGraphQLParallelism = 4
+	// The largest number of queries executed at once, the others are rejected.
+	maxGraphQLRequests = 8
+)
+
+// The GraphQL schema served by NewGraphQLHandler.
+const beaconGraphQLSchema = `
+schema {
+	query: Query
+}
+
+# A 64 bit unsigned integer. It can be given as a number or a decimal string.
+scalar Long
+
+type Query {
+	# The rows of eth_beacon.slots selected by the filter, ordered by slot.
+	slots(filter: SlotFilter, first: Int = 100, skip: Int = 0): [Slot!]!
+	# The eth_beacon.known_gaps entries, highest priority first.
+	knownGaps(startSlot: Long, endSlot: Long, process: String, first: Int = 100, skip: Int = 0): [KnownGap!]!
+	# The slots that had a forked block, latest first.
+	reorgs(startSlot: Long, endSlot: Long, first: Int = 100, skip: Int = 0): [Reorg!]!
+}
+
+# Selects the slots to return. Empty fields are ignored, ranges are inclusive.
+input SlotFilter {
+	startSlot: Long
+	endSlot: Long
+	startEpoch: Long
+	endEpoch: Long
+	status: String
+	startPayloadBlockNumber: Long
+	endPayloadBlockNumber: Long
+}
+
+type Slot {
+	epoch: Long!
+	slot: Long!
+	blockRoot: String
+	stateRoot: String
+	# One of proposed, forked or skipped.
+	status: String!
+	block: Block
+	state: State
+}
+
+type Block {
+	slot: Long!
+	blockRoot: String!
+	parentBlockRoot: String!
+	eth1DataBlockHash: String!
+	mhKey: String!
+	executionPayloadHeader: ExecutionPayloadHeader
+	# The fields below are decoded from the SignedBeaconBlock stored in public.blocks.
+	version: String!
+	proposerIndex: Long!
+	graffiti: String!
+	signature: String!
+	proposerSlashings: Int!
+	attesterSlashings: Int!
+	attestations: Int!
+	deposits: Int!
+	voluntaryExits: Int!
+	syncCommitteeParticipants: Int
+	executionTransactionCount: Int
+}
+
+type ExecutionPayloadHeader {
+	blockNumber: Long!
+	timestamp: Long!
+	blockHash: String!
+	parentHash: String!
+	stateRoot: String!
+	receiptsRoot: String!
+	transactionsRoot: String!
+}
+
+type State {
+	slot: Long!
+	stateRoot: String!
+	mhKey: String!
+	# The fields below are decoded from the BeaconState stored in public.blocks.
+	version: String!
+	genesisValidatorsRoot: String!
+	validatorCount: Int!
+	finalizedEpoch: Long!
+	finalizedRoot: String!
+}
+
+type KnownGap {
+	startSlot: Long!
+	endSlot: Long!
+	checkedOut: Boolean!
+	checkedOutBy: Int
+	reprocessingError: String
+	entryError: String
+	entryTime: String!
+	entryProcess: String
+	priority: Int
+	attempts: Int!
+}
+
+type Reorg {
+	slot: Long!
+	canonicalBlockRoot: String
+	forkedBlockRoots: [String!]!
+}
+`
+
+var (
+	// Get the slots along with their block and state rows. The filter and paging are appended.
+	queryGqlSlotsStmt string = `SELECT s.epoch, s.slot, s.block_root, s.state_root, s.status,
+	sb.block_root IS NOT NULL AS has_block, sb.parent_block_root, sb.eth1_data_block_hash, sb.mh_key AS block_mh_key,
+	sb.payload_block_number, sb.payload_timestamp, sb.payload_block_hash, sb.payload_parent_hash,
+	sb.payload_state_root, sb.payload_receipts_root, sb.payload_transactions_root,
+	st.mh_key AS state_mh_key
+	FROM eth_beacon.slots s
+	LEFT JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	LEFT JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root`
+	// Get the slots with a forked block, along with their canonical block.
+	queryGqlReorgsStmt string = `SELECT slot,
+	MAX(block_root) FILTER (WHERE status='proposed') AS canonical_block_root,
+	ARRAY_AGG(block_root ORDER BY block_root) FILTER (WHERE status='forked') AS forked_block_roots
+	FROM eth_beacon.slots
+	WHERE slot >= $1 AND slot <= $2
+	GROUP BY slot
+	HAVING COUNT(*) FILTER (WHERE status='forked') > 0
+	ORDER BY slot DESC
+	LIMIT $3 OFFSET $4;`
+)
+
+// Create the http.Handler serving the GraphQL API at a single endpoint.
+func NewGraphQLHandler(db sql.Database) (http.Handler, error) {
+	schema, err := graphql.ParseSchema(beaconGraphQLSchema, &gqlQueryResolver{db: db},
+		graphql.MaxDepth(maxGraphQLDepth), graphql.MaxParallelism(maxGraphQLParallelism))
+	if err != nil {
+		loghelper.LogError(err).Error("Unable to parse the GraphQL schema")
+		return nil, err
+	}
+	return &gqlHandler{relay: &relay.Handler{Schema: schema}, requests: make(chan struct{}, maxGraphQLRequests)}, nil
+}
+
+// Bounds the queries executed at once, and the BeaconStates each one decodes.
+type gqlHandler struct {
+	relay    *relay.Handler
+	requests chan struct{}
+}
+
+func (h *gqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case h.requests <- struct{}{}:
+		defer func() { <-h.requests }()
+	default:
+		http.Error(w, "Too many GraphQL queries are being executed, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	decodes := int32(maxGraphQLStateDecodes)
+	h.relay.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), gqlStateDecodesKey{}, &decodes)))
+}
+
+// The context key of the number of BeaconStates the query can still decode.
+type gqlStateDecodesKey struct{}
+
+// Take one of the BeaconState decodes of the query.
+func takeGqlStateDecode(ctx context.Context) error {
+	decodes, ok := ctx.Value(gqlStateDecodesKey{}).(*int32)
+	if ok && atomic.AddInt32(decodes, -1) < 0 {
+		return fmt.Errorf("A query can decode at most %d BeaconStates, request fewer slots with a state", maxGraphQLStateDecodes)
+	}
+	return nil
+}
+
+// A 64 bit unsigned integer, the GraphQL Int type is limited to 32 bits.
+type Long uint64
+
+func (Long) ImplementsGraphQLType(name string) bool {
+	return name == "Long"
+}
+
+func (l *Long) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		v, err := strconv.ParseUint(input, 10, 64)
+		if err != nil {
+			return err
+		}
+		*l = Long(v)
+	case int32:
+		if input < 0 {
+			return fmt.Errorf("A Long must not be negative: %d", input)
+		}
+		*l = Long(input)
+	case int64:
+		if input < 0 {
+			return fmt.Errorf("A Long must not be negative: %d", input)
+		}
+		*l = Long(input)
+	case float64:
+		if input < 0 || input != math.Trunc(input) {
+			return fmt.Errorf("A Long must be a non-negative integer: %v", input)
+		}
+		*l = Long(input)
+	default:
+		return fmt.Errorf("Unexpected type %T for Long", input)
+	}
+	return nil
+}
+
+// The resolver for the Query type.
+type gqlQueryResolver struct {
+	db sql.Database
+}
+
+// The paging arguments of the list fields.
+type gqlPage struct {
+	First int32
+	Skip  int32
+}
+
+func (p gqlPage) limits() (int, int, error) {
+	if p.First < 0 || p.Skip < 0 {
+		return 0, 0, fmt.Errorf("first and skip must not be negative")
+	}
+	if p.First > maxGraphQLResults {
+		return 0, 0, fmt.Errorf("first must not be greater than %d", maxGraphQLResults)
+	}
+	return int(p.First), int(p.Skip), nil
+}
+
+// The input of the slots field.
+type gqlSlotFilter struct {
+	StartSlot               *Long
+	EndSlot                 *Long
+	StartEpoch              *Long
+	EndEpoch                *Long
+	Status                  *string
+	StartPayloadBlockNumber *Long
+	EndPayloadBlockNumber   *Long
+}
+
+// Build the WHERE clause for the filter.
+func (f *gqlSlotFilter) whereClause() (string, []interface{}) {
+	var args []interface{}
+	var conditions []string
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+	if f == nil {
+		return "", args
+	}
+	addLong := func(condition string, v *Long) {
+		if v != nil {
+			add(condition, uint64(*v))
+		}
+	}
+	addLong("s.slot >= $?", f.StartSlot)
+	addLong("s.slot <= $?", f.EndSlot)
+	addLong("s.epoch >= $?", f.StartEpoch)
+	addLong("s.epoch <= $?", f.EndEpoch)
+	if f.Status != nil {
+		add("s.status = $?", *f.Status)
+	}
+	addLong("sb.payload_block_number >= $?", f.StartPayloadBlockNumber)
+	addLong("sb.payload_block_number <= $?", f.EndPayloadBlockNumber)
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// A row returned by queryGqlSlotsStmt.
+type gqlSlotRow struct {
+	Epoch                   uint64
+	Slot                    uint64
+	BlockRoot               *string
+	StateRoot               *string
+	Status                  string
+	HasBlock                bool
+	ParentBlockRoot         *string
+	Eth1DataBlockHash       *string
+	BlockMhKey              *string
+	PayloadBlockNumber      *uint64
+	PayloadTimestamp        *uint64
+	PayloadBlockHash        *string
+	PayloadParentHash       *string
+	PayloadStateRoot        *string
+	PayloadReceiptsRoot     *string
+	PayloadTransactionsRoot *string
+	StateMhKey              *string
+}
+
+func (r *gqlQueryResolver) Slots(ctx context.Context, args struct {
+	Filter *gqlSlotFilter
+	gqlPage
+}) ([]*gqlSlotResolver, error) {
+	first, skip, err := args.limits()
+	if err != nil {
+		return nil, err
+	}
+	where, params := args.Filter.whereClause()
+	params = append(params, first, skip)
+	query := queryGqlSlotsStmt + where + fmt.Sprintf(" ORDER BY s.slot ASC, s.status ASC, s.block_root ASC LIMIT $%d OFFSET $%d;", len(params)-1, len(params))
+
+	var rows []gqlSlotRow
+	if err := r.db.Select(ctx, &rows, query, params...); err != nil {
+		loghelper.LogError(err).Error("Unable to get the slots for a GraphQL query")
+		return nil, err
+	}
+	slots := make([]*gqlSlotResolver, 0, len(rows))
+	for _, row := range rows {
+		slots = append(slots, &gqlSlotResolver{db: r.db, row: row})
+	}
+	return slots, nil
+}
+
+func (r *gqlQueryResolver) KnownGaps(ctx context.Context, args struct {
+	StartSlot *Long
+	EndSlot   *Long
+	Process   *string
+	gqlPage
+}) ([]*gqlKnownGapResolver, error) {
+	first, skip, err := args.limits()
+	if err != nil {
+		return nil, err
+	}
+	filter := KnownGapsFilter{}
+	if args.StartSlot != nil {
+		v := uint64(*args.StartSlot)
+		filter.StartSlot = &v
+	}
+	if args.EndSlot != nil {
+		v := uint64(*args.EndSlot)
+		filter.EndSlot = &v
+	}
+	if args.Process != nil {
+		filter.Process = *args.Process
+	}
+	gaps := []*gqlKnownGapResolver{}
+	if first == 0 {
+		return gaps, nil
+	}
+	entries, err := listKnownGaps(ctx, r.db, filter, first, skip)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		gaps = append(gaps, &gqlKnownGapResolver{entry: entry})
+	}
+	return gaps, nil
+}
+
+func (r *gqlQueryResolver) Reorgs(ctx context.Context, args struct {
+	StartSlot *Long
+	EndSlot   *Long
+	gqlPage
+}) ([]*gqlReorgResolver, error) {
+	first, skip, err := args.limits()
+	if err != nil {
+		return nil, err
+	}
+	startSlot, endSlot := uint64(0), uint64(math.MaxInt64)
+	if args.StartSlot != nil {
+		startSlot = uint64(*args.StartSlot)
+	}
+	if args.EndSlot != nil {
+		endSlot = uint64(*args.EndSlot)
+	}
+
+	var rows []gqlReorgResolver
+	if err := r.db.Select(ctx, &rows, queryGqlReorgsStmt, startSlot, endSlot, first, skip); err != nil {
+		loghelper.LogSlotRangeError(startSlot, endSlot, err).Error("Unable to get the reorgs for a GraphQL query")
+		return nil, err
+	}
+	reorgs := make([]*gqlReorgResolver, 0, len(rows))
+	for i := range rows {
+		reorgs = append(reorgs, &rows[i])
+	}
+	return reorgs, nil
+}
+
+// The resolver for the Slot type.
+type gqlSlotResolver struct {
+	db  sql.Database
+	row gqlSlotRow
+}
+
+func (r *gqlSlotResolver) Epoch() Long        { return Long(r.row.Epoch) }
+func (r *gqlSlotResolver) Slot() Long         { return Long(r.row.Slot) }
+func (r *gqlSlotResolver) BlockRoot() *string { return r.row.BlockRoot }
+func (r *gqlSlotResolver) StateRoot() *string { return r.row.StateRoot }
+func (r *gqlSlotResolver) Status() string     { return r.row.Status }
+
+func (r *gqlSlotResolver) Block() *gqlBlockResolver {
+	if !r.row.HasBlock || r.row.BlockMhKey == nil {
+		return nil
+	}
+	return &gqlBlockResolver{db: r.db, row: &r.row}
+}
+
+func (r *gqlSlotResolver) State() *gqlStateResolver {
+	if r.row.StateMhKey == nil {
+		return nil
+	}
+	return &gqlStateResolver{db: r.db, slot: r.row.Slot, stateRoot: *r.row.StateRoot, mhKey: *r.row.StateMhKey}
+}
+
+// The resolver for the Block type. The SignedBeaconBlock is only loaded from public.blocks, once, when one of
+// its decoded fields is requested.
+type gqlBlockResolver struct {
+	db  sql.Database
+	row *gqlSlotRow
+
+	once  sync.Once
+	block *SignedBeaconBlock
+	err   error
+}
+
+func (r *gqlBlockResolver) Slot() Long                { return Long(r.row.Slot) }
+func (r *gqlBlockResolver) BlockRoot() string         { return *r.row.BlockRoot }
+func (r *gqlBlockResolver) ParentBlockRoot() string   { return *r.row.ParentBlockRoot }
+func (r *gqlBlockResolver) Eth1DataBlockHash() string { return *r.row.Eth1DataBlockHash }
+func (r *gqlBlockResolver) MhKey() string             { return *r.row.BlockMhKey }
+
+func (r *gqlBlockResolver) ExecutionPayloadHeader() *gqlPayloadHeaderResolver {
+	if r.row.PayloadBlockNumber == nil {
+		return nil
+	}
+	return &gqlPayloadHeaderResolver{row: r.row}
+}
+
+// Load and decode the SignedBeaconBlock.
+func (r *gqlBlockResolver) load(ctx context.Context) (*SignedBeaconBlock, error) {
+	r.once.Do(func() {
+		data, err := loadBlocksData(ctx, r.db, *r.row.BlockMhKey)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if data == nil {
+			r.err = fmt.Errorf("The SignedBeaconBlock for slot %d is not in public.blocks", r.row.Slot)
+			return
+		}
+		var block SignedBeaconBlock
+		if err := block.UnmarshalSSZ(data); err != nil {
+			loghelper.LogSlotError(r.row.Slot, err).Error("Unable to decode the SignedBeaconBlock")
+			r.err = err
+			return
+		}
+		r.block = &block
+	})
+	return r.block, r.err
+}
+
+func (r *gqlBlockResolver) Version(ctx context.Context) (string, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	return block.Version(), nil
+}
+
+func (r *gqlBlockResolver) ProposerIndex(ctx context.Context) (Long, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return Long(block.Block().ProposerIndex()), nil
+}
+
+func (r *gqlBlockResolver) Graffiti(ctx context.Context) (string, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	return toHex(block.Block().Body().Graffiti()), nil
+}
+
+func (r *gqlBlockResolver) Signature(ctx context.Context) (string, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	signature := block.Signature()
+	return "0x" + hex.EncodeToString(signature[:]), nil
+}
+
+// Get the operation counts of the block body.
+func (r *gqlBlockResolver) operationCounts(ctx context.Context) (OperationCounts, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return OperationCounts{}, err
+	}
+	return block.Block().Body().OperationCounts(), nil
+}
+
+func (r *gqlBlockResolver) ProposerSlashings(ctx context.Context) (int32, error) {
+	counts, err := r.operationCounts(ctx)
+	return int32(counts.ProposerSlashings), err
+}
+
+func (r *gqlBlockResolver) AttesterSlashings(ctx context.Context) (int32, error) {
+	counts, err := r.operationCounts(ctx)
+	return int32(counts.AttesterSlashings), err
+}
+
+func (r *gqlBlockResolver) Attestations(ctx context.Context) (int32, error) {
+	counts, err := r.operationCounts(ctx)
+	return int32(counts.Attestations), err
+}
+
+func (r *gqlBlockResolver) Deposits(ctx context.Context) (int32, error) {
+	counts, err := r.operationCounts(ctx)
+	return int32(counts.Deposits), err
+}
+
+func (r *gqlBlockResolver) VoluntaryExits(ctx context.Context) (int32, error) {
+	counts, err := r.operationCounts(ctx)
+	return int32(counts.VoluntaryExits), err
+}
+
+func (r *gqlBlockResolver) SyncCommitteeParticipants(ctx context.Context) (*int32, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	participants, ok := block.Block().Body().SyncCommitteeParticipants()
+	if !ok {
+		return nil, nil
+	}
+	v := int32(participants)
+	return &v, nil
+}
+
+func (r *gqlBlockResolver) ExecutionTransactionCount(ctx context.Context) (*int32, error) {
+	block, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	count, ok := block.Block().Body().ExecutionTransactionCount()
+	if !ok {
+		return nil, nil
+	}
+	v := int32(count)
+	return &v, nil
+}
+
+// The resolver for the ExecutionPayloadHeader type.
+type gqlPayloadHeaderResolver struct {
+	row *gqlSlotRow
+}
+
+func (r *gqlPayloadHeaderResolver) BlockNumber() Long        { return Long(*r.row.PayloadBlockNumber) }
+func (r *gqlPayloadHeaderResolver) Timestamp() Long          { return Long(*r.row.PayloadTimestamp) }
+func (r *gqlPayloadHeaderResolver) BlockHash() string        { return *r.row.PayloadBlockHash }
+func (r *gqlPayloadHeaderResolver) ParentHash() string       { return *r.row.PayloadParentHash }
+func (r *gqlPayloadHeaderResolver) StateRoot() string        { return *r.row.PayloadStateRoot }
+func (r *gqlPayloadHeaderResolver) ReceiptsRoot() string     { return *r.row.PayloadReceiptsRoot }
+func (r *gqlPayloadHeaderResolver) TransactionsRoot() string { return *r.row.PayloadTransactionsRoot }
+
+// The resolver for the State type. The BeaconState is only loaded from public.blocks, once, when one of its
+// decoded fields is requested.
+type gqlStateResolver struct {
+	db        sql.Database
+	slot      uint64
+	stateRoot string
+	mhKey     string
+
+	once  sync.Once
+	state *BeaconState
+	err   error
+}
+
+func (r *gqlStateResolver) Slot() Long        { return Long(r.slot) }
+func (r *gqlStateResolver) StateRoot() string { return r.stateRoot }
+func (r *gqlStateResolver) MhKey() string     { return r.mhKey }
+
+// Load and decode the BeaconState.
+func (r *gqlStateResolver) load(ctx context.Context) (*BeaconState, error) {
+	r.once.Do(func() {
+		if err := takeGqlStateDecode(ctx); err != nil {
+			r.err = err
+			return
+		}
+		data, err := loadBlocksData(ctx, r.db, r.mhKey)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if data == nil {
+			r.err = fmt.Errorf("The BeaconState for slot %d is not in public.blocks", r.slot)
+			return
+		}
+		var state BeaconState
+		if err := state.UnmarshalSSZ(data); err != nil {
+			loghelper.LogSlotError(r.slot, err).Error("Unable to decode the BeaconState")
+			r.err = err
+			return
+		}
+		r.state = &state
+	})
+	return r.state, r.err
+}
+
+func (r *gqlStateResolver) Version(ctx context.Context) (string, error) {
+	state, err := r.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	return state.Version(), nil
+}
+
+func (r *gqlStateResolver) GenesisValidatorsRoot(ctx context.Context) (string, error) {
+	state, err := r.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	return toHex(state.GenesisValidatorsRoot()), nil
+}
+
+func (r *gqlStateResolver) ValidatorCount(ctx context.Context) (int32, error) {
+	state, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int32(state.ValidatorCount()), nil
+}
+
+func (r *gqlStateResolver) FinalizedEpoch(ctx context.Context) (Long, error) {
+	state, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	epoch, _ := state.FinalizedCheckpoint()
+	return Long(epoch), nil
+}
+
+func (r *gqlStateResolver) FinalizedRoot(ctx context.Context) (string, error) {
+	state, err := r.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	_, root := state.FinalizedCheckpoint()
+	return toHex(root), nil
+}
+
+// The resolver for the KnownGap type.
+type gqlKnownGapResolver struct {
+	entry KnownGapEntry
+}
+
+func (r *gqlKnownGapResolver) StartSlot() Long            { return Long(r.entry.StartSlot) }
+func (r *gqlKnownGapResolver) EndSlot() Long              { return Long(r.entry.EndSlot) }
+func (r *gqlKnownGapResolver) CheckedOut() bool           { return r.entry.CheckedOut }
+func (r *gqlKnownGapResolver) ReprocessingError() *string { return r.entry.ReprocessingError }
+func (r *gqlKnownGapResolver) EntryError() *string        { return r.entry.EntryError }
+func (r *gqlKnownGapResolver) EntryProcess() *string      { return r.entry.EntryProcess }
+func (r *gqlKnownGapResolver) Attempts() int32            { return int32(r.entry.Attempts) }
+
+func (r *gqlKnownGapResolver) CheckedOutBy() *int32 {
+	return toInt32(r.entry.CheckedOutBy)
+}
+
+func (r *gqlKnownGapResolver) EntryTime() string {
+	return r.entry.EntryTime.UTC().Format(time.RFC3339)
+}
+
+func (r *gqlKnownGapResolver) Priority() *int32 {
+	return toInt32(r.entry.Priority)
+}
+
+// The resolver for the Reorg type, also a row returned by queryGqlReorgsStmt.
+type gqlReorgResolver struct {
+	SlotNumber         uint64   `db:"slot"`
+	CanonicalRoot      *string  `db:"canonical_block_root"`
+	ForkedBlockRootSet []string `db:"forked_block_roots"`
+}
+
+func (r *gqlReorgResolver) Slot() Long                  { return Long(r.SlotNumber) }
+func (r *gqlReorgResolver) CanonicalBlockRoot() *string { return r.CanonicalRoot }
+func (r *gqlReorgResolver) ForkedBlockRoots() []string  { return r.ForkedBlockRootSet }
+
+func toInt32(v *int) *int32 {
+	if v == nil {
+		return nil
+	}
+	i := int32(*v)
+	return &i
+}
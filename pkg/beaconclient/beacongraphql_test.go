@@ -0,0 +1,121 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Beacongraphql", Label("unit", "behavioral", "graphql"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When querying the GraphQL API", func() {
+		It("Should resolve the slots with their decoded blocks and states", func() {
+			handler, err := beaconclient.NewGraphQLHandler(bc.Db)
+			Expect(err).ToNot(HaveOccurred())
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+			head := BeaconNodeTester.TestEvents["100"].HeadMessage
+
+			var result struct {
+				Data struct {
+					Slots []struct {
+						Slot      uint64
+						BlockRoot string
+						Status    string
+						Block     struct {
+							Version       string
+							ProposerIndex uint64
+						}
+						State struct {
+							StateRoot string
+							Version   string
+						}
+					}
+					KnownGaps []struct{ StartSlot uint64 }
+					Reorgs    []struct{ Slot uint64 }
+				}
+				Errors []interface{}
+			}
+			query := `{
+				slots(filter: {startSlot: 100, endSlot: "100", status: "proposed"}) {
+					slot blockRoot status
+					block { version proposerIndex }
+					state { stateRoot version }
+				}
+				knownGaps(startSlot: 100) { startSlot }
+				reorgs { slot }
+			}`
+			body, err := json.Marshal(map[string]string{"query": query})
+			Expect(err).ToNot(HaveOccurred())
+			resp, err := http.Post(srv.URL, "application/json", bytes.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(json.NewDecoder(resp.Body).Decode(&result)).To(Succeed())
+			Expect(result.Errors).To(BeEmpty())
+			Expect(result.Data.Slots).To(HaveLen(1))
+			Expect(result.Data.Slots[0].Slot).To(Equal(uint64(100)))
+			Expect(result.Data.Slots[0].BlockRoot).To(Equal(head.Block))
+			Expect(result.Data.Slots[0].Block.Version).To(Equal("phase0"))
+			Expect(result.Data.Slots[0].State.StateRoot).To(Equal(head.State))
+			Expect(result.Data.Slots[0].State.Version).To(Equal("phase0"))
+			Expect(result.Data.KnownGaps).To(BeEmpty())
+			Expect(result.Data.Reorgs).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("GraphQL slot filter", Label("unit"), func() {
+	It("Should not filter when no fields are set", func() {
+		var filter *beaconclient.GqlSlotFilter
+		where, args := filter.WhereClause()
+		Expect(where).To(BeEmpty())
+		Expect(args).To(BeEmpty())
+		where, args = (&beaconclient.GqlSlotFilter{}).WhereClause()
+		Expect(where).To(BeEmpty())
+		Expect(args).To(BeEmpty())
+	})
+	It("Should number the arguments of the fields that are set", func() {
+		startSlot, endEpoch, endBlockNumber := beaconclient.Long(100), beaconclient.Long(4), beaconclient.Long(15000000)
+		status := "proposed"
+		filter := &beaconclient.GqlSlotFilter{StartSlot: &startSlot, EndEpoch: &endEpoch, Status: &status, EndPayloadBlockNumber: &endBlockNumber}
+		where, args := filter.WhereClause()
+		Expect(where).To(Equal(" WHERE s.slot >= $1 AND s.epoch <= $2 AND s.status = $3 AND sb.payload_block_number <= $4"))
+		Expect(args).To(Equal([]interface{}{uint64(100), uint64(4), "proposed", uint64(15000000)}))
+	})
+})
+
+var _ = Describe("GraphQL state decodes", Label("unit"), func() {
+	It("Should limit the BeaconStates decoded by a single query", func() {
+		ctx := beaconclient.NewGqlQueryContext(context.Background())
+		for i := 0; i < beaconclient.MaxGraphQLStateDecodes; i++ {
+			Expect(beaconclient.TakeGqlStateDecode(ctx)).To(Succeed())
+		}
+		Expect(beaconclient.TakeGqlStateDecode(ctx)).ToNot(Succeed())
+		Expect(beaconclient.TakeGqlStateDecode(beaconclient.NewGqlQueryContext(context.Background()))).To(Succeed())
+	})
+})
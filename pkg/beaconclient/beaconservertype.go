@@ -0,0 +1,280 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the client specific logic used to determine which slots a beacon server can serve.
+
+package beaconclient
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	BeaconServerMissingSlots error = fmt.Errorf("The beacon server does not have all the slots from Genesis to head.")
+)
+
+// The slots that a beacon server is able to serve. The layout mirrors the anchor reported by lighthouse.
+//
+// SignedBeaconBlocks are available from OldestBlockSlot to HeadSlot.
+//
+// BeaconStates are available from Genesis to StateLowerLimit, and from StateUpperLimit to HeadSlot.
+type BeaconServerSlots struct {
+	HeadSlot        Slot // The head slot of the beacon server.
+	OldestBlockSlot Slot // The oldest slot that the server can provide a SignedBeaconBlock for.
+	StateLowerLimit Slot // BeaconStates are available for every slot less than or equal to this slot.
+	StateUpperLimit Slot // BeaconStates are available for every slot greater than or equal to this slot.
+}
+
+// Does the beacon server have every SignedBeaconBlock from Genesis to head.
+func (bss BeaconServerSlots) HasAllBlocks() bool {
+	return bss.OldestBlockSlot == 0
+}
+
+// Does the beacon server have every BeaconState from Genesis to head.
+func (bss BeaconServerSlots) HasAllStates() bool {
+	return bss.StateUpperLimit <= bss.StateLowerLimit+1
+}
+
+// Can the beacon server provide the SignedBeaconBlock for the given slot.
+func (bss BeaconServerSlots) IsBlockAvailable(slot Slot) bool {
+	return slot >= bss.OldestBlockSlot && slot <= bss.HeadSlot
+}
+
+// Can the beacon server provide the BeaconState for the given slot.
+func (bss BeaconServerSlots) IsStateAvailable(slot Slot) bool {
+	return slot <= bss.HeadSlot && (slot <= bss.StateLowerLimit || slot >= bss.StateUpperLimit)
+}
+
+// A thread safe record of the slots the beacon server can serve. It is shared by every worker, and is
+// updated while we wait for the beacon server to finish backfilling.
+//
+// Until the first update, every slot is treated as available.
+type BeaconServerAvailability struct {
+	mu    sync.RWMutex
+	known bool              // Have we queried the beacon server yet.
+	slots BeaconServerSlots // The slots the beacon server can serve.
+}
+
+// Replace the slots available in the beacon server.
+func (bsa *BeaconServerAvailability) Update(slots BeaconServerSlots) {
+	bsa.mu.Lock()
+	defer bsa.mu.Unlock()
+	bsa.known = true
+	bsa.slots = slots
+}
+
+// Return the slots available in the beacon server, and whether we have queried the beacon server yet.
+func (bsa *BeaconServerAvailability) Slots() (BeaconServerSlots, bool) {
+	bsa.mu.RLock()
+	defer bsa.mu.RUnlock()
+	return bsa.slots, bsa.known
+}
+
+// Has the beacon server backfilled every object we are processing.
+func (bsa *BeaconServerAvailability) IsComplete(performBeaconBlockProcessing bool, performBeaconStateProcessing bool) bool {
+	slots, known := bsa.Slots()
+	if !known {
+		return true
+	}
+	return (!performBeaconBlockProcessing || slots.HasAllBlocks()) && (!performBeaconStateProcessing || slots.HasAllStates())
+}
+
+// Has the beacon server backfilled the objects we are processing for the given slot.
+// The head slot is not considered, slots beyond head are handled separately.
+func (bsa *BeaconServerAvailability) IsBackfilled(slot Slot, performBeaconBlockProcessing bool, performBeaconStateProcessing bool) bool {
+	slots, known := bsa.Slots()
+	if !known {
+		return true
+	}
+	if performBeaconBlockProcessing && slot < slots.OldestBlockSlot {
+		return false
+	}
+	if performBeaconStateProcessing && slot > slots.StateLowerLimit && slot < slots.StateUpperLimit {
+		return false
+	}
+	return true
+}
+
+// An interface that captures the client specific logic for determining the slots a beacon server can serve.
+// Clients that expose their database or backfill status should use it, every other client falls back to
+// searching the standard beacon API.
+type BeaconServerType interface {
+	querySlotsInBeaconServer(bc *BeaconClient) (BeaconServerSlots, error) // Find the earliest and latest slots the server can serve.
+	missingSlotsError() error                                             // The error to return when the server is missing slots.
+}
+
+// Lighthouse reports its backfill status using the /lighthouse/database/info endpoint.
+type lighthouseServerType struct{}
+
+// Prysm, Teku, Nimbus and Lodestar do not expose their backfill status, so we
+// binary search the standard block and state endpoints.
+type standardServerType struct {
+	name string // The name of the client, used for logging.
+}
+
+// Return the BeaconServerType for the provided beacon client name.
+func resolveBeaconServerType(beaconServerType string) (BeaconServerType, error) {
+	switch strings.ToLower(beaconServerType) {
+	case "lighthouse":
+		return lighthouseServerType{}, nil
+	case "prysm", "teku", "nimbus", "lodestar":
+		return standardServerType{name: strings.ToLower(beaconServerType)}, nil
+	default:
+		log.WithFields(log.Fields{"BeaconServerType": beaconServerType}).Error(MissingBeaconServerType.Error())
+		return nil, MissingBeaconServerType
+	}
+}
+
+// Use the lighthouse anchor to determine which slots have been backfilled.
+func (lighthouseServerType) querySlotsInBeaconServer(bc *BeaconClient) (BeaconServerSlots, error) {
+	headSlot, err := bc.queryHeadSlotInBeaconServer()
+	if err != nil {
+		return BeaconServerSlots{}, err
+	}
+	lhDb, err := bc.queryLighthouseDbInfo()
+	if err != nil {
+		return BeaconServerSlots{}, err
+	}
+	slots := BeaconServerSlots{HeadSlot: Slot(headSlot)}
+	if lhDb.Anchor == (LhDbAnchor{}) {
+		log.WithFields(log.Fields{
+			"headSlot": headSlot,
+		}).Info("Anchor is nil, the lighthouse client has all the nodes from genesis to head.")
+		return slots, nil
+	}
+
+	log.WithFields(log.Fields{
+		"lhDb.Anchor": lhDb.Anchor,
+	}).Info("Anchor is not nil, the lighthouse client is missing some slots.")
+	if slots.OldestBlockSlot, err = ParseSlot(lhDb.Anchor.OldestBlockSlot); err != nil {
+		return BeaconServerSlots{}, fmt.Errorf("Unable to parse the oldest_block_slot from the lighthouse anchor: %s", err.Error())
+	}
+	if slots.StateLowerLimit, err = ParseSlot(lhDb.Anchor.StateLowerLimit); err != nil {
+		return BeaconServerSlots{}, fmt.Errorf("Unable to parse the state_lower_limit from the lighthouse anchor: %s", err.Error())
+	}
+	if slots.StateUpperLimit, err = ParseSlot(lhDb.Anchor.StateUpperLimit); err != nil {
+		return BeaconServerSlots{}, fmt.Errorf("Unable to parse the state_upper_limit from the lighthouse anchor: %s", err.Error())
+	}
+	return slots, nil
+}
+
+func (lighthouseServerType) missingSlotsError() error {
+	return LighthouseMissingSlots
+}
+
+// Binary search the block and state endpoints for the earliest slots the server can serve.
+// The Genesis state is always available, so StateLowerLimit is left at 0.
+func (sst standardServerType) querySlotsInBeaconServer(bc *BeaconClient) (BeaconServerSlots, error) {
+	headSlot, err := bc.queryHeadSlotInBeaconServer()
+	if err != nil {
+		return BeaconServerSlots{}, err
+	}
+	slots := BeaconServerSlots{HeadSlot: Slot(headSlot)}
+
+	log.WithFields(log.Fields{"BeaconServerType": sst.name, "headSlot": headSlot}).Debug("Searching for the oldest available block")
+	slots.OldestBlockSlot, err = searchEarliestAvailableSlot(0, slots.HeadSlot, func(slot Slot) (bool, error) {
+		return bc.isBlockAvailable(slot, slots.HeadSlot)
+	})
+	if err != nil {
+		return BeaconServerSlots{}, err
+	}
+
+	log.WithFields(log.Fields{"BeaconServerType": sst.name, "headSlot": headSlot}).Debug("Searching for the oldest available state")
+	slots.StateUpperLimit, err = searchEarliestAvailableSlot(0, slots.HeadSlot, bc.isStateAvailable)
+	if err != nil {
+		return BeaconServerSlots{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"BeaconServerType": sst.name,
+		"slots":            slots,
+	}).Info("Found the slots available in the beacon server.")
+	return slots, nil
+}
+
+func (standardServerType) missingSlotsError() error {
+	return BeaconServerMissingSlots
+}
+
+// Find the earliest slot within [low, high] that the beacon server can serve. The search assumes that
+// the server can serve every slot between the earliest available slot and high.
+func searchEarliestAvailableSlot(low Slot, high Slot, isAvailable func(Slot) (bool, error)) (Slot, error) {
+	for low < high {
+		mid := low + (high-low)/2
+		available, err := isAvailable(mid)
+		if err != nil {
+			return 0, err
+		}
+		if available {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
+
+// Check to see if the beacon server can serve the state for the given slot.
+func (bc *BeaconClient) isStateAvailable(slot Slot) (bool, error) {
+	var stateRoot StateRootResponse
+	rc, err := queryJson(bc.ServerEndpoint+BcStateRootEndpoint(slot.Format()), &stateRoot)
+	if rc == 404 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Check to see if the beacon server can tell us what the block for the given slot is.
+//
+// A 404 can either mean the slot was skipped or the server does not have the block. To tell the difference we look at
+// the next block within the epoch. If the server has the parent of that block, the slot was skipped.
+// If there is no block within the epoch, we assume the slot is unavailable.
+func (bc *BeaconClient) isBlockAvailable(slot Slot, headSlot Slot) (bool, error) {
+	var header BlockHeaderResponse
+	rc, err := queryJson(bc.ServerEndpoint+BcHeaderEndpoint(slot.Format()), &header)
+	if err == nil {
+		return true, nil
+	}
+	if rc != 404 {
+		return false, err
+	}
+
+	for next := slot + 1; next <= headSlot && next <= slot.Plus(bcSlotsPerEpoch); next++ {
+		rc, err = queryJson(bc.ServerEndpoint+BcHeaderEndpoint(next.Format()), &header)
+		if rc == 404 {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		var parent BlockHeaderResponse
+		rc, err = queryJson(bc.ServerEndpoint+BcHeaderEndpoint(header.Data.Header.Message.ParentRoot), &parent)
+		if rc == 404 {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -43,10 +43,26 @@ func (bc *BeaconClient) StopHeadTracking() error {
 
 	<-chHead
 	<-chReorg
+	// Stop accepting head slots, then wait for the head slots that were received to be committed.
+	bc.headStopLock.Lock()
+	bc.headStopped = true
+	bc.headStopLock.Unlock()
+	bc.headInFlight.Wait()
 	log.Info("Successfully stopped the head tracking service.")
 	return nil
 }
 
+// Add a head slot to headInFlight. Returns false once head tracking is stopping, the slot must not be processed.
+func (bc *BeaconClient) addHeadInFlight() bool {
+	bc.headStopLock.Lock()
+	defer bc.headStopLock.Unlock()
+	if bc.headStopped {
+		return false
+	}
+	bc.headInFlight.Add(1)
+	return true
+}
+
 // This function closes the SSE subscription, but waits until the MessagesCh is empty
 func (se *SseEvents[ProcessedEvents]) finishProcessingChannel(finish chan<- bool) {
 	loghelper.LogEndpoint(se.Endpoint).Info("Received a close event.")
@@ -461,9 +461,9 @@ var _ = Describe("Capturehead", Label("head"), func() {
 				defer httpmock.DeactivateAndReset()
 				BeaconNodeTester.testKnownGapsMessages(bc, 10, 10, maxRetry, BeaconNodeTester.TestEvents["100"].HeadMessage)
 
-				start, end := queryKnownGaps(bc.Db, "6", "16")
+				start, end := queryKnownGaps(bc.Db, "6", "15")
 				Expect(start).To(Equal(6))
-				Expect(end).To(Equal(16))
+				Expect(end).To(Equal(15))
 
 				start, end = queryKnownGaps(bc.Db, "96", "99")
 				Expect(start).To(Equal(96))
@@ -477,9 +477,9 @@ var _ = Describe("Capturehead", Label("head"), func() {
 				defer httpmock.DeactivateAndReset()
 				BeaconNodeTester.testKnownGapsMessages(bc, 1000000, 3, maxRetry, BeaconNodeTester.TestEvents["100"].HeadMessage, BeaconNodeTester.TestEvents["2375703"].HeadMessage)
 
-				start, end := queryKnownGaps(bc.Db, "101", "1000101")
+				start, end := queryKnownGaps(bc.Db, "101", "1000100")
 				Expect(start).To(Equal(101))
-				Expect(end).To(Equal(1000101))
+				Expect(end).To(Equal(1000100))
 
 				start, end = queryKnownGaps(bc.Db, "2000101", "2375702")
 				Expect(start).To(Equal(2000101))
@@ -521,6 +521,30 @@ var _ = Describe("Capturehead", Label("head"), func() {
 				BeaconNodeTester.testMultipleReorgs(bc, TestEvents["2375703-dummy"].HeadMessage, TestEvents["2375703-dummy-2"].HeadMessage, TestEvents["2375703"].HeadMessage, 74240, maxRetry)
 			})
 		})
+		Context("Phase 0: A head event for an earlier slot arrives late", func() {
+			It("Should add the late slot to the knownGaps table instead of processing it.", func() {
+				bc := setUpTest(BeaconNodeTester.TestConfig, "99")
+				BeaconNodeTester.SetupBeaconNodeMock(BeaconNodeTester.TestEvents, BeaconNodeTester.TestConfig.protocol, BeaconNodeTester.TestConfig.address, BeaconNodeTester.TestConfig.port, BeaconNodeTester.TestConfig.dummyParentRoot)
+				defer httpmock.DeactivateAndReset()
+				BeaconNodeTester.testLateHead(bc, TestEvents["101"].HeadMessage, TestEvents["100"].HeadMessage, 3, maxRetry)
+			})
+		})
+		Context("Phase 0: A reorg that spans multiple slots has occurred", func() {
+			It("The earlier slot on the losing branch should be marked as 'forked', and the missed canonical blocks should be indexed.", func() {
+				bc := setUpTest(BeaconNodeTester.TestConfig, "99")
+				BeaconNodeTester.SetupBeaconNodeMock(BeaconNodeTester.TestEvents, BeaconNodeTester.TestConfig.protocol, BeaconNodeTester.TestConfig.address, BeaconNodeTester.TestConfig.port, BeaconNodeTester.TestConfig.dummyParentRoot)
+				defer httpmock.DeactivateAndReset()
+				BeaconNodeTester.testDeepReorg(bc, TestEvents["100-dummy"].HeadMessage, true, TestEvents["100"].HeadMessage, TestEvents["101"].HeadMessage, 99, 3, maxRetry)
+			})
+			It("Should walk back to the common ancestor when the new head is at a later slot than the old head.", func() {
+				bc := setUpTest(BeaconNodeTester.TestConfig, "99")
+				BeaconNodeTester.SetupBeaconNodeMock(BeaconNodeTester.TestEvents, BeaconNodeTester.TestConfig.protocol, BeaconNodeTester.TestConfig.address, BeaconNodeTester.TestConfig.port, BeaconNodeTester.TestConfig.dummyParentRoot)
+				defer httpmock.DeactivateAndReset()
+				// The old head is at slot 99, two slots after the ancestor at 97, and the new head is at slot 101.
+				losingHead := beaconclient.Head{Slot: "99", Block: "0x9999999999999999999999999999999999999999999999999999999999999999", State: "0x99"}
+				BeaconNodeTester.testDeepReorg(bc, losingHead, false, TestEvents["100"].HeadMessage, TestEvents["101"].HeadMessage, 97, 3, maxRetry)
+			})
+		})
 	})
 })
 
@@ -719,7 +743,7 @@ func queryKnownGaps(db sql.Database, queryStartGap string, QueryEndGap string) (
 
 // A function that will remove all entries from the eth_beacon tables for you.
 func clearEthBeaconDbTables(db sql.Database) {
-	deleteQueries := []string{"DELETE FROM eth_beacon.slots;", "DELETE FROM eth_beacon.signed_block;", "DELETE FROM eth_beacon.state;", "DELETE FROM eth_beacon.known_gaps;", "DELETE FROM eth_beacon.historic_process;", "DELETE FROM public.blocks;"}
+	deleteQueries := []string{"DELETE FROM eth_beacon.slots;", "DELETE FROM eth_beacon.signed_block;", "DELETE FROM eth_beacon.state;", "DELETE FROM eth_beacon.known_gaps;", "DELETE FROM eth_beacon.historic_process;", "DELETE FROM eth_beacon.known_gaps_dead_letter;", "DELETE FROM eth_beacon.execution_mismatch;", "DELETE FROM public.blocks;"}
 	for _, queries := range deleteQueries {
 		_, err := db.Exec(context.Background(), queries)
 		Expect(err).ToNot(HaveOccurred())
@@ -988,6 +1012,108 @@ func (tbc TestBeaconNode) testMultipleReorgs(bc *beaconclient.BeaconClient, firs
 
 }
 
+// Helper function to test a head event that arrives after an event for a later slot.
+func (tbc TestBeaconNode) testLateHead(bc *beaconclient.BeaconClient, head beaconclient.Head, lateHead beaconclient.Head, epoch beaconclient.Epoch, maxRetry int) {
+	go bc.CaptureHead()
+	time.Sleep(1 * time.Second)
+
+	sendHeadMessage(bc, head, maxRetry, 1)
+	validateSlot(bc, head, epoch, "proposed")
+	startKnownGaps := atomic.LoadUint64(&bc.Metrics.KnownGapsInserts)
+
+	log.Info("Sending the late head to the BeaconClient")
+	data, err := json.Marshal(lateHead)
+	Expect(err).ToNot(HaveOccurred())
+	bc.HeadTracking.MessagesCh <- &sse.Event{
+		Data: data,
+	}
+
+	curRetry := 0
+	for atomic.LoadUint64(&bc.Metrics.HeadLateEvents) != 1 {
+		time.Sleep(1 * time.Second)
+		curRetry = curRetry + 1
+		if curRetry == maxRetry {
+			Fail("Too many retries have occurred.")
+		}
+	}
+
+	Expect(atomic.LoadUint64(&bc.Metrics.KnownGapsInserts)).To(Equal(startKnownGaps + 1))
+	Expect(atomic.LoadUint64(&bc.Metrics.SlotInserts)).To(Equal(uint64(1)))
+}
+
+// Helper function to test a reorg with a depth of two, measured from the losing head. The common ancestor, the
+// dummy parent of canonicalParent, is stored as proposed at ancestorSlot. The losing head is either processed by head
+// tracking or only stored, the canonical blocks must be indexed by the reorg itself.
+func (tbc TestBeaconNode) testDeepReorg(bc *beaconclient.BeaconClient, losingHead beaconclient.Head, processLosingHead bool, canonicalParent beaconclient.Head, canonicalHead beaconclient.Head, ancestorSlot int, epoch beaconclient.Epoch, maxRetry int) {
+	headerUrl := `=~^` + tbc.TestConfig.protocol + "://" + tbc.TestConfig.address + ":" + strconv.Itoa(tbc.TestConfig.port) + beaconclient.BcHeaderEndpoint("") + `([^/]+)\z`
+	headers := map[string]beaconclient.HeaderMessage{
+		canonicalHead.Block:            {Slot: canonicalHead.Slot, ParentRoot: canonicalParent.Block, StateRoot: canonicalHead.State},
+		canonicalParent.Block:          {Slot: canonicalParent.Slot, ParentRoot: tbc.TestConfig.dummyParentRoot, StateRoot: canonicalParent.State},
+		tbc.TestConfig.dummyParentRoot: {Slot: strconv.Itoa(ancestorSlot), ParentRoot: tbc.TestConfig.dummyParentRoot, StateRoot: ""},
+	}
+	insertSlotStmt := `INSERT INTO eth_beacon.slots (epoch, slot, block_root, state_root, status) VALUES ($1, $2, $3, $4, 'proposed')`
+	_, err := bc.Db.Exec(context.Background(), insertSlotStmt, epoch, ancestorSlot, tbc.TestConfig.dummyParentRoot, "")
+	Expect(err).ToNot(HaveOccurred())
+	httpmock.RegisterResponder("GET", headerUrl,
+		func(req *http.Request) (*http.Response, error) {
+			id := httpmock.MustGetSubmatch(req, 1)
+			header, ok := headers[id]
+			if !ok {
+				return httpmock.NewStringResponse(404, fmt.Sprintf("Unable to find header for %s", id)), nil
+			}
+			return httpmock.NewJsonResponse(200, beaconclient.BlockHeaderResponse{
+				Data: beaconclient.BlockHeaderData{Root: id, Canonical: true, Header: beaconclient.SignedHeaderMessage{Message: header}},
+			})
+		},
+	)
+
+	go bc.CaptureHead()
+	time.Sleep(1 * time.Second)
+
+	if processLosingHead {
+		log.Info("Sending the losing head to the BeaconClient")
+		sendHeadMessage(bc, losingHead, maxRetry, 1)
+	} else {
+		_, err := bc.Db.Exec(context.Background(), insertSlotStmt, epoch, losingHead.Slot, losingHead.Block, losingHead.State)
+		Expect(err).ToNot(HaveOccurred())
+	}
+	validateSlot(bc, losingHead, epoch, "proposed")
+
+	log.Info("Send the reorg message.")
+	data, err := json.Marshal(&beaconclient.ChainReorg{
+		Slot:                canonicalHead.Slot,
+		Depth:               "2",
+		OldHeadBlock:        losingHead.Block,
+		NewHeadBlock:        canonicalHead.Block,
+		OldHeadState:        losingHead.State,
+		NewHeadState:        canonicalHead.State,
+		Epoch:               epoch.Format(),
+		ExecutionOptimistic: false,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	bc.ReOrgTracking.MessagesCh <- &sse.Event{
+		Data: data,
+	}
+
+	curRetry := 0
+	for atomic.LoadUint64(&bc.Metrics.ReorgInserts) != 1 {
+		time.Sleep(1 * time.Second)
+		curRetry = curRetry + 1
+		if curRetry == maxRetry {
+			Fail("Too many retries have occurred.")
+		}
+	}
+
+	if bc.Metrics.KnownGapsInserts != 0 {
+		Fail("We found gaps when handling a reorg that spans multiple slots")
+	}
+
+	log.Info("Make sure every slot in the reorg was updated!")
+	validateSlot(bc, losingHead, epoch, "forked")
+	validateSlot(bc, canonicalParent, epoch, "proposed")
+	validateSlot(bc, canonicalHead, epoch, "proposed")
+}
+
 // A test to validate a single block was processed correctly
 func (tbc TestBeaconNode) testProcessBlock(bc *beaconclient.BeaconClient, head beaconclient.Head, epoch beaconclient.Epoch, maxRetry int, expectedSuccessInsert uint64, expectedKnownGaps uint64, expectedReorgs uint64) {
 	go bc.CaptureHead()
@@ -22,14 +22,19 @@ import (
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
 	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
-	"golang.org/x/sync/errgroup"
 )
 
 // This function will perform all the heavy lifting for tracking the head of the chain.
 func (bc *BeaconClient) CaptureHistoric(ctx context.Context, maxWorkers int, minimumSlot Slot) []error {
 	log.Info("We are starting the historical processing service.")
-	bc.HistoricalProcess = HistoricProcessing{db: bc.Db, metrics: bc.Metrics, uniqueNodeIdentifier: bc.UniqueNodeIdentifier}
+	bc.HistoricalProcess = HistoricProcessing{db: bc.Db, metrics: bc.Metrics, uniqueNodeIdentifier: bc.UniqueNodeIdentifier,
+		latestSlotInBeaconServer: &bc.LatestSlotInBeaconServer, leaseDuration: bc.checkoutLeaseDuration()}
+	bc.refreshLatestSlotInBeaconServer()
+	bc.refreshFinalizedEpoch()
+	go bc.trackLatestSlotInBeaconServer(ctx)
+	bc.trackBeaconServerAvailability(ctx)
 	errs := handleBatchProcess(ctx, maxWorkers, bc.HistoricalProcess, bc.SlotProcessingDetails(), bc.Metrics.IncrementHistoricSlotProcessed, minimumSlot)
 	log.Debug("Exiting Historical")
 	return errs
@@ -54,8 +59,10 @@ func (bc *BeaconClient) StopHistoric(cancel context.CancelFunc) error {
 type BatchProcessing interface {
 	getSlotRange(context.Context, chan<- slotsToProcess, Slot) []error // Write the slots to process in a channel, return an error if you cant get the next slots to write.
 	handleProcessingErrors(context.Context, <-chan batchHistoricError) // Custom logic to handle errors.
-	removeTableEntry(context.Context, <-chan slotsToProcess) error     // With the provided start and end slot, remove the entry from the database.
+	completeSlot(slotsToProcess, Slot) error                           // Record that a slot within the entry is done, the entry is removed once every slot is done.
+	deferSlots(slotsToProcess, Slot, Slot) error                       // Write the slots the beacon server does not have yet back to the DB, to be retried later.
 	releaseDbLocks() error                                             // Update the checked_out column to false for whatever table is being updated.
+	maintainLease(context.Context)                                     // Renew the lease on the rows this node has checked out, until the context is cancelled.
 }
 
 /// ^^^
@@ -66,14 +73,22 @@ type BatchProcessing interface {
 
 // A struct to pass around indicating a table entry for slots to process.
 type slotsToProcess struct {
-	startSlot Slot // The start slot
-	endSlot   Slot // The end slot
+	startSlot Slot         // The start slot
+	endSlot   Slot         // The end slot
+	completed slotProgress // The slots within the entry that were completed before it was checked out.
+}
+
+// A single slot to process, and the table entry it belongs to.
+type slotInEntry struct {
+	slot  Slot           // The slot to process.
+	entry slotsToProcess // The table entry the slot belongs to.
 }
 
 type batchHistoricError struct {
-	err        error  // The error that occurred when attempting to a slot
-	errProcess string // The process that caused the error.
-	slot       Slot   // The slot which the error is for.
+	err        error          // The error that occurred when attempting to a slot
+	errProcess string         // The process that caused the error.
+	slot       Slot           // The slot which the error is for.
+	entry      slotsToProcess // The table entry the slot belongs to.
 }
 
 // Wrapper function for the BatchProcessing interface.
@@ -87,13 +102,14 @@ type batchHistoricError struct {
 //
 // 3. Process the slots and send the err to the ErrCh. Each structure can define how it wants its own errors handled.
 //
-// 4. Remove the slot entry from the DB.
+// 4. Record each slot that is done, and remove the entry from the DB once every slot in it is done.
+// Slots that were already completed are skipped, so an entry that is checked out again resumes where it stopped.
 //
 // 5. Handle any errors.
 func handleBatchProcess(ctx context.Context, maxWorkers int, bp BatchProcessing, spd SlotProcessingDetails, incrementTracker func(uint64), minimumSlot Slot) []error {
 	slotsCh := make(chan slotsToProcess)
-	workCh := make(chan Slot)
-	processedCh := make(chan slotsToProcess)
+	workCh := make(chan slotInEntry)
+	completedCh := make(chan slotInEntry)
 	errCh := make(chan batchHistoricError)
 	finalErrCh := make(chan []error, 1)
 
@@ -102,12 +118,13 @@ func handleBatchProcess(ctx context.Context, maxWorkers int, bp BatchProcessing,
 	if err != nil {
 		loghelper.LogError(err).Error(("We are unable to un-checkout entries at the start!"))
 	}
+	go bp.maintainLease(ctx)
 
 	// Start workers
 	for w := 1; w <= maxWorkers; w++ {
 		log.WithFields(log.Fields{"maxWorkers": maxWorkers}).Debug("Starting batch processing workers")
 
-		go processSlotRangeWorker(ctx, workCh, errCh, spd, incrementTracker)
+		go processSlotRangeWorker(ctx, workCh, completedCh, errCh, spd, incrementTracker)
 	}
 
 	// Process all ranges and send each individual slot to the worker.
@@ -123,36 +140,73 @@ func handleBatchProcess(ctx context.Context, maxWorkers int, bp BatchProcessing,
 						err:        fmt.Errorf("We received a startSlot where the start was greater than the end."),
 						errProcess: "RangeOrder",
 						slot:       slots.startSlot,
+						entry:      slots,
 					}
 					errCh <- batchHistoricError{
 						err:        fmt.Errorf("We received a endSlot where the start was greater than the end."),
 						errProcess: "RangeOrder",
 						slot:       slots.endSlot,
+						entry:      slots,
 					}
-				} else if slots.startSlot == slots.endSlot {
-					log.WithField("slot", slots.startSlot).Debug("Added new slot to workCh")
-					workCh <- slots.startSlot
-					processedCh <- slots
+				} else if slots.completed.isRangeComplete(slots) {
+					// The entry was completed, but not removed, before it was checked out again.
+					completedCh <- slotInEntry{slot: slots.endSlot, entry: slots}
 				} else {
+					// Consecutive slots the beacon server does not have yet are written back to the DB together.
+					deferred, deferredStart := false, slots.startSlot
+					deferSlots := func(endSlot Slot) bool {
+						if !deferred {
+							return true
+						}
+						deferred = false
+						if err := bp.deferSlots(slots, deferredStart, endSlot); err != nil {
+							finalErrCh <- []error{err}
+							return false
+						}
+						log.WithFields(log.Fields{"startSlot": deferredStart, "endSlot": endSlot}).Debug("Deferred the slots the beacon server does not have yet")
+						return true
+					}
 					for i := slots.startSlot; i <= slots.endSlot; i++ {
-						workCh <- i
+						if slots.isSlotComplete(i) {
+							if !deferSlots(i - 1) {
+								return
+							}
+							log.WithField("slot", i).Debug("Skipping a slot that was already completed")
+							continue
+						}
+						if !spd.isSlotAvailable(i) {
+							if !deferred {
+								deferred, deferredStart = true, i
+							}
+							continue
+						}
+						if !deferSlots(i - 1) {
+							return
+						}
+						workCh <- slotInEntry{slot: i, entry: slots}
 						log.WithField("slot", i).Debug("Added new slot to workCh")
 					}
-					processedCh <- slots
+					if !deferSlots(slots.endSlot) {
+						return
+					}
 				}
 			}
 
 		}
 	}()
 
-	// Remove entries, end the application if a row cannot be removed..
+	// Record completed slots and remove completed entries, end the application if an entry cannot be updated.
 	go func() {
-		errG := new(errgroup.Group)
-		errG.Go(func() error {
-			return bp.removeTableEntry(ctx, processedCh)
-		})
-		if err := errG.Wait(); err != nil {
-			finalErrCh <- []error{err}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case work := <-completedCh:
+				if err := bp.completeSlot(work.entry, work.slot); err != nil {
+					finalErrCh <- []error{err}
+					return
+				}
+			}
 		}
 	}()
 	// Process errors from slot processing.
@@ -177,3 +231,20 @@ func handleBatchProcess(ctx context.Context, maxWorkers int, bp BatchProcessing,
 		return errs
 	}
 }
+
+// Write a range of slots the beacon server does not have yet to eth_beacon.known_gaps as its own entry, which is not
+// checked out until the delay has passed, and mark them as done within their entry.
+func deferSlotRange(db sql.Database, entry slotsToProcess, startSlot Slot, endSlot Slot, completeSlot func(slotsToProcess, Slot) error) error {
+	_, err := db.Exec(context.Background(), insertDeferredKgEntryStmt, startSlot, endSlot,
+		"The beacon server does not have the slots yet", "deferred", bcDeferredSlotDelay.Seconds())
+	if err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to write the deferred slots to eth_beacon.known_gaps")
+		return err
+	}
+	for slot := startSlot; slot <= endSlot; slot++ {
+		if err := completeSlot(entry, slot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
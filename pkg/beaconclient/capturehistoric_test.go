@@ -172,6 +172,37 @@ var _ = Describe("Capturehistoric", func() {
 			})
 		})
 	})
+	Describe("Running historic and known gaps processing together, as capture full does", Label("unit", "behavioral", "full"), func() {
+		Context("When the lighthouse server has not backfilled the slots", func() {
+			It("Should defer them to the eth_beacon.known_gaps table", func() {
+				bc := setUpMockedTest()
+				// capture full boots in head mode, so the availability is only loaded once processing starts.
+				bc.BeaconServerType = "lighthouse"
+				mockServer := MockServerStatus{Protocol: BeaconNodeTester.TestConfig.protocol, Address: BeaconNodeTester.TestConfig.address, Port: BeaconNodeTester.TestConfig.port, HeadSlot: 1000}
+				mockServer.registerHeadSync()
+				mockServer.registerLighthouseDbInfo(`{"anchor_slot":"800","oldest_block_slot":"600","oldest_block_parent":"0x00","state_upper_limit":"640","state_lower_limit":"0"}`)
+				BeaconNodeTester.writeEventToHistoricProcess(bc, 100, 101, 10)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				go bc.CaptureHistoric(ctx, 2, 0)
+				go bc.ProcessKnownGaps(ctx, 2, 0)
+				deferred := func() []string {
+					var entries []string
+					err := bc.Db.Select(context.Background(), &entries, `SELECT start_slot || '-' || end_slot FROM eth_beacon.known_gaps WHERE entry_process='deferred'`)
+					Expect(err).ToNot(HaveOccurred())
+					return entries
+				}
+				Eventually(deferred, 10*time.Second, 500*time.Millisecond).Should(Equal([]string{"100-101"}))
+				Expect(bc.StopHistoric(cancel)).To(Succeed())
+				Expect(bc.StopKnownGapsProcessing(cancel)).To(Succeed())
+
+				Expect(atomic.LoadUint64(&bc.Metrics.SlotInserts)).To(BeZero())
+				var remaining int
+				Expect(bc.Db.QueryRow(context.Background(), `SELECT count(*) FROM eth_beacon.historic_process`).Scan(&remaining)).To(Succeed())
+				Expect(remaining).To(BeZero())
+			})
+		})
+	})
 })
 
 // This function will write an even to the eth_beacon.known_gaps table
@@ -304,3 +335,21 @@ func validateAllRowsCheckedOut(db sql.Database, checkStmt string) {
 	Expect(err).ToNot(HaveOccurred())
 	Expect(rows).To(Equal(int64(0)))
 }
+
+// Set up a Beacon Client, with the Beacon Server mocked until the spec ends.
+func setUpMockedTest() *beaconclient.BeaconClient {
+	bc := setUpTest(BeaconNodeTester.TestConfig, "99")
+	BeaconNodeTester.SetupBeaconNodeMock(BeaconNodeTester.TestEvents, BeaconNodeTester.TestConfig.protocol, BeaconNodeTester.TestConfig.address, BeaconNodeTester.TestConfig.port, BeaconNodeTester.TestConfig.dummyParentRoot)
+	DeferCleanup(httpmock.DeactivateAndReset)
+	return bc
+}
+
+// Set up a Beacon Client with slots 100 and 101 captured by historic processing.
+// The Beacon Server mock is deactivated afterwards, so the specs only read from the DB.
+func setUpStoredSlots() *beaconclient.BeaconClient {
+	bc := setUpMockedTest()
+	BeaconNodeTester.writeEventToHistoricProcess(bc, 100, 101, 10)
+	BeaconNodeTester.runHistoricalProcess(bc, 2, 2, 0, 0, 0)
+	httpmock.DeactivateAndReset()
+	return bc
+}
@@ -18,13 +18,14 @@ package beaconclient
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
@@ -49,7 +50,7 @@ type SyncData struct {
 
 // This function will check to see if we are synced up with the head of chain.
 // {"data":{"is_syncing":true,"head_slot":"62528","sync_distance":"3734299"}}
-func (bc BeaconClient) CheckHeadSync() (bool, error) {
+func (bc *BeaconClient) CheckHeadSync() (bool, error) {
 	syncStatus, err := bc.QueryHeadSync()
 	if err != nil {
 		return true, nil
@@ -57,7 +58,7 @@ func (bc BeaconClient) CheckHeadSync() (bool, error) {
 	return syncStatus.Data.IsSync, nil
 }
 
-func (bc BeaconClient) QueryHeadSync() (Sync, error) {
+func (bc *BeaconClient) QueryHeadSync() (Sync, error) {
 	var syncStatus Sync
 	bcSync := bc.ServerEndpoint + BcSyncStatusEndpoint
 	resp, err := http.Get(bcSync)
@@ -124,20 +125,21 @@ type LhDbAnchor struct {
 }
 
 // This function will notify us what the head slot is.
-func (bc BeaconClient) queryHeadSlotInBeaconServer() (int, error) {
+func (bc *BeaconClient) queryHeadSlotInBeaconServer() (int, error) {
 	syncStatus, err := bc.QueryHeadSync()
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 	headSlot, err := strconv.Atoi(syncStatus.Data.HeadSlot)
 	if err != nil {
-		return 0, nil
+		loghelper.LogError(err).WithField("headSlot", syncStatus.Data.HeadSlot).Error("Unable to parse the head slot")
+		return 0, err
 	}
 	return headSlot, nil
 }
 
 // return the lighthouse Database Info
-func (bc BeaconClient) queryLighthouseDbInfo() (LighthouseDatabaseInfo, error) {
+func (bc *BeaconClient) queryLighthouseDbInfo() (LighthouseDatabaseInfo, error) {
 	var dbInfo LighthouseDatabaseInfo
 
 	lhDbInfo := bc.ServerEndpoint + LhDbInfoEndpoint
@@ -171,40 +173,42 @@ func (bc BeaconClient) queryLighthouseDbInfo() (LighthouseDatabaseInfo, error) {
 	return dbInfo, nil
 }
 
+// This function will tell us which slots the beacon server has available. Lighthouse reports this
+// directly, every other supported client (prysm, teku, nimbus and lodestar) is searched using the standard beacon API.
+func (bc *BeaconClient) GetSlotsInBeaconServer(beaconServerType string) (BeaconServerSlots, error) {
+	serverType, err := resolveBeaconServerType(beaconServerType)
+	if err != nil {
+		return BeaconServerSlots{}, err
+	}
+	return serverType.querySlotsInBeaconServer(bc)
+}
+
 // This function will tell us what the latest slot is that the beacon server has available. This is important as
 // it will ensure us that we have all slots prior to the given slot.
-func (bc BeaconClient) GetLatestSlotInBeaconServer(beaconServerType string) (int, error) {
-	switch strings.ToLower(beaconServerType) {
-	case "lighthouse":
-		headSlot, err := bc.queryHeadSlotInBeaconServer()
-		if err != nil {
-			return 0, err
-		}
-		lhDb, err := bc.queryLighthouseDbInfo()
-		if err != nil {
-			return 0, err
-		}
-		if lhDb.Anchor == (LhDbAnchor{}) {
-			//atomic.StoreInt64(&bc.LatestSlotInBeaconServer, int64(headSlot))
-			log.WithFields(log.Fields{
-				"headSlot": headSlot,
-			}).Info("Anchor is nil, the lighthouse client has all the nodes from genesis to head.")
-			return headSlot, nil
-		} else {
-			log.WithFields(log.Fields{
-				"lhDb.Anchor": lhDb.Anchor,
-			}).Info(LighthouseMissingSlots.Error())
-			log.Info("We will add a feature down the road to wait for anchor to be null, if its needed.")
-			return 0, LighthouseMissingSlots
-		}
-	default:
-		log.WithFields(log.Fields{"BeaconServerType": beaconServerType}).Error(MissingBeaconServerType.Error())
-		return 0, MissingBeaconServerType
+//
+// Only the objects we are processing need to be available, so a server that has all the blocks
+// but is missing states can still be used when state processing is disabled.
+func (bc *BeaconClient) GetLatestSlotInBeaconServer(beaconServerType string) (int, error) {
+	serverType, err := resolveBeaconServerType(beaconServerType)
+	if err != nil {
+		return 0, err
 	}
+	slots, err := serverType.querySlotsInBeaconServer(bc)
+	if err != nil {
+		return 0, err
+	}
+	if (bc.PerformBeaconBlockProcessing && !slots.HasAllBlocks()) || (bc.PerformBeaconStateProcessing && !slots.HasAllStates()) {
+		log.WithFields(log.Fields{
+			"BeaconServerType": beaconServerType,
+			"slots":            slots,
+		}).Info(serverType.missingSlotsError().Error())
+		return 0, serverType.missingSlotsError()
+	}
+	return int(slots.HeadSlot), nil
 }
 
 // A wrapper function for updating the latest slot.
-func (bc BeaconClient) UpdateLatestSlotInBeaconServer(headSlot int64) {
+func (bc *BeaconClient) UpdateLatestSlotInBeaconServer(headSlot int64) {
 	curr := atomic.LoadInt64(&bc.LatestSlotInBeaconServer)
 	log.WithFields(log.Fields{
 		"Previous Latest Slot": curr,
@@ -212,3 +216,84 @@ func (bc BeaconClient) UpdateLatestSlotInBeaconServer(headSlot int64) {
 	}).Debug("Swapping Head Slot")
 	atomic.SwapInt64(&bc.LatestSlotInBeaconServer, int64(headSlot))
 }
+
+// Query the beacon server for the slots it has available, and record them so that
+// slots which have not been backfilled are deferred.
+func (bc *BeaconClient) UpdateBeaconServerAvailability() (BeaconServerSlots, error) {
+	slots, err := bc.GetSlotsInBeaconServer(bc.BeaconServerType)
+	if err != nil {
+		return slots, err
+	}
+	bc.BeaconServerAvailability.Update(slots)
+	return slots, nil
+}
+
+// Load the slots available in the beacon server before any slot is processed, and keep them up to date until it has
+// backfilled every slot we need. Historic and known gaps processing both call it, only the first call does anything,
+// so it works regardless of the mode the application was booted in.
+func (bc *BeaconClient) trackBeaconServerAvailability(ctx context.Context) {
+	bc.availabilityTracking.Do(func() {
+		if bc.BeaconServerType == "" {
+			log.Warn("The beacon server type is not set, every slot is treated as available.")
+			return
+		}
+		if _, known := bc.BeaconServerAvailability.Slots(); !known {
+			slots, err := bc.UpdateBeaconServerAvailability()
+			if err != nil {
+				loghelper.LogError(err).Warn("Unable to check which slots the beacon server has available")
+			} else {
+				log.WithField("slots", slots).Info("Loaded the slots available in the beacon server")
+			}
+		}
+		go bc.pollBeaconServerAvailability(ctx)
+	})
+}
+
+// Periodically query the beacon server until it has backfilled every slot we need. A server whose slots
+// have not been loaded yet is queried until they are.
+func (bc *BeaconClient) pollBeaconServerAvailability(ctx context.Context) {
+	for {
+		if _, known := bc.BeaconServerAvailability.Slots(); known && bc.BeaconServerAvailability.IsComplete(bc.PerformBeaconBlockProcessing, bc.PerformBeaconStateProcessing) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bcAvailabilityPollInterval):
+			log.Debug("Checking to see if the beacon server has finished backfilling")
+			slots, err := bc.UpdateBeaconServerAvailability()
+			if err != nil {
+				loghelper.LogError(err).Warn("Unable to check which slots the beacon server has available")
+				continue
+			}
+			log.WithField("slots", slots).Info("Updated the slots available in the beacon server")
+		}
+	}
+	log.Info("The beacon server has all the slots we need, we will no longer defer slots.")
+}
+
+// Query the head slot of the beacon server and use it as the latest slot available for processing.
+func (bc *BeaconClient) refreshLatestSlotInBeaconServer() {
+	headSlot, err := bc.queryHeadSlotInBeaconServer()
+	if err != nil {
+		loghelper.LogError(err).Warn("Unable to update the latest slot in the beacon server")
+		return
+	}
+	bc.UpdateLatestSlotInBeaconServer(int64(headSlot))
+}
+
+// Periodically refresh the latest slot in the beacon server. Slots beyond it are deferred until the
+// beacon server reaches them. The finalized epoch is refreshed alongside it.
+func (bc *BeaconClient) trackLatestSlotInBeaconServer(ctx context.Context) {
+	ticker := time.NewTicker(bcLatestSlotPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bc.refreshLatestSlotInBeaconServer()
+			bc.refreshFinalizedEpoch()
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	beaconclient "github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Checkbeaconserverstatus", Label("unit"), func() {
+	var (
+		protocol string = "http"
+		address  string = "localhost"
+		port     int    = 8080
+		bc       *beaconclient.BeaconClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		bc, err = beaconclient.CreateBeaconClient(context.Background(), protocol, address, port, 10, bcUniqueIdentifier, false, true, true)
+		Expect(err).ToNot(HaveOccurred())
+		httpmock.Activate()
+	})
+	AfterEach(func() {
+		httpmock.DeactivateAndReset()
+	})
+
+	Describe("Finding the slots available in a lighthouse server", func() {
+		Context("When the anchor is null", func() {
+			It("Should return the head slot", func() {
+				mockServer := MockServerStatus{Protocol: protocol, Address: address, Port: port, HeadSlot: 1000}
+				mockServer.registerHeadSync()
+				mockServer.registerLighthouseDbInfo(`null`)
+
+				latestSlot, err := bc.GetLatestSlotInBeaconServer("lighthouse")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(latestSlot).To(Equal(1000))
+			})
+		})
+		Context("When the anchor is not null", func() {
+			It("Should report the missing slots", func() {
+				mockServer := MockServerStatus{Protocol: protocol, Address: address, Port: port, HeadSlot: 1000}
+				mockServer.registerHeadSync()
+				mockServer.registerLighthouseDbInfo(`{"anchor_slot":"800","oldest_block_slot":"600","oldest_block_parent":"0x00","state_upper_limit":"640","state_lower_limit":"0"}`)
+
+				_, err := bc.GetLatestSlotInBeaconServer("lighthouse")
+				Expect(err).To(Equal(beaconclient.LighthouseMissingSlots))
+
+				slots, err := bc.GetSlotsInBeaconServer("lighthouse")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(slots).To(Equal(beaconclient.BeaconServerSlots{HeadSlot: 1000, OldestBlockSlot: 600, StateLowerLimit: 0, StateUpperLimit: 640}))
+				Expect(slots.IsBlockAvailable(599)).To(BeFalse())
+				Expect(slots.IsBlockAvailable(600)).To(BeTrue())
+				Expect(slots.IsStateAvailable(0)).To(BeTrue())
+				Expect(slots.IsStateAvailable(639)).To(BeFalse())
+				Expect(slots.IsStateAvailable(640)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("Finding the slots available in a server using the standard beacon API", func() {
+		Context("When the server has all the slots", func() {
+			It("Should return the head slot for every client", func() {
+				mockServer := MockServerStatus{Protocol: protocol, Address: address, Port: port, HeadSlot: 1000}
+				mockServer.registerHeadSync()
+				mockServer.registerStandardEndpoints()
+
+				for _, serverType := range []string{"prysm", "teku", "nimbus", "lodestar"} {
+					latestSlot, err := bc.GetLatestSlotInBeaconServer(serverType)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(latestSlot).To(Equal(1000))
+				}
+			})
+		})
+		Context("When the server is still backfilling", func() {
+			It("Should find the oldest block and state, accounting for skipped slots", func() {
+				mockServer := MockServerStatus{Protocol: protocol, Address: address, Port: port, HeadSlot: 1000, OldestBlockSlot: 600, OldestStateSlot: 640}
+				mockServer.registerHeadSync()
+				mockServer.registerStandardEndpoints()
+
+				_, err := bc.GetLatestSlotInBeaconServer("prysm")
+				Expect(err).To(Equal(beaconclient.BeaconServerMissingSlots))
+
+				slots, err := bc.GetSlotsInBeaconServer("teku")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(slots).To(Equal(beaconclient.BeaconServerSlots{HeadSlot: 1000, OldestBlockSlot: 600, StateLowerLimit: 0, StateUpperLimit: 640}))
+			})
+		})
+	})
+
+	Describe("Waiting for a lighthouse server to backfill", func() {
+		It("Should only treat backfilled slots as available", func() {
+			bc.BeaconServerType = "lighthouse"
+			Expect(bc.BeaconServerAvailability.IsBackfilled(0, true, true)).To(BeTrue())
+
+			mockServer := MockServerStatus{Protocol: protocol, Address: address, Port: port, HeadSlot: 1000}
+			mockServer.registerHeadSync()
+			mockServer.registerLighthouseDbInfo(`{"anchor_slot":"800","oldest_block_slot":"600","oldest_block_parent":"0x00","state_upper_limit":"640","state_lower_limit":"0"}`)
+			_, err := bc.UpdateBeaconServerAvailability()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(bc.BeaconServerAvailability.IsComplete(true, true)).To(BeFalse())
+			Expect(bc.BeaconServerAvailability.IsComplete(false, false)).To(BeTrue())
+			Expect(bc.BeaconServerAvailability.IsBackfilled(599, true, false)).To(BeFalse())
+			Expect(bc.BeaconServerAvailability.IsBackfilled(620, true, false)).To(BeTrue())
+			Expect(bc.BeaconServerAvailability.IsBackfilled(620, true, true)).To(BeFalse())
+			Expect(bc.BeaconServerAvailability.IsBackfilled(0, false, true)).To(BeTrue())
+			Expect(bc.BeaconServerAvailability.IsBackfilled(640, true, true)).To(BeTrue())
+
+			mockServer.registerLighthouseDbInfo(`null`)
+			_, err = bc.UpdateBeaconServerAvailability()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bc.BeaconServerAvailability.IsComplete(true, true)).To(BeTrue())
+			Expect(bc.BeaconServerAvailability.IsBackfilled(1, true, true)).To(BeTrue())
+		})
+	})
+
+	Describe("Updating the latest slot in the beacon server", func() {
+		It("Should store the new latest slot", func() {
+			bc.UpdateLatestSlotInBeaconServer(1000)
+			Expect(atomic.LoadInt64(&bc.LatestSlotInBeaconServer)).To(Equal(int64(1000)))
+			bc.UpdateLatestSlotInBeaconServer(1032)
+			Expect(atomic.LoadInt64(&bc.LatestSlotInBeaconServer)).To(Equal(int64(1032)))
+		})
+	})
+
+	Describe("Using an unknown beacon server type", func() {
+		It("Should return an error", func() {
+			_, err := bc.GetLatestSlotInBeaconServer("unknown")
+			Expect(err).To(Equal(beaconclient.MissingBeaconServerType))
+		})
+	})
+})
+
+// A mock beacon server used to test which slots are available. Every slot divisible
+// by 7 is treated as a skipped slot.
+type MockServerStatus struct {
+	Protocol        string
+	Address         string
+	Port            int
+	HeadSlot        int
+	OldestBlockSlot int // The server does not have any blocks prior to this slot.
+	OldestStateSlot int // The server does not have any states prior to this slot, except for Genesis.
+}
+
+func (ms MockServerStatus) url(endpoint string) string {
+	return ms.Protocol + "://" + ms.Address + ":" + strconv.Itoa(ms.Port) + endpoint
+}
+
+// Every block root is derived from its slot.
+func mockBlockRoot(slot int) string {
+	return fmt.Sprintf("0x%064x", slot)
+}
+
+func isSkippedSlot(slot int) bool {
+	return slot != 0 && slot%7 == 0
+}
+
+func (ms MockServerStatus) registerHeadSync() {
+	httpmock.RegisterResponder("GET", ms.url(beaconclient.BcSyncStatusEndpoint),
+		httpmock.NewStringResponder(200, fmt.Sprintf(`{"data":{"is_syncing":false,"head_slot":"%d","sync_distance":"0"}}`, ms.HeadSlot)))
+}
+
+func (ms MockServerStatus) registerLighthouseDbInfo(anchor string) {
+	httpmock.RegisterResponder("GET", ms.url(beaconclient.LhDbInfoEndpoint),
+		httpmock.NewStringResponder(200, `{"schema_version":9,"split":{"slot":"0","state_root":"0x00"},"anchor":`+anchor+`}`))
+}
+
+func (ms MockServerStatus) registerStandardEndpoints() {
+	httpmock.RegisterResponder("GET", `=~^`+ms.url("/eth/v1/beacon/headers/")+`([^/]+)\z`,
+		func(req *http.Request) (*http.Response, error) {
+			id := httpmock.MustGetSubmatch(req, 1)
+			var slot int
+			if strings.HasPrefix(id, "0x") {
+				parsed, err := strconv.ParseInt(strings.TrimPrefix(id, "0x"), 16, 64)
+				if err != nil {
+					return httpmock.NewStringResponse(400, "Invalid block id"), nil
+				}
+				slot = int(parsed)
+			} else {
+				parsed, err := strconv.Atoi(id)
+				if err != nil {
+					return httpmock.NewStringResponse(400, "Invalid block id"), nil
+				}
+				if isSkippedSlot(parsed) {
+					return httpmock.NewStringResponse(404, "Block not found"), nil
+				}
+				slot = parsed
+			}
+			if slot < ms.OldestBlockSlot || slot > ms.HeadSlot {
+				return httpmock.NewStringResponse(404, "Block not found"), nil
+			}
+			parent := slot - 1
+			for parent > 0 && isSkippedSlot(parent) {
+				parent--
+			}
+			return httpmock.NewStringResponse(200, fmt.Sprintf(`{"data":{"root":"%s","canonical":true,"header":{"message":{"slot":"%d","parent_root":"%s"}}}}`,
+				mockBlockRoot(slot), slot, mockBlockRoot(parent))), nil
+		},
+	)
+	httpmock.RegisterResponder("GET", `=~^`+ms.url("/eth/v1/beacon/states/")+`([^/]+)/root\z`,
+		func(req *http.Request) (*http.Response, error) {
+			slot, err := strconv.Atoi(httpmock.MustGetSubmatch(req, 1))
+			if err != nil {
+				return httpmock.NewStringResponse(400, "Invalid state id"), nil
+			}
+			if (slot != 0 && slot < ms.OldestStateSlot) || slot > ms.HeadSlot {
+				return httpmock.NewStringResponse(404, "State not found"), nil
+			}
+			return httpmock.NewStringResponse(200, fmt.Sprintf(`{"data":{"root":"%s"}}`, mockBlockRoot(slot))), nil
+		},
+	)
+}
@@ -0,0 +1,71 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the leases that protect the rows checked out from
+// eth_beacon.historic_process and eth_beacon.known_gaps.
+
+package beaconclient
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Used to renew the lease on every row this node has checked out.
+	heartbeatHpLeaseStmt string = `UPDATE eth_beacon.historic_process
+	SET checked_out_at=now()
+	WHERE checked_out=true AND checked_out_by=$1`
+	heartbeatKgLeaseStmt string = `UPDATE eth_beacon.known_gaps
+	SET checked_out_at=now()
+	WHERE checked_out=true AND checked_out_by=$1`
+)
+
+// The lease duration to use for checked out rows. Invalid durations fall back to the default.
+func (bc *BeaconClient) checkoutLeaseDuration() time.Duration {
+	if bc.CheckoutLeaseDuration <= 0 {
+		return bcDefaultCheckoutLease
+	}
+	return bc.CheckoutLeaseDuration
+}
+
+// Renew the lease on every row this node has checked out until the context is cancelled. The lease
+// is renewed three times per lease duration, so a single missed heartbeat does not lose the rows.
+func maintainCheckoutLease(ctx context.Context, db sql.Database, heartbeatStmt string, uniqueNodeIdentifier int, leaseDuration time.Duration) {
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			res, err := db.Exec(context.Background(), heartbeatStmt, uniqueNodeIdentifier)
+			if err != nil {
+				loghelper.LogError(err).WithField("uniqueNodeIdentifier", uniqueNodeIdentifier).Warn("Unable to renew the lease on our checked out rows")
+				continue
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				loghelper.LogError(err).Warn("Unable to determine the number of leases renewed")
+				continue
+			}
+			log.WithField("rowCount", rows).Debug("Renewed the lease on our checked out rows")
+		}
+	}
+}
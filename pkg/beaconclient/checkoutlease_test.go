@@ -0,0 +1,44 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Checkoutlease", Label("unit", "behavioral", "lease"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpMockedTest()
+	})
+
+	Context("When the lease of another node has expired", func() {
+		It("Should reclaim the row and process it", func() {
+			BeaconNodeTester.writeEventToHistoricProcess(bc, 100, 101, 10)
+			_, err := bc.Db.Exec(context.Background(), `UPDATE eth_beacon.historic_process
+			SET checked_out=true, checked_out_by=5, checked_out_at=now() - interval '1 hour'`)
+			Expect(err).ToNot(HaveOccurred())
+
+			BeaconNodeTester.runHistoricalProcess(bc, 2, 2, 0, 0, 0)
+			Expect(atomic.LoadUint64(&bc.Metrics.LeasesReclaimed)).To(Equal(uint64(1)))
+		})
+	})
+})
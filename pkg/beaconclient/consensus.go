@@ -3,6 +3,7 @@ package beaconclient
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"github.com/protolambda/zrnt/eth2/beacon/altair"
 	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
@@ -10,7 +11,9 @@ import (
 	"github.com/protolambda/zrnt/eth2/configs"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
 	log "github.com/sirupsen/logrus"
+	"math/bits"
 	"strconv"
 )
 
@@ -21,6 +24,15 @@ type Slot uint64
 type Epoch uint64
 type ExecutionPayloadHeader common.ExecutionPayloadHeader
 
+// The number of operations of each kind included in a BeaconBlockBody.
+type OperationCounts struct {
+	ProposerSlashings int
+	AttesterSlashings int
+	Attestations      int
+	Deposits          int
+	VoluntaryExits    int
+}
+
 func ParseSlot(v string) (Slot, error) {
 	slotNum, err := strconv.ParseUint(v, 10, 64)
 	return Slot(slotNum), err
@@ -115,6 +127,39 @@ func (s *SignedBeaconBlock) UnmarshalSSZ(ssz []byte) error {
 	return err
 }
 
+// Unmarshal a SignedBeaconBlock of a known fork with the given spec, instead of trying each fork in turn.
+func (s *SignedBeaconBlock) UnmarshalSSZForFork(spec *common.Spec, fork string, ssz []byte) error {
+	s.spec = spec
+	s.bellatrix = nil
+	s.altair = nil
+	s.phase0 = nil
+	spec = chooseSpec(spec)
+
+	switch fork {
+	case "bellatrix":
+		var bellatrix bellatrix.SignedBeaconBlock
+		if err := bellatrix.Deserialize(spec, makeDecodingReader(ssz)); err != nil {
+			return err
+		}
+		s.bellatrix = &bellatrix
+	case "altair":
+		var altair altair.SignedBeaconBlock
+		if err := altair.Deserialize(spec, makeDecodingReader(ssz)); err != nil {
+			return err
+		}
+		s.altair = &altair
+	case "phase0":
+		var phase0 phase0.SignedBeaconBlock
+		if err := phase0.Deserialize(spec, makeDecodingReader(ssz)); err != nil {
+			return err
+		}
+		s.phase0 = &phase0
+	default:
+		return fmt.Errorf("Unknown fork: %s", fork)
+	}
+	return nil
+}
+
 func (s *SignedBeaconBlock) MarshalSSZ() ([]byte, error) {
 	spec := chooseSpec(s.spec)
 	var err error
@@ -178,6 +223,37 @@ func (s *SignedBeaconBlock) Signature() Signature {
 	return Signature{}
 }
 
+// The name of the fork the block belongs to, as used by the beacon API.
+func (s *SignedBeaconBlock) Version() string {
+	if s.IsBellatrix() {
+		return "bellatrix"
+	}
+
+	if s.IsAltair() {
+		return "altair"
+	}
+
+	return "phase0"
+}
+
+func (s *SignedBeaconBlock) SignedHeader() *common.SignedBeaconBlockHeader {
+	spec := chooseSpec(s.spec)
+
+	if s.IsBellatrix() {
+		return s.bellatrix.SignedHeader(spec)
+	}
+
+	if s.IsAltair() {
+		return s.altair.SignedHeader(spec)
+	}
+
+	if s.IsPhase0() {
+		return s.phase0.SignedHeader(spec)
+	}
+
+	return nil
+}
+
 func (s *SignedBeaconBlock) Block() *BeaconBlock {
 	if s.IsBellatrix() {
 		return &BeaconBlock{bellatrix: &s.bellatrix.Message, spec: s.spec}
@@ -250,6 +326,38 @@ func (b *BeaconBlock) StateRoot() Root {
 	return Root{}
 }
 
+func (b *BeaconBlock) Slot() Slot {
+	if b.IsBellatrix() {
+		return Slot(b.bellatrix.Slot)
+	}
+
+	if b.IsAltair() {
+		return Slot(b.altair.Slot)
+	}
+
+	if b.IsPhase0() {
+		return Slot(b.phase0.Slot)
+	}
+
+	return 0
+}
+
+func (b *BeaconBlock) ProposerIndex() uint64 {
+	if b.IsBellatrix() {
+		return uint64(b.bellatrix.ProposerIndex)
+	}
+
+	if b.IsAltair() {
+		return uint64(b.altair.ProposerIndex)
+	}
+
+	if b.IsPhase0() {
+		return uint64(b.phase0.ProposerIndex)
+	}
+
+	return 0
+}
+
 func (b *BeaconBlock) Body() *BeaconBlockBody {
 	if b.IsBellatrix() {
 		return &BeaconBlockBody{bellatrix: &b.bellatrix.Body, spec: b.spec}
@@ -294,6 +402,68 @@ func (b *BeaconBlockBody) Eth1Data() Eth1Data {
 	return Eth1Data{}
 }
 
+func (b *BeaconBlockBody) Graffiti() Root {
+	if b.IsBellatrix() {
+		return Root(b.bellatrix.Graffiti)
+	}
+
+	if b.IsAltair() {
+		return Root(b.altair.Graffiti)
+	}
+
+	if b.IsPhase0() {
+		return Root(b.phase0.Graffiti)
+	}
+
+	return Root{}
+}
+
+func (b *BeaconBlockBody) OperationCounts() OperationCounts {
+	if b.IsBellatrix() {
+		return OperationCounts{len(b.bellatrix.ProposerSlashings), len(b.bellatrix.AttesterSlashings),
+			len(b.bellatrix.Attestations), len(b.bellatrix.Deposits), len(b.bellatrix.VoluntaryExits)}
+	}
+
+	if b.IsAltair() {
+		return OperationCounts{len(b.altair.ProposerSlashings), len(b.altair.AttesterSlashings),
+			len(b.altair.Attestations), len(b.altair.Deposits), len(b.altair.VoluntaryExits)}
+	}
+
+	if b.IsPhase0() {
+		return OperationCounts{len(b.phase0.ProposerSlashings), len(b.phase0.AttesterSlashings),
+			len(b.phase0.Attestations), len(b.phase0.Deposits), len(b.phase0.VoluntaryExits)}
+	}
+
+	return OperationCounts{}
+}
+
+// The number of sync committee members that signed the block, false before Altair.
+func (b *BeaconBlockBody) SyncCommitteeParticipants() (int, bool) {
+	var syncBits []byte
+	if b.IsBellatrix() {
+		syncBits = b.bellatrix.SyncAggregate.SyncCommitteeBits
+	} else if b.IsAltair() {
+		syncBits = b.altair.SyncAggregate.SyncCommitteeBits
+	} else {
+		return 0, false
+	}
+
+	participants := 0
+	for _, bt := range syncBits {
+		participants += bits.OnesCount8(bt)
+	}
+	return participants, true
+}
+
+// The number of transactions in the ExecutionPayload, false before Bellatrix.
+func (b *BeaconBlockBody) ExecutionTransactionCount() (int, bool) {
+	if b.IsBellatrix() {
+		return len(b.bellatrix.ExecutionPayload.Transactions), true
+	}
+
+	return 0, false
+}
+
 func (b *BeaconBlockBody) ExecutionPayloadHeader() *ExecutionPayloadHeader {
 	if b.IsBellatrix() {
 		payloadHeader := b.bellatrix.ExecutionPayload.Header(chooseSpec(b.spec))
@@ -322,6 +492,35 @@ func (b *BeaconBlock) HashTreeRoot() Root {
 	return Root{}
 }
 
+// The backing tree of the block, along with its type, from which Merkle proofs against the block root are built.
+func (b *BeaconBlock) Tree() (tree.Node, *view.ContainerTypeDef, error) {
+	spec := chooseSpec(b.spec)
+	var typ *view.ContainerTypeDef
+	var obj interface {
+		Serialize(*common.Spec, *codec.EncodingWriter) error
+	}
+
+	if b.IsBellatrix() {
+		typ, obj = bellatrix.BeaconBlockType(spec), b.bellatrix
+	} else if b.IsAltair() {
+		typ, obj = altair.BeaconBlockType(spec), b.altair
+	} else if b.IsPhase0() {
+		typ, obj = phase0.BeaconBlockType(spec), b.phase0
+	} else {
+		return nil, nil, errors.New("BeaconBlock not set")
+	}
+
+	var buf bytes.Buffer
+	if err := obj.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, nil, err
+	}
+	v, err := typ.Deserialize(makeDecodingReader(buf.Bytes()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return v.Backing(), typ, nil
+}
+
 func (s *BeaconState) UnmarshalSSZ(ssz []byte) error {
 	spec := chooseSpec(s.spec)
 
@@ -363,6 +562,39 @@ func (s *BeaconState) UnmarshalSSZ(ssz []byte) error {
 	return err
 }
 
+// Unmarshal a BeaconState of a known fork with the given spec, instead of trying each fork in turn.
+func (s *BeaconState) UnmarshalSSZForFork(spec *common.Spec, fork string, ssz []byte) error {
+	s.spec = spec
+	s.bellatrix = nil
+	s.altair = nil
+	s.phase0 = nil
+	spec = chooseSpec(spec)
+
+	switch fork {
+	case "bellatrix":
+		var bellatrix bellatrix.BeaconState
+		if err := bellatrix.Deserialize(spec, makeDecodingReader(ssz)); err != nil {
+			return err
+		}
+		s.bellatrix = &bellatrix
+	case "altair":
+		var altair altair.BeaconState
+		if err := altair.Deserialize(spec, makeDecodingReader(ssz)); err != nil {
+			return err
+		}
+		s.altair = &altair
+	case "phase0":
+		var phase0 phase0.BeaconState
+		if err := phase0.Deserialize(spec, makeDecodingReader(ssz)); err != nil {
+			return err
+		}
+		s.phase0 = &phase0
+	default:
+		return fmt.Errorf("Unknown fork: %s", fork)
+	}
+	return nil
+}
+
 func (s *BeaconState) MarshalSSZ() ([]byte, error) {
 	spec := chooseSpec(s.spec)
 	var err error
@@ -398,6 +630,100 @@ func (s *BeaconState) IsPhase0() bool {
 	return s.phase0 != nil
 }
 
+// The name of the fork the state belongs to, as used by the beacon API.
+func (s *BeaconState) Version() string {
+	if s.IsBellatrix() {
+		return "bellatrix"
+	}
+
+	if s.IsAltair() {
+		return "altair"
+	}
+
+	return "phase0"
+}
+
+func (s *BeaconState) Slot() Slot {
+	if s.IsBellatrix() {
+		return Slot(s.bellatrix.Slot)
+	}
+
+	if s.IsAltair() {
+		return Slot(s.altair.Slot)
+	}
+
+	if s.IsPhase0() {
+		return Slot(s.phase0.Slot)
+	}
+
+	return 0
+}
+
+func (s *BeaconState) GenesisValidatorsRoot() Root {
+	if s.IsBellatrix() {
+		return Root(s.bellatrix.GenesisValidatorsRoot)
+	}
+
+	if s.IsAltair() {
+		return Root(s.altair.GenesisValidatorsRoot)
+	}
+
+	if s.IsPhase0() {
+		return Root(s.phase0.GenesisValidatorsRoot)
+	}
+
+	return Root{}
+}
+
+func (s *BeaconState) HistoricalRoots() []Root {
+	var roots []common.Root
+	if s.IsBellatrix() {
+		roots = s.bellatrix.HistoricalRoots
+	} else if s.IsAltair() {
+		roots = s.altair.HistoricalRoots
+	} else if s.IsPhase0() {
+		roots = s.phase0.HistoricalRoots
+	}
+
+	result := make([]Root, len(roots))
+	for i, root := range roots {
+		result[i] = Root(root)
+	}
+	return result
+}
+
+func (s *BeaconState) ValidatorCount() int {
+	if s.IsBellatrix() {
+		return len(s.bellatrix.Validators)
+	}
+
+	if s.IsAltair() {
+		return len(s.altair.Validators)
+	}
+
+	if s.IsPhase0() {
+		return len(s.phase0.Validators)
+	}
+
+	return 0
+}
+
+func (s *BeaconState) FinalizedCheckpoint() (Epoch, Root) {
+	if s.IsBellatrix() {
+		return Epoch(s.bellatrix.FinalizedCheckpoint.Epoch), Root(s.bellatrix.FinalizedCheckpoint.Root)
+	}
+
+	if s.IsAltair() {
+		return Epoch(s.altair.FinalizedCheckpoint.Epoch), Root(s.altair.FinalizedCheckpoint.Root)
+	}
+
+	if s.IsPhase0() {
+		return Epoch(s.phase0.FinalizedCheckpoint.Epoch), Root(s.phase0.FinalizedCheckpoint.Root)
+	}
+
+	return 0, Root{}
+}
+
 func (s *BeaconState) HashTreeRoot() Root {
 	spec := chooseSpec(s.spec)
 	hashFn := tree.GetHashFn()
@@ -417,6 +743,49 @@ func (s *BeaconState) HashTreeRoot() Root {
 	return Root{}
 }
 
+// The root of the latest block applied to the state. Once the state is advanced past the block's slot, it is the
+// root of that block.
+func (s *BeaconState) LatestBlockRoot() Root {
+	hashFn := tree.GetHashFn()
+
+	if s.IsBellatrix() {
+		return Root(s.bellatrix.LatestBlockHeader.HashTreeRoot(hashFn))
+	}
+
+	if s.IsAltair() {
+		return Root(s.altair.LatestBlockHeader.HashTreeRoot(hashFn))
+	}
+
+	if s.IsPhase0() {
+		return Root(s.phase0.LatestBlockHeader.HashTreeRoot(hashFn))
+	}
+
+	return Root{}
+}
+
+// The backing tree of the state, along with its type, from which Merkle proofs against the state root are built.
+func (s *BeaconState) Tree() (tree.Node, *view.ContainerTypeDef, error) {
+	spec := chooseSpec(s.spec)
+	var typ *view.ContainerTypeDef
+	if s.IsBellatrix() {
+		typ = bellatrix.BeaconStateType(spec)
+	} else if s.IsAltair() {
+		typ = altair.BeaconStateType(spec)
+	} else {
+		typ = phase0.BeaconStateType(spec)
+	}
+
+	ssz, err := s.MarshalSSZ()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := typ.Deserialize(makeDecodingReader(ssz))
+	if err != nil {
+		return nil, nil, err
+	}
+	return v.Backing(), typ, nil
+}
+
 func (s *BeaconState) GetBellatrix() *bellatrix.BeaconState {
 	return s.bellatrix
 }
@@ -429,6 +798,48 @@ func (s *BeaconState) GetPhase0() *phase0.BeaconState {
 	return s.phase0
 }
 
+// The spec used for objects that do not set one, every object in the DB was written with it.
+func DefaultSpec() *common.Spec {
+	return chooseSpec(nil)
+}
+
+// The name of the fork active at a slot, as returned by Version.
+func ForkAtSlot(spec *common.Spec, slot Slot) string {
+	spec = chooseSpec(spec)
+	epoch := spec.SlotToEpoch(common.Slot(slot))
+	if epoch >= spec.BELLATRIX_FORK_EPOCH {
+		return "bellatrix"
+	}
+	if epoch >= spec.ALTAIR_FORK_EPOCH {
+		return "altair"
+	}
+	return "phase0"
+}
+
+// The offset of fork.current_version in a SSZ encoded BeaconState, after genesis_time, genesis_validators_root, slot
+// and fork.previous_version. It is the same for every fork.
+const beaconStateCurrentVersionOffset = 8 + 32 + 8 + 4
+
+// The name of the fork a SSZ encoded BeaconState belongs to, read from its fork.current_version so the state does not
+// need to be decoded. false is returned when the version is not one of the forks of the spec.
+func beaconStateFork(spec *common.Spec, ssz []byte) (string, bool) {
+	if len(ssz) < beaconStateCurrentVersionOffset+4 {
+		return "", false
+	}
+	spec = chooseSpec(spec)
+	var version common.Version
+	copy(version[:], ssz[beaconStateCurrentVersionOffset:])
+	switch version {
+	case spec.BELLATRIX_FORK_VERSION:
+		return "bellatrix", true
+	case spec.ALTAIR_FORK_VERSION:
+		return "altair", true
+	case spec.GENESIS_FORK_VERSION:
+		return "phase0", true
+	}
+	return "", false
+}
+
 func chooseSpec(spec *common.Spec) *common.Spec {
 	if nil == spec {
 		return configs.Mainnet
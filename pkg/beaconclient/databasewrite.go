@@ -67,18 +67,10 @@ VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`
 	CheckBeaconStateStmt string = `SELECT slot, state_root
 	FROM eth_beacon.state
 	WHERE slot=$1 AND state_root=$2`
-	// Used to get a single slot from the table if it exists
-	QueryBySlotStmt string = `SELECT slot
-	FROM eth_beacon.slots
-	WHERE slot=$1`
 	// Statement to insert known_gaps. We don't pass in timestamp, we let the server take care of that one.
 	UpsertKnownGapsStmt string = `
 INSERT INTO eth_beacon.known_gaps (start_slot, end_slot, checked_out, reprocessing_error, entry_error, entry_process)
 VALUES ($1, $2, $3, $4, $5, $6) on CONFLICT (start_slot, end_slot) DO NOTHING`
-	UpsertKnownGapsErrorStmt string = `
-	UPDATE eth_beacon.known_gaps
-	SET reprocessing_error=$3, priority=priority+1
-	WHERE start_slot=$1 AND end_slot=$2;`
 	// Get the highest slot if one exists
 	QueryHighestSlotStmt string = "SELECT COALESCE(MAX(slot), 0) FROM eth_beacon.slots"
 )
@@ -100,21 +92,31 @@ type DatabaseWriter struct {
 
 func CreateDatabaseWrite(db sql.Database, slot Slot, stateRoot string, blockRoot string, parentBlockRoot string,
 	eth1DataBlockHash string, payloadHeader *ExecutionPayloadHeader, status string, rawSignedBeaconBlock *[]byte, rawBeaconState *[]byte, metrics *BeaconClientMetrics) (*DatabaseWriter, error) {
-	ctx := context.Background()
-	tx, err := db.Begin(ctx)
+	dw, err := createDatabaseWriteModels(db, slot, stateRoot, blockRoot, parentBlockRoot, eth1DataBlockHash, payloadHeader,
+		status, rawSignedBeaconBlock, rawBeaconState, metrics)
+	if err != nil {
+		return nil, err
+	}
+	dw.Tx, err = db.Begin(dw.Ctx)
 	if err != nil {
 		loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
 	}
+	return dw, err
+}
+
+// Prepare the models for a slot without starting a transaction. The models can be written
+// on their own, or together with other slots using the BatchDatabaseWriter.
+func createDatabaseWriteModels(db sql.Database, slot Slot, stateRoot string, blockRoot string, parentBlockRoot string,
+	eth1DataBlockHash string, payloadHeader *ExecutionPayloadHeader, status string, rawSignedBeaconBlock *[]byte, rawBeaconState *[]byte, metrics *BeaconClientMetrics) (*DatabaseWriter, error) {
 	dw := &DatabaseWriter{
 		Db:                   db,
-		Tx:                   tx,
-		Ctx:                  ctx,
+		Ctx:                  context.Background(),
 		rawBeaconState:       rawBeaconState,
 		rawSignedBeaconBlock: rawSignedBeaconBlock,
 		Metrics:              metrics,
 	}
 	dw.prepareSlotsModel(slot, stateRoot, blockRoot, status)
-	err = dw.prepareSignedBeaconBlockModel(slot, blockRoot, parentBlockRoot, eth1DataBlockHash, payloadHeader)
+	err := dw.prepareSignedBeaconBlockModel(slot, blockRoot, parentBlockRoot, eth1DataBlockHash, payloadHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +124,7 @@ func CreateDatabaseWrite(db sql.Database, slot Slot, stateRoot string, blockRoot
 	if err != nil {
 		return nil, err
 	}
-	return dw, err
+	return dw, nil
 }
 
 // Write functions to write each all together...
@@ -342,6 +344,13 @@ func (dw *DatabaseWriter) upsertBeaconState() error {
 // Update a given slot to be marked as forked within a transaction. Provide the slot and the latest latestBlockRoot.
 // We will mark all entries for the given slot that don't match the provided latestBlockRoot as forked.
 func transactReorgs(tx sql.Tx, ctx context.Context, slot Slot, latestBlockRoot string, metrics *BeaconClientMetrics) {
+	transactReorgSlot(tx, ctx, slot, latestBlockRoot, metrics)
+	metrics.IncrementReorgsInsert(1)
+}
+
+// Mark the rows for a single slot as forked or proposed, without counting it as a reorg. This allows a reorg
+// that spans several slots to be counted once.
+func transactReorgSlot(tx sql.Tx, ctx context.Context, slot Slot, latestBlockRoot string, metrics *BeaconClientMetrics) {
 	forkCount, err := updateForked(tx, ctx, slot, latestBlockRoot)
 	if err != nil {
 		loghelper.LogReorgError(slot.Number(), latestBlockRoot, err).Error("We ran into some trouble while updating all forks.")
@@ -376,8 +385,6 @@ func transactReorgs(tx sql.Tx, ctx context.Context, slot Slot, latestBlockRoot s
 		transactKnownGaps(tx, ctx, 1, slot, slot, fmt.Errorf("Unable to find properly proposed row in DB"), "reorg", metrics)
 		loghelper.LogReorg(slot.Number(), latestBlockRoot).Info("Updated the row that should have been marked as proposed.")
 	}
-
-	metrics.IncrementReorgsInsert(1)
 }
 
 // Wrapper function that will create a transaction and execute the function.
@@ -431,8 +438,7 @@ func updateProposed(tx sql.Tx, ctx context.Context, slot Slot, latestBlockRoot s
 }
 
 // A wrapper function to call upsertKnownGaps. This function will break down the range of known_gaps into
-// smaller chunks. For example, instead of having an entry of 1-101, if we increment the entries by 10 slots, we would
-// have 10 entries as follows: 1-10, 11-20, etc...
+// smaller chunks using chunkSlotRange.
 func transactKnownGaps(tx sql.Tx, ctx context.Context, tableIncrement int, startSlot Slot, endSlot Slot, entryError error, entryProcess string, metric *BeaconClientMetrics) {
 	var entryErrorMsg string
 	if entryError == nil {
@@ -440,43 +446,44 @@ func transactKnownGaps(tx sql.Tx, ctx context.Context, tableIncrement int, start
 	} else {
 		entryErrorMsg = entryError.Error()
 	}
-	if endSlot.Number()-startSlot.Number() <= uint64(tableIncrement) {
+	for _, chunk := range chunkSlotRange(startSlot, endSlot, tableIncrement) {
 		kgModel := DbKnownGaps{
-			StartSlot:         startSlot.Number(),
-			EndSlot:           endSlot.Number(),
+			StartSlot:         chunk.StartSlot.Number(),
+			EndSlot:           chunk.EndSlot.Number(),
 			CheckedOut:        false,
 			ReprocessingError: "",
 			EntryError:        entryErrorMsg,
 			EntryProcess:      entryProcess,
 		}
 		upsertKnownGaps(tx, ctx, kgModel, metric)
-	} else {
-		totalSlots := endSlot.Number() - startSlot.Number()
-		var chunks int
-		chunks = int(totalSlots / uint64(tableIncrement))
-		if totalSlots%uint64(tableIncrement) != 0 {
-			chunks = chunks + 1
-		}
+	}
+}
 
-		for i := 0; i < chunks; i++ {
-			var tempStart, tempEnd Slot
-			tempStart = startSlot.PlusInt(i * tableIncrement)
-			if i+1 == chunks {
-				tempEnd = endSlot
-			} else {
-				tempEnd = startSlot.PlusInt((i + 1) * tableIncrement)
-			}
-			kgModel := DbKnownGaps{
-				StartSlot:         tempStart.Number(),
-				EndSlot:           tempEnd.Number(),
-				CheckedOut:        false,
-				ReprocessingError: "",
-				EntryError:        entryErrorMsg,
-				EntryProcess:      entryProcess,
-			}
-			upsertKnownGaps(tx, ctx, kgModel, metric)
+// Break down a range of slots into smaller, non-overlapping chunks. For example, instead of having an entry of 1-100,
+// if we increment the entries by 10 slots, we would have 10 entries as follows: 1-10, 11-20, etc...
+func chunkSlotRange(startSlot Slot, endSlot Slot, tableIncrement int) []SlotRange {
+	if tableIncrement <= 0 || endSlot.Number()-startSlot.Number() < uint64(tableIncrement) {
+		return []SlotRange{{StartSlot: startSlot, EndSlot: endSlot}}
+	}
+	totalSlots := endSlot.Number() - startSlot.Number() + 1
+	var chunks int
+	chunks = int(totalSlots / uint64(tableIncrement))
+	if totalSlots%uint64(tableIncrement) != 0 {
+		chunks = chunks + 1
+	}
+
+	ranges := make([]SlotRange, 0, chunks)
+	for i := 0; i < chunks; i++ {
+		var tempStart, tempEnd Slot
+		tempStart = startSlot.PlusInt(i * tableIncrement)
+		if i+1 == chunks {
+			tempEnd = endSlot
+		} else {
+			tempEnd = tempStart.PlusInt(tableIncrement - 1)
 		}
+		ranges = append(ranges, SlotRange{StartSlot: tempStart, EndSlot: tempEnd})
 	}
+	return ranges
 }
 
 // Wrapper function, instead of adding the knownGaps entries to a transaction, it will
@@ -546,50 +553,11 @@ func writeStartUpGaps(db sql.Database, tableIncrement int, firstSlot Slot, metri
 	}
 }
 
-// A function to update a knownGap range with a reprocessing error.
-func updateKnownGapErrors(db sql.Database, startSlot Slot, endSlot Slot, reprocessingErr error, metric *BeaconClientMetrics) error {
-	res, err := db.Exec(context.Background(), UpsertKnownGapsErrorStmt, startSlot, endSlot, reprocessingErr.Error())
-	if err != nil {
-		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to update reprocessing_error")
-		return err
-	}
-	row, err := res.RowsAffected()
-	if err != nil {
-		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to count rows affected when trying to update reprocessing_error.")
-		return err
-	}
-	if row != 1 {
-		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).WithFields(log.Fields{
-			"rowCount": row,
-		}).Error("The rows affected by the upsert for reprocessing_error is not 1.")
-		metric.IncrementKnownGapsReprocessError(1)
-		return err
-	}
-	metric.IncrementKnownGapsReprocessError(1)
-	return nil
-}
-
 // A quick helper function to calculate the epoch.
 func calculateEpoch(slot Slot, slotPerEpoch uint64) uint64 {
 	return slot.Number() / slotPerEpoch
 }
 
-// A helper function to check to see if the slot is processed.
-func isSlotProcessed(db sql.Database, checkProcessStmt string, slot Slot) (bool, error) {
-	processRow, err := db.Exec(context.Background(), checkProcessStmt, slot)
-	if err != nil {
-		return false, err
-	}
-	row, err := processRow.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-	if row > 0 {
-		return true, nil
-	}
-	return false, nil
-}
-
 // Check to see if this slot is in the DB. Check eth_beacon.slots, eth_beacon.signed_block
 // and eth_beacon.state. If the slot exists, return true
 func IsSlotInDb(ctx context.Context, db sql.Database, slot Slot, blockRoot string, stateRoot string) (bool, error) {
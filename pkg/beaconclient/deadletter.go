@@ -0,0 +1,117 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions operators use to inspect and release the eth_beacon.known_gaps_dead_letter table.
+
+package beaconclient
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// The columns returned when listing dead letter entries.
+	listDeadLetterEntriesStmt string = `SELECT start_slot, end_slot, attempts, last_error, error_class, response_status,
+	entry_error, entry_process, dead_lettered_at
+	FROM eth_beacon.known_gaps_dead_letter`
+	// Move the selected entries back to eth_beacon.known_gaps, with their attempts reset. An entry that is already
+	// in eth_beacon.known_gaps is merged into the existing row, so every deleted entry is released.
+	releaseDeadLetterEntriesStmt string = `WITH released AS (
+		DELETE FROM eth_beacon.known_gaps_dead_letter%s
+		RETURNING start_slot, end_slot, last_error, entry_error, entry_process
+	)
+	INSERT INTO eth_beacon.known_gaps (start_slot, end_slot, checked_out, reprocessing_error, entry_error, entry_process, priority)
+	SELECT start_slot, end_slot, false, last_error, entry_error, entry_process, $1 FROM released
+	ON CONFLICT (start_slot, end_slot) DO UPDATE
+	SET reprocessing_error=EXCLUDED.reprocessing_error, priority=LEAST(eth_beacon.known_gaps.priority, EXCLUDED.priority),
+	attempts=0, next_attempt_at=null;`
+)
+
+// A single row within the eth_beacon.known_gaps_dead_letter table.
+type DeadLetterEntry struct {
+	StartSlot      uint64    // The start slot, inclusive.
+	EndSlot        uint64    // The end slot, inclusive.
+	Attempts       int       // The number of failed attempts to reprocess this entry.
+	LastError      *string   // The error from the last attempt to process this entry.
+	ErrorClass     *string   // The class of the last error, for example request, response or decode.
+	ResponseStatus *int      // The status of the last response from the beacon server, if there was one.
+	EntryError     *string   // The error that caused this entry to be added to known_gaps.
+	EntryProcess   *string   // The process that added this entry to known_gaps.
+	DeadLetteredAt time.Time // When this entry was moved to the dead letter table.
+}
+
+// Selects the dead letter entries to operate on. Empty fields are ignored.
+type DeadLetterFilter struct {
+	StartSlot  *uint64 // Only select entries starting at or after this slot.
+	EndSlot    *uint64 // Only select entries ending at or before this slot.
+	ErrorClass string  // Only select entries whose last error has this class.
+}
+
+// Build the WHERE clause for the filter. Placeholders are numbered after the args that are already in use.
+func (f DeadLetterFilter) whereClause(args []interface{}) (string, []interface{}) {
+	var conditions []string
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+	if f.StartSlot != nil {
+		add("start_slot >= $?", *f.StartSlot)
+	}
+	if f.EndSlot != nil {
+		add("end_slot <= $?", *f.EndSlot)
+	}
+	if f.ErrorClass != "" {
+		add("error_class = $?", f.ErrorClass)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List the dead letter entries selected by the filter.
+func ListDeadLetters(ctx context.Context, db sql.Database, filter DeadLetterFilter) ([]DeadLetterEntry, error) {
+	where, args := filter.whereClause(nil)
+	var entries []DeadLetterEntry
+	if err := db.Select(ctx, &entries, listDeadLetterEntriesStmt+where+" ORDER BY start_slot ASC", args...); err != nil {
+		loghelper.LogError(err).Error("Unable to list the eth_beacon.known_gaps_dead_letter entries")
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Move the selected dead letter entries back to eth_beacon.known_gaps with the given priority, so they are
+// processed again. This should be used once a fix for the cause of the failures has been deployed.
+func ReleaseDeadLetters(ctx context.Context, db sql.Database, filter DeadLetterFilter, priority int) (int64, error) {
+	where, args := filter.whereClause([]interface{}{priority})
+	res, err := db.Exec(ctx, strings.Replace(releaseDeadLetterEntriesStmt, "%s", where, 1), args...)
+	if err != nil {
+		loghelper.LogError(err).Error("Unable to release the eth_beacon.known_gaps_dead_letter entries")
+		return 0, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.WithField("entries", rows).Info("Released entries from the eth_beacon.known_gaps_dead_letter table")
+	return rows, nil
+}
@@ -0,0 +1,81 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Deadletter", Label("unit", "behavioral", "deadLetter"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpMockedTest()
+	})
+
+	Context("When a known gap exhausts its attempts", func() {
+		It("Should move it to the dead letter table, until it is released.", func() {
+			bc.KnownGapsRetryPolicy.MaxAttempts = 1
+			// We dont have an entry in the BeaconNodeTester for this slot
+			BeaconNodeTester.writeEventToHistoricProcess(bc, 105, 105, 10)
+			BeaconNodeTester.runHistoricalProcess(bc, 2, 0, 0, 1, 0)
+			BeaconNodeTester.runKnownGapsProcess(bc, 2, 0, 0, 1, 1)
+			Expect(atomic.LoadUint64(&bc.Metrics.KnownGapsDeadLettered)).To(Equal(uint64(1)))
+
+			deadLetters, err := beaconclient.ListDeadLetters(context.Background(), bc.Db, beaconclient.DeadLetterFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deadLetters).To(HaveLen(1))
+			Expect(deadLetters[0].StartSlot).To(Equal(uint64(105)))
+			Expect(deadLetters[0].Attempts).To(Equal(1))
+			Expect(*deadLetters[0].ErrorClass).To(Equal(beaconclient.ErrorClassRequest))
+
+			released, err := beaconclient.ReleaseDeadLetters(context.Background(), bc.Db, beaconclient.DeadLetterFilter{}, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(released).To(Equal(int64(1)))
+			entries, err := beaconclient.ListKnownGaps(context.Background(), bc.Db, beaconclient.KnownGapsFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Attempts).To(Equal(0))
+		})
+	})
+
+	Context("When a released entry is already in known_gaps", func() {
+		It("Should merge it into the existing row and count it.", func() {
+			_, err := bc.Db.Exec(context.Background(), `INSERT INTO eth_beacon.known_gaps_dead_letter (start_slot, end_slot, attempts, last_error)
+			VALUES (105, 105, 10, 'failed')`)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = bc.Db.Exec(context.Background(), `INSERT INTO eth_beacon.known_gaps (start_slot, end_slot, attempts, priority)
+			VALUES (105, 105, 3, 5)`)
+			Expect(err).ToNot(HaveOccurred())
+
+			released, err := beaconclient.ReleaseDeadLetters(context.Background(), bc.Db, beaconclient.DeadLetterFilter{}, 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(released).To(Equal(int64(1)))
+			deadLetters, err := beaconclient.ListDeadLetters(context.Background(), bc.Db, beaconclient.DeadLetterFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deadLetters).To(BeEmpty())
+			entries, err := beaconclient.ListKnownGaps(context.Background(), bc.Db, beaconclient.KnownGapsFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Attempts).To(Equal(0))
+			Expect(*entries[0].Priority).To(Equal(1))
+		})
+	})
+})
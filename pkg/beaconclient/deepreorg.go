@@ -0,0 +1,193 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to handle reorgs that span more than a single slot.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Check that a block is stored as the proposed block for its slot.
+	checkStoredProposedStmt string = `SELECT slot, block_root
+	FROM eth_beacon.slots
+	WHERE slot=$1 AND block_root=$2 AND status='proposed';`
+	// Get the slot of a stored block.
+	queryBlockSlotStmt string = `SELECT slot FROM eth_beacon.slots
+	WHERE block_root=$1
+	LIMIT 1;`
+)
+
+// A block on the canonical chain, found by walking back from the new head.
+type canonicalBlock struct {
+	BlockRoot string
+	StateRoot string
+}
+
+// Handle a single reorg event. When the depth is greater than one, the parent chain of the new head is walked
+// back to the common ancestor, and every slot after it, up to the later of the two heads, is marked as forked
+// unless its block is on the new chain.
+func (bc *BeaconClient) processReorg(reorg *ChainReorg) {
+	slot, err := ParseSlot(reorg.Slot)
+	if nil != err {
+		loghelper.LogSlotError(slot.Number(), err)
+	}
+	depth, err := ParseSlot(reorg.Depth)
+	if err != nil || depth <= 1 {
+		writeReorgs(bc.Db, slot, reorg.NewHeadBlock, bc.Metrics)
+		return
+	}
+
+	// The depth is measured back from the old head, which can be at an earlier or later slot than the new head.
+	oldHeadSlot, err := bc.queryBlockSlot(reorg.OldHeadBlock)
+	if err != nil {
+		loghelper.LogReorgError(slot.Number(), reorg.OldHeadBlock, err).Warn("Unable to find the slot of the old head, the depth is measured from the new head.")
+		oldHeadSlot = slot
+	}
+	lowestSlot := Slot(0)
+	if depth <= oldHeadSlot {
+		lowestSlot = oldHeadSlot - depth
+	}
+	endSlot := maxSlot(slot, oldHeadSlot)
+	log.WithFields(log.Fields{
+		"slot":         slot,
+		"depth":        depth,
+		"oldHeadSlot":  oldHeadSlot,
+		"oldHeadBlock": reorg.OldHeadBlock,
+		"newHeadBlock": reorg.NewHeadBlock,
+	}).Warn("Handling a reorg that spans multiple slots.")
+
+	chain, ancestorSlot, err := bc.walkCanonicalChain(reorg.NewHeadBlock, oldHeadSlot, lowestSlot, slot)
+	if err != nil {
+		loghelper.LogReorgError(slot.Number(), reorg.NewHeadBlock, err).Error("Unable to walk back the new head, the earlier slots will be added to the knownGaps table.")
+		writeReorgs(bc.Db, slot, reorg.NewHeadBlock, bc.Metrics)
+		writeKnownGaps(bc.Db, bc.KnownGapTableIncrement, lowestSlot+1, endSlot, err, "reorg", bc.Metrics)
+		return
+	}
+
+	bc.indexCanonicalChain(chain)
+	writeDeepReorgs(bc.Db, ancestorSlot+1, endSlot, chain, bc.Metrics)
+}
+
+// Find the slot of a block, from the DB or else from the beacon node.
+func (bc *BeaconClient) queryBlockSlot(blockRoot string) (Slot, error) {
+	var slots []uint64
+	if err := bc.Db.Select(context.Background(), &slots, queryBlockSlotStmt, blockRoot); err != nil {
+		return 0, err
+	}
+	if len(slots) > 0 {
+		return Slot(slots[0]), nil
+	}
+	var header BlockHeaderResponse
+	if _, err := queryJson(bc.ServerEndpoint+BcHeaderEndpoint(blockRoot), &header); err != nil {
+		return 0, err
+	}
+	return ParseSlot(header.Data.Header.Message.Slot)
+}
+
+// Follow the parent_root of each header, starting at headBlockRoot, until we reach the common ancestor. It is the
+// first block before the new head, at or before the old head's slot, that is stored as proposed, or the first block at or before
+// lowestSlot, the deepest slot the reorg can reach. The blocks after the ancestor, up to endSlot, are returned
+// by slot, along with the slot of the ancestor. Slots without a block on the canonical chain have no entry.
+func (bc *BeaconClient) walkCanonicalChain(headBlockRoot string, oldHeadSlot Slot, lowestSlot Slot, endSlot Slot) (map[Slot]canonicalBlock, Slot, error) {
+	chain := make(map[Slot]canonicalBlock)
+	blockRoot := headBlockRoot
+	for {
+		var header BlockHeaderResponse
+		if _, err := queryJson(bc.ServerEndpoint+BcHeaderEndpoint(blockRoot), &header); err != nil {
+			return nil, 0, err
+		}
+		headerSlot, err := ParseSlot(header.Data.Header.Message.Slot)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Unable to parse the slot of block %s: %s", blockRoot, err.Error())
+		}
+		if headerSlot <= lowestSlot {
+			return chain, headerSlot, nil
+		}
+		// Head tracking may have stored the new head already, so it is never the ancestor.
+		if headerSlot <= oldHeadSlot && blockRoot != headBlockRoot {
+			stored, err := checkSlotAndRoot(bc.Db, checkStoredProposedStmt, headerSlot, blockRoot)
+			if err != nil {
+				return nil, 0, err
+			}
+			if stored {
+				return chain, headerSlot, nil
+			}
+		}
+		if headerSlot <= endSlot {
+			chain[headerSlot] = canonicalBlock{BlockRoot: blockRoot, StateRoot: header.Data.Header.Message.StateRoot}
+		}
+		blockRoot = header.Data.Header.Message.ParentRoot
+	}
+}
+
+// Process the canonical blocks that have not been indexed yet, so they can be marked as proposed.
+func (bc *BeaconClient) indexCanonicalChain(chain map[Slot]canonicalBlock) {
+	spd := bc.SlotProcessingDetails()
+	for slot, block := range chain {
+		indexed, err := checkSlotAndRoot(bc.Db, CheckProposedStmt, slot, block.BlockRoot)
+		if err != nil {
+			writeKnownGaps(bc.Db, 1, slot, slot, err, "reorg", bc.Metrics)
+			continue
+		}
+		if indexed {
+			continue
+		}
+		log.WithFields(log.Fields{"slot": slot, "blockRoot": block.BlockRoot}).Info("Indexing a canonical block that was missed before the reorg.")
+		err, errReason := processFullSlot(context.Background(), slot, block.BlockRoot, block.StateRoot, 0, "",
+			bc.KnownGapTableIncrement, "head", &spd)
+		if err != nil {
+			writeKnownGaps(bc.Db, 1, slot, slot, err, errReason, bc.Metrics)
+		}
+	}
+}
+
+// Mark every slot from startSlot to endSlot as forked or proposed within a single transaction. Slots with a
+// canonical block have that block marked as proposed, every other row for the slot is marked as forked.
+func writeDeepReorgs(db sql.Database, startSlot Slot, endSlot Slot, chain map[Slot]canonicalBlock, metrics *BeaconClientMetrics) {
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Fatal("Unable to create a new transaction for reorgs")
+	}
+	defer func() {
+		err := tx.Rollback(ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction for reorgs")
+		}
+	}()
+	for slot := startSlot; slot <= endSlot; slot++ {
+		if block, ok := chain[slot]; ok {
+			transactReorgSlot(tx, ctx, slot, block.BlockRoot, metrics)
+			continue
+		}
+		// The slot was skipped on the canonical chain, so any block stored for it was forked.
+		if _, err := updateForked(tx, ctx, slot, ""); err != nil {
+			transactKnownGaps(tx, ctx, 1, slot, slot, err, "reorg", metrics)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Fatal("Unable to execute the transaction for reorgs")
+	}
+	metrics.IncrementReorgsInsert(1)
+}
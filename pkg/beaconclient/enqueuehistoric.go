@@ -0,0 +1,119 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the logic to add ranges of slots to the eth_beacon.historic_process table.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Find the contiguous ranges of slots between $1 and $2 that are not in eth_beacon.slots, and are not
+	// already covered by an entry in eth_beacon.historic_process.
+	queryMissingSlotRangesStmt string = `
+SELECT MIN(slot) AS start_slot, MAX(slot) AS end_slot
+FROM (
+	SELECT s.slot, s.slot - ROW_NUMBER() OVER (ORDER BY s.slot) AS island
+	FROM generate_series($1::bigint, $2::bigint) AS s(slot)
+	WHERE NOT EXISTS (SELECT 1 FROM eth_beacon.slots WHERE eth_beacon.slots.slot = s.slot AND eth_beacon.slots.status != 'forked')
+	AND NOT EXISTS (SELECT 1 FROM eth_beacon.historic_process hp WHERE s.slot BETWEEN hp.start_slot AND hp.end_slot)
+) AS missing
+GROUP BY island
+ORDER BY start_slot;`
+	// Add a new entry to the eth_beacon.historic_process table.
+	insertHpEntryStmt string = `INSERT INTO eth_beacon.historic_process (start_slot, end_slot, priority)
+VALUES ($1, $2, $3) ON CONFLICT (start_slot, end_slot) DO NOTHING;`
+)
+
+// The outcome of enqueuing a range of slots.
+type EnqueueHistoricReport struct {
+	Enqueued     []SlotRange // The entries added to the eth_beacon.historic_process table.
+	SkippedSlots uint64      // The number of slots that were already in the DB, or already enqueued.
+}
+
+// A row returned by queryMissingSlotRangesStmt.
+type missingSlotRange struct {
+	StartSlot uint64
+	EndSlot   uint64
+}
+
+// Add the slots from startSlot to endSlot, inclusive, to the eth_beacon.historic_process table so historic
+// processing will capture them. Slots that are already in the DB, or already enqueued, are skipped. The remaining
+// slots are split into entries of chunkSize slots, the same way known_gaps entries are split.
+func EnqueueHistoricSlots(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot, priority int, chunkSize int) (EnqueueHistoricReport, error) {
+	if endSlot < startSlot {
+		return EnqueueHistoricReport{}, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+	if chunkSize <= 0 {
+		return EnqueueHistoricReport{}, fmt.Errorf("The chunk size must be greater than 0")
+	}
+
+	var missing []missingSlotRange
+	if err := db.Select(ctx, &missing, queryMissingSlotRangesStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to find the slots missing from the DB")
+		return EnqueueHistoricReport{}, err
+	}
+
+	report := EnqueueHistoricReport{SkippedSlots: endSlot.Number() - startSlot.Number() + 1}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
+		return EnqueueHistoricReport{}, err
+	}
+	defer func() {
+		err := tx.Rollback(ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction")
+		}
+	}()
+
+	for _, gap := range missing {
+		report.SkippedSlots -= gap.EndSlot - gap.StartSlot + 1
+		for _, chunk := range chunkSlotRange(Slot(gap.StartSlot), Slot(gap.EndSlot), chunkSize) {
+			res, err := tx.Exec(ctx, insertHpEntryStmt, chunk.StartSlot.Number(), chunk.EndSlot.Number(), priority)
+			if err != nil {
+				loghelper.LogSlotRangeError(chunk.StartSlot.Number(), chunk.EndSlot.Number(), err).Error("Unable to add the entry to the eth_beacon.historic_process table")
+				return EnqueueHistoricReport{}, err
+			}
+			inserted, err := res.RowsAffected()
+			if err != nil {
+				return EnqueueHistoricReport{}, err
+			}
+			if inserted > 0 {
+				report.Enqueued = append(report.Enqueued, chunk)
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		loghelper.LogError(err).Error("Unable to commit the eth_beacon.historic_process entries")
+		return EnqueueHistoricReport{}, err
+	}
+	log.WithFields(log.Fields{
+		"startSlot":    startSlot,
+		"endSlot":      endSlot,
+		"entries":      len(report.Enqueued),
+		"skippedSlots": report.SkippedSlots,
+	}).Info("Enqueued slots for historic processing")
+	return report, nil
+}
@@ -0,0 +1,45 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Enqueuehistoric", Label("unit", "behavioral", "enqueue"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpTest(BeaconNodeTester.TestConfig, "99")
+	})
+
+	Context("When enqueuing a range of slots", func() {
+		It("Should split the range into entries and skip the slots already enqueued", func() {
+			report, err := beaconclient.EnqueueHistoricSlots(context.Background(), bc.Db, 90, 120, 10, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Enqueued).To(Equal([]beaconclient.SlotRange{{StartSlot: 90, EndSlot: 99}, {StartSlot: 100, EndSlot: 109}, {StartSlot: 110, EndSlot: 119}, {StartSlot: 120, EndSlot: 120}}))
+			Expect(report.SkippedSlots).To(Equal(uint64(0)))
+
+			report, err = beaconclient.EnqueueHistoricSlots(context.Background(), bc.Db, 90, 130, 10, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Enqueued).To(Equal([]beaconclient.SlotRange{{StartSlot: 121, EndSlot: 130}}))
+			Expect(report.SkippedSlots).To(Equal(uint64(31)))
+		})
+	})
+})
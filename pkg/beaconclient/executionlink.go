@@ -0,0 +1,318 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to link the execution payloads of blocks to the execution layer.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+// The number of slots of payloads that are loaded from the DB at once.
+const executionCheckBatchSlots = 8192
+
+var (
+	// Does the DB contain the ipld-eth-db header table.
+	queryHeaderCidsExistsStmt string = `SELECT to_regclass('eth.header_cids') IS NOT NULL;`
+	// Get the execution payloads of the canonical blocks within a range.
+	queryExecutionPayloadsStmt string = `SELECT sb.slot, sb.block_root, sb.payload_block_number, sb.payload_block_hash
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.slot >= $1 AND s.slot <= $2 AND s.status='proposed' AND sb.payload_block_hash IS NOT NULL
+	ORDER BY sb.slot ASC;`
+	// Get the hashes of the headers at a block number, including the ones that are not canonical.
+	queryHeaderCidsHashesStmt string = `SELECT block_hash FROM eth.header_cids WHERE block_number=$1;`
+	// Record a mismatch, replacing the previous one for the block and source.
+	upsertExecutionMismatchStmt string = `INSERT INTO eth_beacon.execution_mismatch
+	(slot, block_root, source, payload_block_number, payload_block_hash, execution_block_hash, kind)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (slot, block_root, source) DO UPDATE SET
+	payload_block_number=EXCLUDED.payload_block_number, payload_block_hash=EXCLUDED.payload_block_hash,
+	execution_block_hash=EXCLUDED.execution_block_hash, kind=EXCLUDED.kind, detected_at=now();`
+	// Get the blocks with a recorded mismatch for the source within a range.
+	queryExecutionMismatchKeysStmt string = `SELECT slot, block_root FROM eth_beacon.execution_mismatch
+	WHERE slot >= $1 AND slot <= $2 AND source=$3;`
+	// Remove the mismatch of a block that now matches.
+	deleteExecutionMismatchStmt string = `DELETE FROM eth_beacon.execution_mismatch WHERE slot=$1 AND block_root=$2 AND source=$3;`
+	// The columns returned when listing mismatches.
+	listExecutionMismatchesStmt string = `SELECT slot, block_root, source, payload_block_number, payload_block_hash,
+	execution_block_hash, kind, detected_at
+	FROM eth_beacon.execution_mismatch
+	WHERE slot >= $1 AND slot <= $2
+	ORDER BY slot ASC, source ASC;`
+	// Link each canonical execution payload to the header indexed by ipld-eth-db. It matches the view created by the
+	// migration, for the DBs where the ipld-eth-db migrations ran later.
+	createExecutionLinkViewStmt string = `CREATE OR REPLACE VIEW eth_beacon.execution_link AS
+	SELECT s.epoch, s.slot, s.block_root, sb.payload_block_number, sb.payload_block_hash,
+	hc.block_number AS execution_block_number, hc.cid AS execution_header_cid, hc.block_hash IS NOT NULL AS linked
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	LEFT JOIN eth.header_cids hc ON hc.block_hash=sb.payload_block_hash
+	WHERE s.status='proposed' AND sb.payload_block_hash IS NOT NULL;`
+)
+
+// The execution layer data that execution payloads are checked against.
+type ExecutionSource interface {
+	// The name recorded with each mismatch.
+	Name() string
+	// The hashes of the execution blocks known at a block number. It is empty when no block is known.
+	BlockHashes(ctx context.Context, number uint64) ([]string, error)
+}
+
+// An ExecutionSource backed by the JSON-RPC API of an execution client.
+type RpcExecutionSource struct {
+	client *rpc.Client
+}
+
+// Connect to the JSON-RPC API of an execution client.
+func DialRpcExecutionSource(ctx context.Context, endpoint string) (*RpcExecutionSource, error) {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		loghelper.LogError(err).WithField("endpoint", endpoint).Error("Unable to connect to the execution client")
+		return nil, err
+	}
+	return &RpcExecutionSource{client: client}, nil
+}
+
+func (s *RpcExecutionSource) Name() string {
+	return "rpc"
+}
+
+// The hash of the canonical block at the number, as reported by eth_getBlockByNumber.
+func (s *RpcExecutionSource) BlockHashes(ctx context.Context, number uint64) ([]string, error) {
+	var block *struct {
+		Hash string `json:"hash"`
+	}
+	if err := s.client.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.EncodeUint64(number), false); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return []string{}, nil
+	}
+	return []string{block.Hash}, nil
+}
+
+func (s *RpcExecutionSource) Close() {
+	s.client.Close()
+}
+
+// An ExecutionSource backed by the eth.header_cids table that ipld-eth-db keeps in the same DB.
+type HeaderCidsExecutionSource struct {
+	db sql.Database
+}
+
+// Create an ExecutionSource for the eth.header_cids table, after checking that it exists.
+func NewHeaderCidsExecutionSource(ctx context.Context, db sql.Database) (*HeaderCidsExecutionSource, error) {
+	exists, err := headerCidsExists(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("The eth.header_cids table is not in the DB")
+	}
+	return &HeaderCidsExecutionSource{db: db}, nil
+}
+
+func (s *HeaderCidsExecutionSource) Name() string {
+	return "header_cids"
+}
+
+// The hashes of every header indexed at the number, the table can contain blocks that were reorged out.
+func (s *HeaderCidsExecutionSource) BlockHashes(ctx context.Context, number uint64) ([]string, error) {
+	hashes := []string{}
+	if err := s.db.Select(ctx, &hashes, queryHeaderCidsHashesStmt, number); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// The outcome of checking the execution payloads within a range of slots.
+type ExecutionCheckReport struct {
+	Source     string `json:"source"`     // The name of the ExecutionSource.
+	StartSlot  uint64 `json:"startSlot"`  // The first slot checked.
+	EndSlot    uint64 `json:"endSlot"`    // The last slot checked.
+	Checked    uint64 `json:"checked"`    // The number of execution payloads checked.
+	Matched    uint64 `json:"matched"`    // The number of payloads whose block is known to the source.
+	Mismatched uint64 `json:"mismatched"` // The number of payloads whose block number has a different hash in the source.
+	Missing    uint64 `json:"missing"`    // The number of payloads whose block number is not known to the source.
+}
+
+// A single row within the eth_beacon.execution_mismatch table.
+type ExecutionMismatch struct {
+	Slot               uint64    // The slot of the block.
+	BlockRoot          string    // The root of the block.
+	Source             string    // The ExecutionSource the payload was checked against.
+	PayloadBlockNumber uint64    // The block number of the execution payload.
+	PayloadBlockHash   string    // The block hash of the execution payload.
+	ExecutionBlockHash *string   // The hash the source has at the block number, nil when it has no block.
+	Kind               string    // Either hash or missing.
+	DetectedAt         time.Time // When the mismatch was last found.
+}
+
+// A row returned by queryExecutionPayloadsStmt.
+type executionPayloadRow struct {
+	Slot               uint64
+	BlockRoot          string
+	PayloadBlockNumber uint64
+	PayloadBlockHash   string
+}
+
+// A block with a recorded mismatch, returned by queryExecutionMismatchKeysStmt.
+type executionMismatchKey struct {
+	Slot      uint64
+	BlockRoot string
+}
+
+// Check the execution payloads of the canonical blocks within a range of slots against the source. Each payload
+// whose block hash is not known to the source at its block number is recorded in eth_beacon.execution_mismatch,
+// and the recorded mismatch of a payload that now matches is removed.
+func CheckExecutionPayloads(ctx context.Context, db sql.Database, source ExecutionSource, startSlot Slot, endSlot Slot) (ExecutionCheckReport, error) {
+	report := ExecutionCheckReport{Source: source.Name(), StartSlot: startSlot.Number(), EndSlot: endSlot.Number()}
+	if endSlot < startSlot {
+		return report, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+
+	for batchStart := startSlot.Number(); batchStart <= endSlot.Number(); batchStart += executionCheckBatchSlots {
+		batchEnd := batchStart + executionCheckBatchSlots - 1
+		if batchEnd > endSlot.Number() || batchEnd < batchStart {
+			batchEnd = endSlot.Number()
+		}
+		var rows []executionPayloadRow
+		if err := db.Select(ctx, &rows, queryExecutionPayloadsStmt, batchStart, batchEnd); err != nil {
+			loghelper.LogSlotRangeError(batchStart, batchEnd, err).Error("Unable to get the execution payloads to check")
+			return report, err
+		}
+		var recordedRows []executionMismatchKey
+		if err := db.Select(ctx, &recordedRows, queryExecutionMismatchKeysStmt, batchStart, batchEnd, source.Name()); err != nil {
+			loghelper.LogSlotRangeError(batchStart, batchEnd, err).Error("Unable to get the recorded execution mismatches")
+			return report, err
+		}
+		recorded := make(map[executionMismatchKey]bool, len(recordedRows))
+		for _, key := range recordedRows {
+			recorded[key] = true
+		}
+		for _, row := range rows {
+			if err := checkExecutionPayload(ctx, db, source, row, recorded, &report); err != nil {
+				return report, err
+			}
+		}
+		if batchEnd == endSlot.Number() {
+			break
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"source":     report.Source,
+		"startSlot":  report.StartSlot,
+		"endSlot":    report.EndSlot,
+		"checked":    report.Checked,
+		"mismatched": report.Mismatched,
+		"missing":    report.Missing,
+	}).Info("Checked the execution payloads")
+	return report, nil
+}
+
+// Check a single execution payload, and record the outcome. The recorded mismatches of the batch are used to only
+// remove the mismatch of a payload that now matches when there is one.
+func checkExecutionPayload(ctx context.Context, db sql.Database, source ExecutionSource, row executionPayloadRow,
+	recorded map[executionMismatchKey]bool, report *ExecutionCheckReport) error {
+	hashes, err := source.BlockHashes(ctx, row.PayloadBlockNumber)
+	if err != nil {
+		loghelper.LogSlotError(row.Slot, err).WithField("blockNumber", row.PayloadBlockNumber).Error("Unable to get the execution block from the source")
+		return err
+	}
+	report.Checked++
+
+	var executionBlockHash *string
+	kind := "missing"
+	for i, hash := range hashes {
+		if strings.EqualFold(hash, row.PayloadBlockHash) {
+			report.Matched++
+			if !recorded[executionMismatchKey{Slot: row.Slot, BlockRoot: row.BlockRoot}] {
+				return nil
+			}
+			if _, err := db.Exec(ctx, deleteExecutionMismatchStmt, row.Slot, row.BlockRoot, source.Name()); err != nil {
+				loghelper.LogSlotError(row.Slot, err).Error("Unable to remove the execution mismatch")
+				return err
+			}
+			return nil
+		}
+		executionBlockHash, kind = &hashes[i], "hash"
+	}
+	if kind == "hash" {
+		report.Mismatched++
+	} else {
+		report.Missing++
+	}
+
+	log.WithFields(log.Fields{
+		"slot":               row.Slot,
+		"blockNumber":        row.PayloadBlockNumber,
+		"payloadBlockHash":   row.PayloadBlockHash,
+		"executionBlockHash": executionBlockHash,
+		"kind":               kind,
+	}).Warn("The execution payload does not match the execution source")
+	if _, err := db.Exec(ctx, upsertExecutionMismatchStmt, row.Slot, row.BlockRoot, source.Name(), row.PayloadBlockNumber,
+		row.PayloadBlockHash, executionBlockHash, kind); err != nil {
+		loghelper.LogSlotError(row.Slot, err).Error("Unable to record the execution mismatch")
+		return err
+	}
+	return nil
+}
+
+// List the recorded mismatches within a range of slots.
+func ListExecutionMismatches(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot) ([]ExecutionMismatch, error) {
+	var mismatches []ExecutionMismatch
+	if err := db.Select(ctx, &mismatches, listExecutionMismatchesStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to list the execution mismatches")
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// Create the eth_beacon.execution_link view, or replace it, when the eth.header_cids table is in the DB. Returns
+// whether the view exists.
+func CreateExecutionLinkView(ctx context.Context, db sql.Database) (bool, error) {
+	exists, err := headerCidsExists(ctx, db)
+	if err != nil || !exists {
+		return false, err
+	}
+	if _, err := db.Exec(ctx, createExecutionLinkViewStmt); err != nil {
+		loghelper.LogError(err).Error("Unable to create the eth_beacon.execution_link view")
+		return false, err
+	}
+	log.Debug("Created the eth_beacon.execution_link view")
+	return true, nil
+}
+
+// Does the DB contain the eth.header_cids table of ipld-eth-db.
+func headerCidsExists(ctx context.Context, db sql.Database) (bool, error) {
+	var exists bool
+	if err := db.QueryRow(ctx, queryHeaderCidsExistsStmt).Scan(&exists); err != nil {
+		loghelper.LogError(err).Error("Unable to check for the eth.header_cids table")
+		return false, err
+	}
+	return exists, nil
+}
@@ -0,0 +1,98 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Executionlink", Label("unit", "behavioral", "execution"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When checking the execution payloads", func() {
+		It("Should record the payloads that do not match the execution client", func() {
+			ctx := context.Background()
+			hashA := "0x" + strings.Repeat("aa", 32)
+			hashB := "0x" + strings.Repeat("bb", 32)
+			for slot, hash := range map[int]string{100: hashA, 101: hashB} {
+				_, err := bc.Db.Exec(ctx, `UPDATE eth_beacon.signed_block SET payload_block_number=$1, payload_block_hash=$2 WHERE slot=$3`, slot+900, hash, slot)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			// A JSON-RPC stub of an execution client, which knows the blocks in this map.
+			known := map[string]string{"0x3e8": hashA, "0x3e9": "0x" + strings.Repeat("cc", 32)}
+			stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				var req struct {
+					Id     json.RawMessage
+					Method string
+					Params []interface{}
+				}
+				Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+				Expect(req.Method).To(Equal("eth_getBlockByNumber"))
+				var result interface{}
+				if hash, ok := known[req.Params[0].(string)]; ok {
+					result = map[string]string{"hash": hash}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				Expect(json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})).To(Succeed())
+			}))
+			defer stub.Close()
+			source, err := beaconclient.DialRpcExecutionSource(ctx, stub.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer source.Close()
+
+			report, err := beaconclient.CheckExecutionPayloads(ctx, bc.Db, source, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report).To(Equal(beaconclient.ExecutionCheckReport{Source: "rpc", StartSlot: 99, EndSlot: 101, Checked: 2, Matched: 1, Mismatched: 1}))
+			mismatches, err := beaconclient.ListExecutionMismatches(ctx, bc.Db, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mismatches).To(HaveLen(1))
+			Expect(mismatches[0].Slot).To(Equal(uint64(101)))
+			Expect(mismatches[0].Kind).To(Equal("hash"))
+			Expect(mismatches[0].PayloadBlockHash).To(Equal(hashB))
+
+			delete(known, "0x3e9")
+			report, err = beaconclient.CheckExecutionPayloads(ctx, bc.Db, source, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Missing).To(Equal(uint64(1)))
+			mismatches, err = beaconclient.ListExecutionMismatches(ctx, bc.Db, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mismatches).To(HaveLen(1))
+			Expect(mismatches[0].Kind).To(Equal("missing"))
+			Expect(mismatches[0].ExecutionBlockHash).To(BeNil())
+
+			known["0x3e9"] = hashB
+			report, err = beaconclient.CheckExecutionPayloads(ctx, bc.Db, source, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Matched).To(Equal(uint64(2)))
+			mismatches, err = beaconclient.ListExecutionMismatches(ctx, bc.Db, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mismatches).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,67 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file exposes the pure logic of the package to the beaconclient_test package, so it can be tested without a DB.
+
+package beaconclient
+
+import "context"
+
+var (
+	SortEraFiles          = sortEraFiles
+	LoadColumnarManifest  = loadColumnarManifest
+	WriteColumnarManifest = writeColumnarManifest
+	ColumnarCompleteEnd   = columnarCompleteEnd
+	AcceptsSsz            = acceptsSsz
+	BeaconStateFork       = beaconStateFork
+)
+
+type GqlSlotFilter = gqlSlotFilter
+
+var (
+	TakeGqlStateDecode     = takeGqlStateDecode
+	MaxGraphQLStateDecodes = maxGraphQLStateDecodes
+)
+
+// A context with the BeaconState decodes of a single query.
+func NewGqlQueryContext(ctx context.Context) context.Context {
+	decodes := int32(maxGraphQLStateDecodes)
+	return context.WithValue(ctx, gqlStateDecodesKey{}, &decodes)
+}
+
+func (f *gqlSlotFilter) WhereClause() (string, []interface{}) {
+	return f.whereClause()
+}
+
+type MemoryReservation = memoryReservation
+
+// Create a reservation for a single download of each head slot. The reservations take turns in the order given.
+func (mb *MemoryBudget) NewHeadReservations(ctx context.Context, slots int) []*MemoryReservation {
+	var turn *memoryTurn
+	reservations := make([]*MemoryReservation, slots)
+	for i := range reservations {
+		turn = turn.next()
+		reservations[i] = mb.newReservation(ctx, 1, turn)
+	}
+	return reservations
+}
+
+func (mr *memoryReservation) Acquire(contentLength int64) error {
+	return mr.acquire(contentLength)
+}
+
+func (mr *memoryReservation) Release() {
+	mr.release()
+}
@@ -0,0 +1,171 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to export the SSZ objects stored in the DB to CAR files.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/car"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Get the canonical slots to export, along with the keys of their stored objects. A key is null when the
+	// eth_beacon.signed_block or eth_beacon.state row does not exist.
+	queryExportSlotsStmt string = `SELECT s.slot, sb.mh_key AS block_mh_key, st.mh_key AS state_mh_key
+	FROM eth_beacon.slots s
+	LEFT JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	LEFT JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root
+	WHERE s.slot >= $1 AND s.slot <= $2 AND s.status='proposed'
+	ORDER BY s.slot ASC;`
+)
+
+// Which objects to export, and the version of the CAR format to write.
+type CarExportOptions struct {
+	Version int  // The version of the CAR format, 1 or 2.
+	Blocks  bool // Should we export the SignedBeaconBlocks?
+	States  bool // Should we export the BeaconStates?
+}
+
+// The outcome of exporting a range of slots.
+type CarExportReport struct {
+	StartSlot uint64   `json:"startSlot"` // The first slot exported.
+	EndSlot   uint64   `json:"endSlot"`   // The last slot exported.
+	Roots     int      `json:"roots"`     // The number of block CIDs in the header of the CAR file.
+	Blocks    uint64   `json:"blocks"`    // The number of SignedBeaconBlocks written.
+	States    uint64   `json:"states"`    // The number of BeaconStates written.
+	Bytes     uint64   `json:"bytes"`     // The number of bytes of SSZ objects written.
+	Missing   []uint64 `json:"missing"`   // The slots whose objects are not in public.blocks.
+}
+
+// A row returned by queryExportSlotsStmt.
+type exportSlotRow struct {
+	Slot       uint64
+	BlockMhKey *string
+	StateMhKey *string
+}
+
+// Stream the SignedBeaconBlocks and BeaconStates of the canonical slots from startSlot to endSlot into a CAR file.
+// The roots of the file are the CIDs of the canonical blocks, even when only BeaconStates are exported.
+// Only one object is held in memory at a time. A CARv2 file must be written to an io.WriteSeeker.
+func ExportCar(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot, w io.Writer, opts CarExportOptions) (CarExportReport, error) {
+	if endSlot < startSlot {
+		return CarExportReport{}, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+	if !opts.Blocks && !opts.States {
+		return CarExportReport{}, fmt.Errorf("At least one of SignedBeaconBlocks or BeaconStates must be exported")
+	}
+	var rows []exportSlotRow
+	if err := db.Select(ctx, &rows, queryExportSlotsStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to get the slots to export")
+		return CarExportReport{}, err
+	}
+
+	report := CarExportReport{StartSlot: startSlot.Number(), EndSlot: endSlot.Number(), Missing: []uint64{}}
+	var roots []cid.Cid
+	for _, row := range rows {
+		if row.BlockMhKey == nil {
+			continue
+		}
+		c, err := CidFromMhKey(*row.BlockMhKey)
+		if err != nil {
+			return report, err
+		}
+		roots = append(roots, c)
+	}
+	report.Roots = len(roots)
+
+	cw, err := car.NewWriter(w, opts.Version, roots)
+	if err != nil {
+		return report, err
+	}
+
+	for _, row := range rows {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+		missing := false
+		if opts.Blocks {
+			written, err := exportCarObject(ctx, db, cw, row.BlockMhKey, &report)
+			if err != nil {
+				return report, err
+			}
+			if written {
+				report.Blocks++
+			} else {
+				missing = true
+			}
+		}
+		// BeaconStates are not stored for every slot, so only the states that have a row are exported.
+		if opts.States && row.StateMhKey != nil {
+			written, err := exportCarObject(ctx, db, cw, row.StateMhKey, &report)
+			if err != nil {
+				return report, err
+			}
+			if written {
+				report.States++
+			} else {
+				missing = true
+			}
+		}
+		if missing {
+			log.WithField("slot", row.Slot).Warn("The objects for the slot are not in public.blocks, they were not exported.")
+			report.Missing = append(report.Missing, row.Slot)
+		}
+	}
+
+	if err := cw.Close(); err != nil {
+		return report, err
+	}
+	log.WithFields(log.Fields{
+		"startSlot": startSlot,
+		"endSlot":   endSlot,
+		"blocks":    report.Blocks,
+		"states":    report.States,
+		"missing":   len(report.Missing),
+	}).Info("Exported the slots to a CAR file")
+	return report, nil
+}
+
+// Load a single object from public.blocks and write it to the CAR file. False is returned when the object does not exist.
+func exportCarObject(ctx context.Context, db sql.Database, cw *car.Writer, mhKey *string, report *CarExportReport) (bool, error) {
+	if mhKey == nil {
+		return false, nil
+	}
+	data, err := loadBlocksData(ctx, db, *mhKey)
+	if err != nil || data == nil {
+		return false, err
+	}
+	c, err := CidFromMhKey(*mhKey)
+	if err != nil {
+		return false, err
+	}
+	if err := cw.Put(c, data); err != nil {
+		loghelper.LogError(err).WithField("key", *mhKey).Error("Unable to write the object to the CAR file")
+		return false, err
+	}
+	report.Bytes += uint64(len(data))
+	return true, nil
+}
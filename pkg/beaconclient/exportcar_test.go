@@ -0,0 +1,48 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Exportcar", Label("unit", "behavioral", "car"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When exporting the stored slots to a CAR file", func() {
+		It("Should write every block and state, with the blocks as roots", func() {
+			var buf bytes.Buffer
+			report, err := beaconclient.ExportCar(context.Background(), bc.Db, 100, 101, &buf, beaconclient.CarExportOptions{Version: 1, Blocks: true, States: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Roots).To(Equal(2))
+			Expect(report.Blocks).To(Equal(uint64(2)))
+			Expect(report.States).To(Equal(uint64(2)))
+			Expect(report.Missing).To(BeEmpty())
+
+			blockCid, err := beaconclient.CidFromMhKey(BeaconNodeTester.TestEvents["100"].CorrectSignedBeaconBlockMhKey)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bytes.Contains(buf.Bytes(), blockCid.Bytes())).To(BeTrue())
+		})
+	})
+})
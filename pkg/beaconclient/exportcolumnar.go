@@ -0,0 +1,497 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to export the relational tables to CSV files for analytics.
+
+package beaconclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+// The version of the columnar schemas. It must be increased whenever a column is added, removed or changed.
+const ColumnarSchemaVersion = 1
+
+const (
+	// The name of the manifest within the output directory.
+	columnarManifestName = "manifest.json"
+	// The number of slots loaded from the DB at a time.
+	columnarQueryBatch uint64 = 8192
+)
+
+// The tables that can be exported, and their columns. The columns of a table never change within a schema version.
+const (
+	ColumnarSlots       = "slots"
+	ColumnarSignedBlock = "signed_block"
+	ColumnarState       = "state"
+	ColumnarBlockFields = "block_fields" // The decoded fields of the SignedBeaconBlocks that are not stored relationally.
+)
+
+var columnarSchemas = map[string][]string{
+	ColumnarSlots: {"epoch", "slot", "block_root", "state_root", "status"},
+	ColumnarSignedBlock: {"slot", "block_root", "parent_block_root", "eth1_data_block_hash", "mh_key",
+		"payload_block_number", "payload_timestamp", "payload_block_hash", "payload_parent_hash",
+		"payload_state_root", "payload_receipts_root", "payload_transactions_root"},
+	ColumnarState: {"slot", "state_root", "mh_key"},
+	ColumnarBlockFields: {"slot", "block_root", "proposer_index", "graffiti", "proposer_slashings", "attester_slashings",
+		"attestations", "deposits", "voluntary_exits", "sync_committee_participants", "execution_transactions"},
+}
+
+var (
+	queryColumnarSlotsStmt string = `SELECT epoch, slot, block_root, state_root, status
+	FROM eth_beacon.slots
+	WHERE slot >= $1 AND slot <= $2
+	ORDER BY slot ASC, block_root ASC;`
+	queryColumnarSignedBlockStmt string = `SELECT slot, block_root, parent_block_root, eth1_data_block_hash, mh_key,
+	payload_block_number, payload_timestamp, payload_block_hash, payload_parent_hash,
+	payload_state_root, payload_receipts_root, payload_transactions_root
+	FROM eth_beacon.signed_block
+	WHERE slot >= $1 AND slot <= $2
+	ORDER BY slot ASC, block_root ASC;`
+	queryColumnarStateStmt string = `SELECT slot, state_root, mh_key
+	FROM eth_beacon.state
+	WHERE slot >= $1 AND slot <= $2
+	ORDER BY slot ASC, state_root ASC;`
+	// Get the lowest slot within a range that is in eth_beacon.slots, or $2 + 1 when there is none.
+	queryColumnarLowestSlotStmt string = `SELECT COALESCE(MIN(slot), $2::bigint + 1) FROM eth_beacon.slots WHERE slot >= $1 AND slot <= $2;`
+	// Get the first slot within a range that is still waiting in an eth_beacon.historic_process or eth_beacon.known_gaps
+	// row, or $2 + 1 when there is none.
+	queryColumnarOpenSlotStmt string = `SELECT COALESCE(MIN(GREATEST(start_slot, $1)), $2::bigint + 1) FROM (
+		SELECT start_slot FROM eth_beacon.historic_process WHERE end_slot >= $1 AND start_slot <= $2
+		UNION ALL
+		SELECT start_slot FROM eth_beacon.known_gaps WHERE end_slot >= $1 AND start_slot <= $2
+	) AS open;`
+	// Get the distinct slots within a range that are in eth_beacon.slots.
+	queryColumnarPresentSlotsStmt string = `SELECT DISTINCT slot FROM eth_beacon.slots WHERE slot >= $1 AND slot <= $2 ORDER BY slot ASC;`
+)
+
+// Which tables to export, and where to.
+type ColumnarExportOptions struct {
+	Dir         string // The directory the CSV files and the manifest are written to.
+	Incremental bool   // Start after the high water mark recorded in the manifest.
+	Decoded     bool   // Also export the block_fields table, decoded from the stored SignedBeaconBlocks.
+}
+
+// The manifest kept in the output directory. It records the schemas and the high water mark of previous exports.
+type ColumnarManifest struct {
+	SchemaVersion int                 `json:"schemaVersion"` // The ColumnarSchemaVersion the files were written with.
+	HighWaterMark *uint64             `json:"highWaterMark"` // The last slot exported, null before the first export.
+	Tables        map[string][]string `json:"tables"`        // The columns of each table exported.
+	Files         []ColumnarFile      `json:"files"`         // Every file written to the directory.
+}
+
+// A single CSV file written by an export.
+type ColumnarFile struct {
+	Table     string `json:"table"`     // The table the rows belong to.
+	Path      string `json:"path"`      // The path of the file, relative to the output directory.
+	StartSlot uint64 `json:"startSlot"` // The first slot of the export.
+	EndSlot   uint64 `json:"endSlot"`   // The last slot of the export.
+	Rows      uint64 `json:"rows"`      // The number of rows in the file, without the header.
+}
+
+// The outcome of a columnar export.
+type ColumnarExportReport struct {
+	StartSlot uint64         `json:"startSlot"` // The first slot exported.
+	EndSlot   uint64         `json:"endSlot"`   // The last slot exported.
+	Files     []ColumnarFile `json:"files"`     // The files written, empty when there was nothing new to export.
+	Missing   []uint64       `json:"missing"`   // The slots whose SignedBeaconBlocks could not be decoded from public.blocks.
+}
+
+// Export the slots, signed_block and state tables, and optionally the decoded block fields, for a range of slots to
+// CSV files. Each file starts with a header row, and the columns of each table are fixed by ColumnarSchemaVersion.
+// For incremental exports, the range starts after the high water mark in the manifest, so repeated exports only
+// contain the new slots. The high water mark only advances over slots that are complete: every slot up to it is in
+// eth_beacon.slots, and none of them is still waiting in eth_beacon.historic_process or eth_beacon.known_gaps.
+// Incremental exports stop at the last complete slot, so the slots after it are exported once they are complete.
+// The manifest, and its high water mark, are only updated once every file has been written.
+func ExportColumnar(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot, opts ColumnarExportOptions) (ColumnarExportReport, error) {
+	tables := []string{ColumnarSlots, ColumnarSignedBlock, ColumnarState}
+	if opts.Decoded {
+		tables = append(tables, ColumnarBlockFields)
+	}
+	manifest, err := loadColumnarManifest(opts.Dir, tables)
+	if err != nil {
+		return ColumnarExportReport{}, err
+	}
+	if opts.Incremental && manifest.HighWaterMark != nil && Slot(*manifest.HighWaterMark) >= startSlot {
+		startSlot = Slot(*manifest.HighWaterMark + 1)
+	}
+
+	if endSlot < startSlot {
+		log.WithFields(log.Fields{"startSlot": startSlot, "endSlot": endSlot}).Info("There are no new slots to export")
+		return ColumnarExportReport{StartSlot: startSlot.Number(), EndSlot: endSlot.Number(), Files: []ColumnarFile{}, Missing: []uint64{}}, nil
+	}
+
+	// The high water mark can only advance when this export continues from it.
+	completeEnd, complete := uint64(0), false
+	if manifest.HighWaterMark == nil || startSlot.Number() <= *manifest.HighWaterMark+1 {
+		completeEnd, complete, err = queryColumnarCompleteEnd(ctx, db, manifest.HighWaterMark, startSlot.Number(), endSlot.Number())
+		if err != nil {
+			return ColumnarExportReport{}, err
+		}
+	}
+	if opts.Incremental {
+		if !complete {
+			log.WithFields(log.Fields{"startSlot": startSlot, "endSlot": endSlot}).Info("There are no new complete slots to export")
+			return ColumnarExportReport{StartSlot: startSlot.Number(), EndSlot: endSlot.Number(), Files: []ColumnarFile{}, Missing: []uint64{}}, nil
+		}
+		endSlot = Slot(completeEnd)
+	}
+
+	report := ColumnarExportReport{StartSlot: startSlot.Number(), EndSlot: endSlot.Number(), Files: []ColumnarFile{}, Missing: []uint64{}}
+
+	for _, table := range tables {
+		file, err := exportColumnarTable(ctx, db, table, startSlot, endSlot, opts.Dir, &report)
+		if err != nil {
+			return report, err
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	if complete && (manifest.HighWaterMark == nil || *manifest.HighWaterMark < completeEnd) {
+		manifest.HighWaterMark = &completeEnd
+	}
+	// A file written again replaces its previous entry.
+	for _, file := range report.Files {
+		replaced := false
+		for i := range manifest.Files {
+			if manifest.Files[i].Path == file.Path {
+				manifest.Files[i], replaced = file, true
+			}
+		}
+		if !replaced {
+			manifest.Files = append(manifest.Files, file)
+		}
+	}
+	if err := writeColumnarManifest(opts.Dir, manifest); err != nil {
+		return report, err
+	}
+	logger := log.WithFields(log.Fields{
+		"startSlot": startSlot,
+		"endSlot":   endSlot,
+		"files":     len(report.Files),
+	})
+	if manifest.HighWaterMark != nil {
+		logger = logger.WithField("highWaterMark", *manifest.HighWaterMark)
+	}
+	logger.Info("Exported the tables to CSV files")
+	return report, nil
+}
+
+// Get the last complete slot from startSlot to endSlot. The slots already below the high water mark are complete. For
+// the first export, the slots before the lowest stored slot were never indexed, so they are not counted as missing.
+// false is returned when no slot after the high water mark is complete.
+func queryColumnarCompleteEnd(ctx context.Context, db sql.Database, highWaterMark *uint64, startSlot uint64, endSlot uint64) (uint64, bool, error) {
+	if highWaterMark != nil && *highWaterMark >= startSlot {
+		startSlot = *highWaterMark + 1
+	}
+	if highWaterMark == nil {
+		if err := db.QueryRow(ctx, queryColumnarLowestSlotStmt, startSlot, endSlot).Scan(&startSlot); err != nil {
+			loghelper.LogSlotRangeError(startSlot, endSlot, err).Error("Unable to get the lowest stored slot")
+			return 0, false, err
+		}
+	}
+	if startSlot > endSlot {
+		return 0, false, nil
+	}
+	var openSlot uint64
+	if err := db.QueryRow(ctx, queryColumnarOpenSlotStmt, startSlot, endSlot).Scan(&openSlot); err != nil {
+		loghelper.LogSlotRangeError(startSlot, endSlot, err).Error("Unable to get the slots waiting to be processed")
+		return 0, false, err
+	}
+
+	completeEnd, complete := uint64(0), false
+	for batchStart := startSlot; batchStart <= endSlot; batchStart += columnarQueryBatch {
+		batchEnd := batchStart + columnarQueryBatch - 1
+		if batchEnd > endSlot || batchEnd < batchStart {
+			batchEnd = endSlot
+		}
+		var present []uint64
+		if err := db.Select(ctx, &present, queryColumnarPresentSlotsStmt, batchStart, batchEnd); err != nil {
+			loghelper.LogSlotRangeError(batchStart, batchEnd, err).Error("Unable to get the stored slots")
+			return 0, false, err
+		}
+		end, ok := columnarCompleteEnd(batchStart, batchEnd, present, openSlot)
+		if !ok {
+			break
+		}
+		completeEnd, complete = end, true
+		if end < batchEnd {
+			break
+		}
+	}
+	return completeEnd, complete, nil
+}
+
+// Get the last slot from startSlot to endSlot that is complete, given the distinct stored slots within the range in
+// order, and the first slot that is still waiting to be processed. Slots are complete until the first slot that is
+// not stored, or is waiting. false is returned when startSlot is not complete.
+func columnarCompleteEnd(startSlot uint64, endSlot uint64, present []uint64, openSlot uint64) (uint64, bool) {
+	if openSlot <= endSlot {
+		if openSlot <= startSlot {
+			return 0, false
+		}
+		endSlot = openSlot - 1
+	}
+	next := startSlot
+	for _, slot := range present {
+		if slot != next || slot > endSlot {
+			break
+		}
+		next++
+	}
+	if next == startSlot {
+		return 0, false
+	}
+	return next - 1, true
+}
+
+// Load the manifest of the output directory, or create a new one. The schema version and the tables must match
+// those of the previous exports, so every file in the directory has the same columns.
+func loadColumnarManifest(dir string, tables []string) (*ColumnarManifest, error) {
+	manifest := &ColumnarManifest{SchemaVersion: ColumnarSchemaVersion, Tables: map[string][]string{}, Files: []ColumnarFile{}}
+	for _, table := range tables {
+		manifest.Tables[table] = columnarSchemas[table]
+	}
+	data, err := os.ReadFile(filepath.Join(dir, columnarManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var existing ColumnarManifest
+	if err := json.Unmarshal(data, &existing); err != nil {
+		return nil, fmt.Errorf("Unable to parse the manifest in %s: %w", dir, err)
+	}
+	if existing.SchemaVersion != ColumnarSchemaVersion {
+		return nil, fmt.Errorf("The files in %s use schema version %d, not %d", dir, existing.SchemaVersion, ColumnarSchemaVersion)
+	}
+	if len(existing.Tables) != len(tables) {
+		return nil, fmt.Errorf("The files in %s contain a different set of tables", dir)
+	}
+	for _, table := range tables {
+		if _, ok := existing.Tables[table]; !ok {
+			return nil, fmt.Errorf("The files in %s do not contain the %s table", dir, table)
+		}
+	}
+	existing.Tables = manifest.Tables
+	if existing.Files == nil {
+		existing.Files = []ColumnarFile{}
+	}
+	return &existing, nil
+}
+
+// Write the manifest to a temporary file, then move it into place.
+func writeColumnarManifest(dir string, manifest *ColumnarManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, columnarManifestName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Write the rows of a single table to a CSV file. The file is only moved into place once every row was written.
+func exportColumnarTable(ctx context.Context, db sql.Database, table string, startSlot Slot, endSlot Slot, dir string, report *ColumnarExportReport) (ColumnarFile, error) {
+	file := ColumnarFile{
+		Table:     table,
+		Path:      filepath.Join(table, fmt.Sprintf("%s-%d-%d.csv", table, startSlot, endSlot)),
+		StartSlot: startSlot.Number(),
+		EndSlot:   endSlot.Number(),
+	}
+	path := filepath.Join(dir, file.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return file, err
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		loghelper.LogError(err).WithField("path", path).Error("Unable to create the CSV file")
+		return file, err
+	}
+	bw := bufio.NewWriter(f)
+	cw := csv.NewWriter(bw)
+
+	err = cw.Write(columnarSchemas[table])
+	for batchStart := startSlot.Number(); err == nil && batchStart <= endSlot.Number(); batchStart += columnarQueryBatch {
+		batchEnd := batchStart + columnarQueryBatch - 1
+		if batchEnd > endSlot.Number() || batchEnd < batchStart {
+			batchEnd = endSlot.Number()
+		}
+		var records [][]string
+		records, err = queryColumnarRecords(ctx, db, table, batchStart, batchEnd, report)
+		if err == nil {
+			err = cw.WriteAll(records)
+			file.Rows += uint64(len(records))
+		}
+		if batchEnd == endSlot.Number() {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).WithField("table", table).Error("Unable to export the table")
+		return file, err
+	}
+	return file, nil
+}
+
+// Get the CSV records of a table for a range of slots.
+func queryColumnarRecords(ctx context.Context, db sql.Database, table string, startSlot uint64, endSlot uint64, report *ColumnarExportReport) ([][]string, error) {
+	var records [][]string
+	switch table {
+	case ColumnarSlots:
+		var rows []struct {
+			Epoch     uint64
+			Slot      uint64
+			BlockRoot string
+			StateRoot string
+			Status    string
+		}
+		if err := db.Select(ctx, &rows, queryColumnarSlotsStmt, startSlot, endSlot); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			records = append(records, []string{formatUint(row.Epoch), formatUint(row.Slot), row.BlockRoot, row.StateRoot, row.Status})
+		}
+	case ColumnarSignedBlock, ColumnarBlockFields:
+		var rows []columnarSignedBlockRow
+		if err := db.Select(ctx, &rows, queryColumnarSignedBlockStmt, startSlot, endSlot); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if table == ColumnarSignedBlock {
+				records = append(records, []string{formatUint(row.Slot), row.BlockRoot, row.ParentBlockRoot, row.Eth1DataBlockHash, row.MhKey,
+					formatOptionalUint(row.PayloadBlockNumber), formatOptionalUint(row.PayloadTimestamp), formatOptional(row.PayloadBlockHash),
+					formatOptional(row.PayloadParentHash), formatOptional(row.PayloadStateRoot), formatOptional(row.PayloadReceiptsRoot),
+					formatOptional(row.PayloadTransactionsRoot)})
+				continue
+			}
+			record, err := decodeBlockFields(ctx, db, row.Slot, row.BlockRoot, row.MhKey)
+			if err != nil {
+				return nil, err
+			}
+			if record == nil {
+				log.WithField("slot", row.Slot).Warn("Unable to decode the SignedBeaconBlock, its fields were not exported.")
+				report.Missing = append(report.Missing, row.Slot)
+				continue
+			}
+			records = append(records, record)
+		}
+	case ColumnarState:
+		var rows []struct {
+			Slot      uint64
+			StateRoot string
+			MhKey     string
+		}
+		if err := db.Select(ctx, &rows, queryColumnarStateStmt, startSlot, endSlot); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			records = append(records, []string{formatUint(row.Slot), row.StateRoot, row.MhKey})
+		}
+	default:
+		return nil, fmt.Errorf("Unknown table: %s", table)
+	}
+	return records, nil
+}
+
+// A row of the eth_beacon.signed_block table.
+type columnarSignedBlockRow struct {
+	Slot                    uint64
+	BlockRoot               string
+	ParentBlockRoot         string
+	Eth1DataBlockHash       string
+	MhKey                   string
+	PayloadBlockNumber      *uint64
+	PayloadTimestamp        *uint64
+	PayloadBlockHash        *string
+	PayloadParentHash       *string
+	PayloadStateRoot        *string
+	PayloadReceiptsRoot     *string
+	PayloadTransactionsRoot *string
+}
+
+// Decode the fields of a stored SignedBeaconBlock that are not in the eth_beacon.signed_block table.
+// Nil is returned when the block is not in public.blocks, or can not be decoded.
+func decodeBlockFields(ctx context.Context, db sql.Database, slot uint64, blockRoot string, mhKey string) ([]string, error) {
+	data, err := loadBlocksData(ctx, db, mhKey)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var signedBlock SignedBeaconBlock
+	if err := signedBlock.UnmarshalSSZ(data); err != nil {
+		return nil, nil
+	}
+
+	block := signedBlock.Block()
+	body := block.Body()
+	counts := body.OperationCounts()
+	syncParticipants := ""
+	if n, ok := body.SyncCommitteeParticipants(); ok {
+		syncParticipants = strconv.Itoa(n)
+	}
+	transactions := ""
+	if n, ok := body.ExecutionTransactionCount(); ok {
+		transactions = strconv.Itoa(n)
+	}
+	return []string{formatUint(slot), blockRoot, formatUint(block.ProposerIndex()), toHex(body.Graffiti()),
+		strconv.Itoa(counts.ProposerSlashings), strconv.Itoa(counts.AttesterSlashings), strconv.Itoa(counts.Attestations),
+		strconv.Itoa(counts.Deposits), strconv.Itoa(counts.VoluntaryExits), syncParticipants, transactions}, nil
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+// Format a nullable column, null is written as an empty string.
+func formatOptionalUint(v *uint64) string {
+	if v == nil {
+		return ""
+	}
+	return formatUint(*v)
+}
+
+func formatOptional(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
@@ -0,0 +1,136 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Exportcolumnar", Label("unit", "behavioral", "columnar"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When exporting the tables to CSV files", func() {
+		It("Should only export the slots after the high water mark", func() {
+			opts := beaconclient.ColumnarExportOptions{Dir: GinkgoT().TempDir(), Incremental: true, Decoded: true}
+			report, err := beaconclient.ExportColumnar(context.Background(), bc.Db, 0, 100, opts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Files).To(HaveLen(4))
+			Expect(report.Missing).To(BeEmpty())
+			for _, file := range report.Files {
+				Expect(file.Rows).To(Equal(uint64(1)))
+			}
+			data, err := os.ReadFile(filepath.Join(opts.Dir, report.Files[0].Path))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(HavePrefix("epoch,slot,block_root,state_root,status\n"))
+			Expect(string(data)).To(ContainSubstring(BeaconNodeTester.TestEvents["100"].HeadMessage.Block))
+
+			report, err = beaconclient.ExportColumnar(context.Background(), bc.Db, 0, 101, opts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.StartSlot).To(Equal(uint64(101)))
+			Expect(report.Files).To(HaveLen(4))
+			report, err = beaconclient.ExportColumnar(context.Background(), bc.Db, 0, 101, opts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Files).To(BeEmpty())
+
+			opts.Decoded = false
+			_, err = beaconclient.ExportColumnar(context.Background(), bc.Db, 0, 102, opts)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should not advance the high water mark past a slot that is waiting to be processed", func() {
+			BeaconNodeTester.writeEventToKnownGaps(bc, 101, 101)
+			opts := beaconclient.ColumnarExportOptions{Dir: GinkgoT().TempDir(), Incremental: true}
+			report, err := beaconclient.ExportColumnar(context.Background(), bc.Db, 0, 101, opts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.EndSlot).To(Equal(uint64(100)))
+			manifest, err := beaconclient.LoadColumnarManifest(opts.Dir, []string{beaconclient.ColumnarSlots, beaconclient.ColumnarSignedBlock, beaconclient.ColumnarState})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*manifest.HighWaterMark).To(Equal(uint64(100)))
+		})
+	})
+})
+
+var _ = Describe("Columnar manifest", Label("unit"), func() {
+	tables := []string{beaconclient.ColumnarSlots, beaconclient.ColumnarSignedBlock, beaconclient.ColumnarState}
+
+	It("Should start without a high water mark", func() {
+		manifest, err := beaconclient.LoadColumnarManifest(GinkgoT().TempDir(), tables)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifest.SchemaVersion).To(Equal(beaconclient.ColumnarSchemaVersion))
+		Expect(manifest.HighWaterMark).To(BeNil())
+		Expect(manifest.Tables).To(HaveLen(3))
+		Expect(manifest.Files).To(BeEmpty())
+	})
+	It("Should keep the high water mark and files of previous exports", func() {
+		dir := GinkgoT().TempDir()
+		manifest, err := beaconclient.LoadColumnarManifest(dir, tables)
+		Expect(err).ToNot(HaveOccurred())
+		highWaterMark := uint64(101)
+		manifest.HighWaterMark = &highWaterMark
+		manifest.Files = append(manifest.Files, beaconclient.ColumnarFile{Table: beaconclient.ColumnarSlots, Path: "slots.csv", StartSlot: 100, EndSlot: 101, Rows: 2})
+		Expect(beaconclient.WriteColumnarManifest(dir, manifest)).To(Succeed())
+
+		loaded, err := beaconclient.LoadColumnarManifest(dir, tables)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*loaded.HighWaterMark).To(Equal(uint64(101)))
+		Expect(loaded.Files).To(Equal(manifest.Files))
+	})
+	It("Should reject a directory exported with other tables or another schema", func() {
+		dir := GinkgoT().TempDir()
+		manifest, err := beaconclient.LoadColumnarManifest(dir, tables)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(beaconclient.WriteColumnarManifest(dir, manifest)).To(Succeed())
+		_, err = beaconclient.LoadColumnarManifest(dir, append(tables, beaconclient.ColumnarBlockFields))
+		Expect(err).To(HaveOccurred())
+
+		manifest.SchemaVersion = beaconclient.ColumnarSchemaVersion + 1
+		Expect(beaconclient.WriteColumnarManifest(dir, manifest)).To(Succeed())
+		_, err = beaconclient.LoadColumnarManifest(dir, tables)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Columnar high water mark", Label("unit"), func() {
+	It("Should advance over the stored slots", func() {
+		end, ok := beaconclient.ColumnarCompleteEnd(100, 103, []uint64{100, 101, 102, 103}, 104)
+		Expect(ok).To(BeTrue())
+		Expect(end).To(Equal(uint64(103)))
+	})
+	It("Should stop before a missing slot", func() {
+		end, ok := beaconclient.ColumnarCompleteEnd(100, 103, []uint64{100, 101, 103}, 104)
+		Expect(ok).To(BeTrue())
+		Expect(end).To(Equal(uint64(101)))
+		_, ok = beaconclient.ColumnarCompleteEnd(100, 103, []uint64{101, 102, 103}, 104)
+		Expect(ok).To(BeFalse())
+		_, ok = beaconclient.ColumnarCompleteEnd(100, 103, []uint64{}, 104)
+		Expect(ok).To(BeFalse())
+	})
+	It("Should stop before a slot that is waiting to be processed", func() {
+		end, ok := beaconclient.ColumnarCompleteEnd(100, 103, []uint64{100, 101, 102, 103}, 102)
+		Expect(ok).To(BeTrue())
+		Expect(end).To(Equal(uint64(101)))
+		_, ok = beaconclient.ColumnarCompleteEnd(100, 103, []uint64{100, 101, 102, 103}, 100)
+		Expect(ok).To(BeFalse())
+	})
+})
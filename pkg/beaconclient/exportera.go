@@ -0,0 +1,239 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to export the canonical chain stored in the DB to era files.
+
+package beaconclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/era"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Get the status of every canonical slot within a range, along with the key of the proposed block.
+	// The key is null when the eth_beacon.signed_block row does not exist.
+	queryEraSlotsStmt string = `SELECT s.slot, s.status, sb.mh_key AS block_mh_key
+	FROM eth_beacon.slots s
+	LEFT JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.slot >= $1 AND s.slot <= $2 AND s.status IN ('proposed', 'skipped')
+	ORDER BY s.slot ASC, s.status ASC;`
+	// Get the key of the BeaconState stored for a canonical slot, a skipped slot keeps its state on the skipped row.
+	queryEraStateStmt string = `SELECT s.status, st.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root
+	WHERE s.slot=$1 AND s.status IN ('proposed', 'skipped');`
+)
+
+// The outcome of exporting a range of slots to era files.
+type EraExportReport struct {
+	StartEra uint64   `json:"startEra"` // The first era exported.
+	EndEra   uint64   `json:"endEra"`   // The last era exported.
+	Files    []string `json:"files"`    // The era files written.
+	Blocks   uint64   `json:"blocks"`   // The number of SignedBeaconBlocks written.
+	Bytes    uint64   `json:"bytes"`    // The number of bytes of SSZ objects written, before compression.
+}
+
+// A row returned by queryEraSlotsStmt.
+type eraSlotRow struct {
+	Slot       uint64
+	Status     string
+	BlockMhKey *string
+}
+
+// Export the complete eras within the range of slots to era files in the given directory. Era N contains the blocks
+// of the slots from (N-1)*8192 to N*8192-1, and the BeaconState stored for slot N*8192, so an era is only exported
+// when all of these slots are within the range. Every slot of an exported era must be in the DB, as proposed or
+// skipped, along with its objects. A file is only created once the whole era has been written.
+func ExportEra(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot, dir string, network string) (EraExportReport, error) {
+	if endSlot < startSlot {
+		return EraExportReport{}, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+	startEra := uint64(0)
+	if startSlot > 0 {
+		startEra = (startSlot.Number()+era.SlotsPerHistoricalRoot-1)/era.SlotsPerHistoricalRoot + 1
+	}
+	endEra := endSlot.Number() / era.SlotsPerHistoricalRoot
+	if startEra > endEra {
+		return EraExportReport{}, fmt.Errorf("The slots from %d to %d do not contain a complete era", startSlot, endSlot)
+	}
+
+	report := EraExportReport{StartEra: startEra, EndEra: endEra, Files: []string{}}
+	for n := startEra; n <= endEra; n++ {
+		path, err := exportEraFile(ctx, db, n, dir, network, &report)
+		if err != nil {
+			return report, err
+		}
+		report.Files = append(report.Files, path)
+	}
+	log.WithFields(log.Fields{
+		"startEra": startEra,
+		"endEra":   endEra,
+		"blocks":   report.Blocks,
+	}).Info("Exported the slots to era files")
+	return report, nil
+}
+
+// Write a single era file, and return its path.
+func exportEraFile(ctx context.Context, db sql.Database, n uint64, dir string, network string, report *EraExportReport) (string, error) {
+	stateSlot := Slot(n * era.SlotsPerHistoricalRoot)
+	state, err := loadEraState(ctx, db, stateSlot)
+	if err != nil {
+		return "", err
+	}
+	var historicalRoot Root
+	if n == 0 {
+		historicalRoot = state.full.GenesisValidatorsRoot()
+	} else {
+		roots := state.full.HistoricalRoots()
+		if uint64(len(roots)) < n {
+			return "", fmt.Errorf("The BeaconState at slot %d does not contain the historical root for era %d", stateSlot, n)
+		}
+		historicalRoot = roots[n-1]
+	}
+
+	path := filepath.Join(dir, era.FileName(network, n, historicalRoot))
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		loghelper.LogError(err).WithField("path", tmpPath).Error("Unable to create the era file")
+		return "", err
+	}
+	bw := bufio.NewWriter(f)
+	err = writeEraFile(ctx, db, n, bw, state, report)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		log.WithFields(log.Fields{"era": n, "err": err}).Error("Unable to export the era")
+		return "", err
+	}
+	log.WithFields(log.Fields{"era": n, "path": path}).Info("Exported the era")
+	return path, nil
+}
+
+// Write the blocks and state of an era.
+func writeEraFile(ctx context.Context, db sql.Database, n uint64, bw *bufio.Writer, state *eraState, report *EraExportReport) error {
+	ew, err := era.NewWriter(bw, n)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		startSlot, endSlot := ew.StartSlot(), ew.StateSlot()-1
+		var rows []eraSlotRow
+		if err := db.Select(ctx, &rows, queryEraSlotsStmt, startSlot, endSlot); err != nil {
+			loghelper.LogSlotRangeError(startSlot, endSlot, err).Error("Unable to get the slots to export")
+			return err
+		}
+		// A slot with a proposed row is ordered before any skipped row for it.
+		next := startSlot
+		for _, row := range rows {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if row.Slot < next {
+				continue
+			}
+			if row.Slot > next {
+				return fmt.Errorf("The slot %d is not in the DB", next)
+			}
+			next++
+			if row.Status != "proposed" {
+				continue
+			}
+			if row.BlockMhKey == nil {
+				return fmt.Errorf("The SignedBeaconBlock for slot %d is not in the DB", row.Slot)
+			}
+			data, err := loadBlocksData(ctx, db, *row.BlockMhKey)
+			if err != nil {
+				return err
+			}
+			if data == nil {
+				return fmt.Errorf("The SignedBeaconBlock for slot %d is not in public.blocks", row.Slot)
+			}
+			if err := ew.AddBlock(row.Slot, data); err != nil {
+				return err
+			}
+			report.Blocks++
+			report.Bytes += uint64(len(data))
+		}
+		if next <= endSlot {
+			return fmt.Errorf("The slot %d is not in the DB", next)
+		}
+	}
+
+	if err := ew.SetState(state.ssz); err != nil {
+		return err
+	}
+	report.Bytes += uint64(len(state.ssz))
+	return ew.Close()
+}
+
+// Load and decode the BeaconState stored for a slot. Era files need the state before the block at the slot is
+// applied, but the state stored for a proposed slot is the one after it, so only the state of a skipped slot is used.
+// The genesis state has no block applied to it, so it is used for era 0.
+func loadEraState(ctx context.Context, db sql.Database, slot Slot) (*eraState, error) {
+	var rows []struct {
+		Status string
+		MhKey  string
+	}
+	if err := db.Select(ctx, &rows, queryEraStateStmt, slot.Number()); err != nil {
+		loghelper.LogSlotError(slot.Number(), err).Error("Unable to get the BeaconState to export")
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("The BeaconState for slot %d is not in the DB", slot)
+	}
+	for _, row := range rows {
+		if row.Status == "proposed" && slot != 0 {
+			return nil, fmt.Errorf("The slot %d has a block, the BeaconState stored for it is the state after the block, but era files need the state before it", slot)
+		}
+	}
+	data, err := loadBlocksData(ctx, db, rows[0].MhKey)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("The BeaconState for slot %d is not in public.blocks", slot)
+	}
+
+	var full BeaconState
+	if err := full.UnmarshalSSZ(data); err != nil {
+		loghelper.LogSlotError(slot.Number(), err).Error("Unable to decode the BeaconState")
+		return nil, err
+	}
+	if full.Slot() != slot {
+		return nil, fmt.Errorf("The BeaconState stored for slot %d is for slot %d", slot, full.Slot())
+	}
+	return &eraState{slot: slot, root: toHex(full.HashTreeRoot()), full: &full, ssz: data}, nil
+}
@@ -0,0 +1,102 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the pipeline used to process head slots. Slots are fetched concurrently,
+// but they are committed one at a time, in the order they were received.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A head event moving through the pipeline.
+type headSlot struct {
+	slot      Slot
+	blockRoot string
+	stateRoot string
+	fetched   chan struct{} // Closed once the objects have been fetched, or fetching failed.
+	turn      *memoryTurn   // Ensures the slot acquires from the memory budget before the slots received after it.
+	ps        *ProcessSlot  // The fetched objects, nil when there is nothing to write.
+	err       error         // The error from fetching the objects.
+	errReason string        // The process that failed, used for the known_gaps table.
+}
+
+// Fetch the objects for the head slot. Nothing is written to the DB.
+func (hs *headSlot) fetch(spd SlotProcessingDetails) {
+	defer close(hs.fetched)
+	// The turn is over once fetching ends, even when nothing was acquired from the memory budget.
+	defer hs.turn.finish()
+	spd.memoryTurn = hs.turn
+	hs.ps, hs.err, hs.errReason = fetchSlot(context.Background(), hs.slot, hs.blockRoot, hs.stateRoot, "head", &spd)
+}
+
+// Commit the head slots in the order they were received. A slot is only committed once every slot before it
+// was committed, so the parent check of each slot runs against a previous slot that is in the DB.
+func (bc *BeaconClient) commitHeadSlots(pending <-chan *headSlot) {
+	for hs := range pending {
+		<-hs.fetched
+		bc.commitHeadSlot(hs)
+		bc.headInFlight.Done()
+	}
+}
+
+// Write a single head slot to the DB. The slot only becomes the previous slot once it was written, so the
+// parent check of the next slot never runs against a slot that is not in the DB.
+func (bc *BeaconClient) commitHeadSlot(hs *headSlot) {
+	spd := bc.SlotProcessingDetails()
+	// Get the knownGaps at startUp
+	if spd.PreviousSlot == 0 && spd.PreviousBlockRoot == "" {
+		writeStartUpGaps(spd.Db, spd.KnownGapTableIncrement, hs.slot, spd.Metrics)
+	}
+
+	err, errReason := hs.err, hs.errReason
+	if err == nil && hs.ps != nil {
+		err, errReason = hs.ps.commitSlot(context.Background(), spd.PreviousSlot, spd.PreviousBlockRoot, spd.KnownGapTableIncrement, &spd)
+		hs.ps.Memory.release()
+	}
+	if err != nil {
+		writeKnownGaps(spd.Db, spd.KnownGapTableIncrement, hs.slot, hs.slot, err, errReason, spd.Metrics)
+		log.WithFields(log.Fields{"slot": hs.slot, "blockRoot": hs.blockRoot}).Debug("Unable to commit the head slot.")
+		return
+	}
+	if spd.PerformBeaconStateProcessing && spd.StateCadence.isOnCadence(hs.slot) && !spd.isFinalizedForCadence(hs.slot) {
+		// The epoch boundary is not finalized yet. Known gaps processing will store its BeaconState once it is.
+		writeKnownGaps(spd.Db, 1, hs.slot, hs.slot, NotFinalizedStateCadence, "stateCadence", spd.Metrics)
+	}
+
+	bc.previousLock.Lock()
+	if bc.PreviousSlot == 0 && bc.PreviousBlockRoot == "" {
+		bc.StartingSlot = hs.slot
+	}
+	bc.PreviousSlot = hs.slot
+	bc.PreviousBlockRoot = hs.blockRoot
+	bc.previousLock.Unlock()
+	log.WithFields(log.Fields{"slot": hs.slot, "blockRoot": hs.blockRoot}).Debug("Committed the head slot.")
+}
+
+// Handle a head event that arrived after an event for a later slot. It can not be committed in order, so the
+// slot is added to the knownGaps table instead. Known gaps processing will fetch the canonical block for it.
+func (bc *BeaconClient) handleLateHead(slot Slot, latestSlot Slot) {
+	log.WithFields(log.Fields{
+		"slot":       slot,
+		"latestSlot": latestSlot,
+	}).Warn("Received a head event for a slot before the latest head, adding it to the knownGaps table.")
+	writeKnownGaps(bc.Db, 1, slot, slot, fmt.Errorf("The head event arrived after slot %d", latestSlot), "headLate", bc.Metrics)
+	bc.Metrics.IncrementHeadLateEvents(1)
+}
@@ -27,7 +27,7 @@ import (
 // Keep in mind, the beacon client will allow you to connect to it but it might
 // Not allow you to make http requests. This is part of its built in logic, and you will have
 // to follow their provided guidelines. https://lighthouse-book.sigmaprime.io/api-bn.html#security
-func (bc BeaconClient) CheckBeaconClient() error {
+func (bc *BeaconClient) CheckBeaconClient() error {
 	log.Debug("Attempting to connect to the beacon client")
 	bcEndpoint := bc.ServerEndpoint + bcHealthEndpoint
 	resp, err := http.Get(bcEndpoint)
@@ -0,0 +1,421 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to import era files into the DB.
+
+package beaconclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/era"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Remove the known_gaps rows that are fully covered by an imported range.
+	deleteCoveredKgStmt string = `DELETE FROM eth_beacon.known_gaps
+	WHERE start_slot >= $1 AND end_slot <= $2 AND checked_out=false;`
+	// Get the known_gaps rows that partially overlap an imported range.
+	queryOverlappingKgStmt string = `SELECT start_slot, end_slot FROM eth_beacon.known_gaps
+	WHERE start_slot <= $2 AND end_slot >= $1 AND checked_out=false;`
+	// Mark the rows of a slot that the era file does not contain as forked, and the row it contains with its status.
+	markEraSlotStmt string = `UPDATE eth_beacon.slots
+	SET status=CASE WHEN block_root=$2 THEN $3 ELSE 'forked' END
+	WHERE slot=$1 AND status<>CASE WHEN block_root=$2 THEN $3 ELSE 'forked' END;`
+	// Record the BeaconState of a skipped slot on its row.
+	setSkippedStateRootStmt string = `UPDATE eth_beacon.slots
+	SET state_root=$2
+	WHERE slot=$1 AND block_root='' AND status='skipped';`
+	// Get the root of the last proposed block before a slot.
+	queryLastProposedRootStmt string = `SELECT block_root FROM eth_beacon.slots
+	WHERE slot < $1 AND status='proposed'
+	ORDER BY slot DESC LIMIT 1;`
+)
+
+// The era number within a standard era file name, e.g. mainnet-00012-a1b2c3d4.era.
+var eraFileNumber = regexp.MustCompile(`-(\d+)-[0-9a-f]{8}\.era$`)
+
+// The outcome of importing a set of era files.
+type EraImportReport struct {
+	Files            int    `json:"files"`            // The number of era files imported.
+	StartSlot        uint64 `json:"startSlot"`        // The first slot covered by the files.
+	EndSlot          uint64 `json:"endSlot"`          // The last slot covered by the files.
+	Proposed         uint64 `json:"proposed"`         // The number of slots written with a SignedBeaconBlock.
+	Skipped          uint64 `json:"skipped"`          // The number of slots written as skipped.
+	States           uint64 `json:"states"`           // The number of BeaconStates written.
+	KnownGapsCleared int64  `json:"knownGapsCleared"` // The number of known_gaps rows removed.
+}
+
+// A BeaconState read from an era file, it is written with the block at the same slot.
+type eraState struct {
+	slot Slot
+	root string
+	full *BeaconState
+	ssz  []byte
+}
+
+// The end of the chain imported so far, which the next era file continues.
+type eraChain struct {
+	state     *eraState // The BeaconState at the first slot of the next era file.
+	blockRoot string    // The root of the last block imported.
+	nextSlot  Slot      // The first slot after the last era file imported.
+}
+
+// Import the SignedBeaconBlocks and BeaconStates of the era files into the DB. The files are imported in era order
+// when their names follow the standard naming scheme. Each block must be the child of the block before it. The rows
+// for a covered slot that the files do not contain are marked as forked.
+//
+// The BeaconState of an era file is the state at the first slot of the next era file, so it is only written when that
+// file is imported in the same run. Standard era files hold the state before any block at that slot is applied, so the
+// latest block of the state must be the last proposed block before the slot. It is written as its own state, and is
+// also recorded on the row of a skipped slot. A state whose root matches the StateRoot of the block at the slot is the
+// state after the block, and is written with it. Once a file is imported, the known_gaps rows for the range it covers
+// are cleared.
+func ImportEra(ctx context.Context, db sql.Database, metrics *BeaconClientMetrics, paths []string) (EraImportReport, error) {
+	report := EraImportReport{}
+	if len(paths) == 0 {
+		return report, fmt.Errorf("No era files were provided")
+	}
+
+	chain := &eraChain{}
+	anyCovered := false // Has a file covered a range of slots yet.
+	for _, path := range sortEraFiles(paths) {
+		startSlot, endSlot, covered, err := importEraFile(ctx, db, metrics, path, chain, &report)
+		if err != nil {
+			return report, err
+		}
+		report.Files++
+		if !covered {
+			continue
+		}
+		chain.nextSlot = endSlot + 1
+
+		cleared, err := clearImportedKnownGaps(ctx, db, startSlot, endSlot)
+		if err != nil {
+			return report, err
+		}
+		report.KnownGapsCleared += cleared
+		if !anyCovered || startSlot.Number() < report.StartSlot {
+			report.StartSlot = startSlot.Number()
+		}
+		if endSlot.Number() > report.EndSlot {
+			report.EndSlot = endSlot.Number()
+		}
+		anyCovered = true
+	}
+
+	if chain.state != nil {
+		log.WithField("slot", chain.state.slot).Info("The BeaconState at the end of the last era file was not written, its block is in the next era file.")
+	}
+	log.WithFields(log.Fields{
+		"files":            report.Files,
+		"startSlot":        report.StartSlot,
+		"endSlot":          report.EndSlot,
+		"proposed":         report.Proposed,
+		"skipped":          report.Skipped,
+		"states":           report.States,
+		"knownGapsCleared": report.KnownGapsCleared,
+	}).Info("Imported the era files")
+	return report, nil
+}
+
+// Import a single era file, continuing the chain imported so far. The range of slots covered by the file is returned.
+// The file does not cover any slots when it has no block index, as for era 0.
+func importEraFile(ctx context.Context, db sql.Database, metrics *BeaconClientMetrics, path string, chain *eraChain, report *EraImportReport) (Slot, Slot, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		loghelper.LogError(err).WithField("path", path).Error("Unable to open the era file")
+		return 0, 0, false, err
+	}
+	defer f.Close()
+
+	log.WithField("path", path).Info("Importing the era file")
+	spd := &SlotProcessingDetails{Context: ctx, Db: db, Metrics: metrics}
+	state := chain.state
+	// The root of the last block before the file, it is only known when the file follows the previous one.
+	previousRoot := chain.blockRoot
+	parentRoot := ""
+	proposed := make(map[Slot]string)
+	var next *eraState
+	rd := era.NewReader(bufio.NewReader(f))
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, 0, false, ctx.Err()
+		default:
+		}
+		obj, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			loghelper.LogError(err).WithField("path", path).Error("Unable to read the era file")
+			return 0, 0, false, err
+		}
+
+		switch obj.Type {
+		case era.TypeCompressedBeaconState:
+			var full BeaconState
+			if err := full.UnmarshalSSZ(obj.SSZ); err != nil {
+				loghelper.LogError(err).WithField("path", path).Error("Unable to decode the BeaconState")
+				return 0, 0, false, err
+			}
+			next = &eraState{slot: full.Slot(), root: toHex(full.HashTreeRoot()), full: &full, ssz: obj.SSZ}
+		case era.TypeCompressedSignedBeaconBlock:
+			var block SignedBeaconBlock
+			if err := block.UnmarshalSSZ(obj.SSZ); err != nil {
+				loghelper.LogError(err).WithField("path", path).Error("Unable to decode the SignedBeaconBlock")
+				return 0, 0, false, err
+			}
+			ps := &ProcessSlot{
+				Slot:                  block.Block().Slot(),
+				Db:                    db,
+				Metrics:               metrics,
+				HeadOrHistoric:        "historic",
+				ProcessingStart:       time.Now(),
+				FullSignedBeaconBlock: &block,
+				SszSignedBeaconBlock:  obj.SSZ,
+				BlockRoot:             toHex(block.Block().HashTreeRoot()),
+				ParentBlockRoot:       toHex(block.Block().ParentRoot()),
+			}
+			if len(proposed) == 0 {
+				// The first block continues the previous file when it is within the era that follows it.
+				if chain.blockRoot == "" || ps.Slot < chain.nextSlot || ps.Slot >= chain.nextSlot+Slot(era.SlotsPerHistoricalRoot) {
+					previousRoot = ""
+				}
+				parentRoot = previousRoot
+			}
+			if parentRoot != "" && ps.ParentBlockRoot != parentRoot {
+				err := fmt.Errorf("The parent root of the block at slot %d is %s, the block before it is %s", ps.Slot, ps.ParentBlockRoot, parentRoot)
+				loghelper.LogSlotError(ps.Slot.Number(), err).WithField("path", path).Error("The block is not the child of the block before it")
+				return 0, 0, false, err
+			}
+			if state != nil && state.slot == ps.Slot && state.root == toHex(block.Block().StateRoot()) {
+				// The state after the block is written with it.
+				ps.FullBeaconState, ps.SszBeaconState = state.full, state.ssz
+				report.States++
+				state = nil
+			}
+			if err, errReason := ps.commitSlot(ctx, 0, "", 1, spd); err != nil {
+				loghelper.LogSlotError(ps.Slot.Number(), err).WithField("errReason", errReason).Error("Unable to write the slot")
+				return 0, 0, false, err
+			}
+			if state != nil && state.slot == ps.Slot {
+				// Standard era files hold the state before the block, its latest block is the parent.
+				written, err := writeEraBoundaryState(ctx, db, metrics, state, ps.ParentBlockRoot, false)
+				if err != nil {
+					return 0, 0, false, err
+				}
+				if written {
+					report.States++
+				}
+				state = nil
+			}
+			if err := markEraSlot(ctx, db, ps.Slot, ps.BlockRoot, "proposed"); err != nil {
+				return 0, 0, false, err
+			}
+			proposed[ps.Slot] = ps.BlockRoot
+			parentRoot = ps.BlockRoot
+			report.Proposed++
+		}
+	}
+
+	chain.state = next
+	index, ok := rd.BlockIndex()
+	if !ok {
+		return 0, 0, false, nil
+	}
+	if parentRoot != "" {
+		chain.blockRoot = parentRoot
+	}
+	startSlot := Slot(index.StartSlot)
+	endSlot := Slot(index.StartSlot + uint64(len(index.Offsets)) - 1)
+	// The root of the last proposed block before each skipped slot.
+	lastRoot := previousRoot
+	if startSlot != chain.nextSlot {
+		lastRoot = ""
+	}
+	for slot := startSlot; slot <= endSlot; slot++ {
+		if root, ok := proposed[slot]; ok {
+			lastRoot = root
+			continue
+		}
+		ps := &ProcessSlot{Slot: slot, Db: db, Metrics: metrics, HeadOrHistoric: "historic", Status: "skipped", ProcessingStart: time.Now()}
+		if err, errReason := ps.commitSlot(ctx, 0, "", 1, spd); err != nil {
+			loghelper.LogSlotError(slot.Number(), err).WithField("errReason", errReason).Error("Unable to write the skipped slot")
+			return 0, 0, false, err
+		}
+		if err := markEraSlot(ctx, db, slot, "", "skipped"); err != nil {
+			return 0, 0, false, err
+		}
+		if state != nil && state.slot == slot {
+			written, err := writeEraBoundaryState(ctx, db, metrics, state, lastRoot, true)
+			if err != nil {
+				return 0, 0, false, err
+			}
+			if written {
+				report.States++
+			}
+			state = nil
+		}
+		report.Skipped++
+	}
+	return startSlot, endSlot, true, nil
+}
+
+// Mark the rows of a slot that the era file does not contain as forked, and the row it contains with its status.
+func markEraSlot(ctx context.Context, db sql.Database, slot Slot, blockRoot string, status string) error {
+	res, err := db.Exec(ctx, markEraSlotStmt, slot.Number(), blockRoot, status)
+	if err != nil {
+		loghelper.LogSlotError(slot.Number(), err).Error("Unable to mark the rows the era file does not contain as forked")
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count > 0 {
+		log.WithFields(log.Fields{"slot": slot, "blockRoot": blockRoot, "count": count}).Info("Updated the status of the rows that the era file disagrees with")
+	}
+	return nil
+}
+
+// Write the BeaconState at the boundary of an era file, which is the state before any block at its slot is applied.
+// Its latest block must be the last proposed block before the slot, which is looked up in the DB when it is not known
+// from the era files. The state of a skipped slot is recorded on the skipped row.
+func writeEraBoundaryState(ctx context.Context, db sql.Database, metrics *BeaconClientMetrics, state *eraState, lastRoot string, skipped bool) (bool, error) {
+	if lastRoot == "" {
+		var roots []string
+		if err := db.Select(ctx, &roots, queryLastProposedRootStmt, state.slot.Number()); err != nil {
+			loghelper.LogSlotError(state.slot.Number(), err).Error("Unable to get the last proposed block before the BeaconState")
+			return false, err
+		}
+		if len(roots) > 0 {
+			lastRoot = roots[0]
+		}
+	}
+	if lastRoot != toHex(state.full.LatestBlockRoot()) {
+		log.WithFields(log.Fields{
+			"slot":      state.slot,
+			"stateRoot": state.root,
+			"lastRoot":  lastRoot,
+		}).Warn("The latest block of the BeaconState is not the last proposed block, it was not written.")
+		return false, nil
+	}
+
+	var empty []byte
+	dw, err := CreateDatabaseWrite(db, state.slot, state.root, "", "", "", nil, "skipped", &empty, &state.ssz, metrics)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err := dw.Tx.Rollback(dw.Ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction")
+		}
+	}()
+	if skipped {
+		if _, err := dw.Tx.Exec(dw.Ctx, setSkippedStateRootStmt, state.slot.Number(), state.root); err != nil {
+			loghelper.LogSlotError(state.slot.Number(), err).Error("Unable to record the BeaconState on the skipped row")
+			return false, err
+		}
+	}
+	if err := dw.transactBeaconState(); err != nil {
+		return false, err
+	}
+	if err := dw.Tx.Commit(dw.Ctx); err != nil {
+		loghelper.LogSlotError(state.slot.Number(), err).Error("Unable to write the BeaconState at the boundary of the era file")
+		return false, err
+	}
+	return true, nil
+}
+
+// Clear the known_gaps rows for an imported range. Rows within the range are removed, the covered slots of rows
+// that only overlap it are marked complete. Rows that are checked out are left to the process working on them.
+func clearImportedKnownGaps(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot) (int64, error) {
+	res, err := db.Exec(ctx, deleteCoveredKgStmt, startSlot.Number(), endSlot.Number())
+	if err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to remove the known_gaps rows for the imported range")
+		return 0, err
+	}
+	cleared, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []struct {
+		StartSlot uint64
+		EndSlot   uint64
+	}
+	if err := db.Select(ctx, &rows, queryOverlappingKgStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to get the known_gaps rows that overlap the imported range")
+		return cleared, err
+	}
+	for _, row := range rows {
+		slots := slotsToProcess{startSlot: Slot(row.StartSlot), endSlot: Slot(row.EndSlot)}
+		for slot := maxSlot(startSlot, slots.startSlot); slot <= minSlot(endSlot, slots.endSlot); slot++ {
+			if err := completeSlotInRow(db, completeKgSlotStmt, deleteKgEntryStmt, slots, slot); err != nil {
+				return cleared, err
+			}
+		}
+	}
+	return cleared, nil
+}
+
+// Sort the era files by their era number. Files that do not follow the naming scheme keep the order they were given in,
+// after the ones that do.
+func sortEraFiles(paths []string) []string {
+	sorted := append([]string{}, paths...)
+	eraNumber := func(path string) (uint64, bool) {
+		match := eraFileNumber.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			return 0, false
+		}
+		n, err := strconv.ParseUint(match[1], 10, 64)
+		return n, err == nil
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ni, oki := eraNumber(sorted[i])
+		nj, okj := eraNumber(sorted[j])
+		if oki && okj {
+			return ni < nj
+		}
+		return oki && !okj
+	})
+	return sorted
+}
+
+func minSlot(a Slot, b Slot) Slot {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxSlot(a Slot, b Slot) Slot {
+	if a > b {
+		return a
+	}
+	return b
+}
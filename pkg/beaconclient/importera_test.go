@@ -0,0 +1,151 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/snappy"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/era"
+)
+
+var _ = Describe("Importera", Label("unit", "behavioral", "era"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpTest(BeaconNodeTester.TestConfig, "99")
+	})
+
+	Context("When importing era files", func() {
+		It("Should write the proposed and skipped slots, and clear the known gaps", func() {
+			BeaconNodeTester.writeEventToKnownGaps(bc, 99, 100)
+			block, err := os.ReadFile(BeaconNodeTester.TestEvents["100"].SignedBeaconBlock)
+			Expect(err).ToNot(HaveOccurred())
+			state, err := os.ReadFile(BeaconNodeTester.TestEvents["100"].BeaconState)
+			Expect(err).ToNot(HaveOccurred())
+
+			// The state of the first file is the state at the first slot of the second file.
+			dir := GinkgoT().TempDir()
+			first := filepath.Join(dir, "test-00000-00000000.era")
+			second := filepath.Join(dir, "test-00001-00000000.era")
+			writeEraFile(first, eraEntry{era.TypeCompressedBeaconState, compressEra(state)}, eraEntry{era.TypeSlotIndex, eraSlotIndex(100, -24)})
+			writeEraFile(second, eraEntry{era.TypeCompressedSignedBeaconBlock, compressEra(block)}, eraEntry{era.TypeSlotIndex, eraSlotIndex(99, 0, 8)})
+
+			report, err := beaconclient.ImportEra(context.Background(), bc.Db, bc.Metrics, []string{second, first})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Files).To(Equal(2))
+			Expect(report.StartSlot).To(Equal(uint64(99)))
+			Expect(report.EndSlot).To(Equal(uint64(100)))
+			Expect(report.Proposed).To(Equal(uint64(1)))
+			Expect(report.Skipped).To(Equal(uint64(1)))
+			Expect(report.States).To(Equal(uint64(1)))
+			Expect(report.KnownGapsCleared).To(Equal(int64(1)))
+			Expect(countKnownGapsTable(bc.Db)).To(Equal(0))
+
+			head := BeaconNodeTester.TestEvents["100"].HeadMessage
+			validateSlot(bc, head, 3, "proposed")
+			validateBeaconState(bc, head, BeaconNodeTester.TestEvents["100"].CorrectBeaconStateMhKey)
+			validateSlot(bc, beaconclient.Head{Slot: "99"}, 3, "skipped")
+		})
+		It("Should mark the rows the era files do not contain as forked", func() {
+			dummy := BeaconNodeTester.TestEvents["100-dummy"].HeadMessage
+			insertSlotStmt := `INSERT INTO eth_beacon.slots (epoch, slot, block_root, state_root, status) VALUES ($1, $2, $3, $4, 'proposed')`
+			_, err := bc.Db.Exec(context.Background(), insertSlotStmt, 3, 100, dummy.Block, dummy.State)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = bc.Db.Exec(context.Background(), insertSlotStmt, 3, 99, "0x99", "0x99")
+			Expect(err).ToNot(HaveOccurred())
+			block, err := os.ReadFile(BeaconNodeTester.TestEvents["100"].SignedBeaconBlock)
+			Expect(err).ToNot(HaveOccurred())
+
+			path := filepath.Join(GinkgoT().TempDir(), "test-00001-00000000.era")
+			writeEraFile(path, eraEntry{era.TypeCompressedSignedBeaconBlock, compressEra(block)}, eraEntry{era.TypeSlotIndex, eraSlotIndex(99, 0, 8)})
+
+			_, err = beaconclient.ImportEra(context.Background(), bc.Db, bc.Metrics, []string{path})
+			Expect(err).ToNot(HaveOccurred())
+			validateSlot(bc, BeaconNodeTester.TestEvents["100"].HeadMessage, 3, "proposed")
+			validateSlot(bc, dummy, 3, "forked")
+			validateSlot(bc, beaconclient.Head{Slot: "99", Block: "0x99", State: "0x99"}, 3, "forked")
+			validateSlot(bc, beaconclient.Head{Slot: "99"}, 3, "skipped")
+		})
+		It("Should stop at a block that is not the child of the block before it", func() {
+			first, err := os.ReadFile(BeaconNodeTester.TestEvents["101"].SignedBeaconBlock)
+			Expect(err).ToNot(HaveOccurred())
+			second, err := os.ReadFile(BeaconNodeTester.TestEvents["100"].SignedBeaconBlock)
+			Expect(err).ToNot(HaveOccurred())
+
+			path := filepath.Join(GinkgoT().TempDir(), "test-00001-00000000.era")
+			writeEraFile(path, eraEntry{era.TypeCompressedSignedBeaconBlock, compressEra(first)},
+				eraEntry{era.TypeCompressedSignedBeaconBlock, compressEra(second)}, eraEntry{era.TypeSlotIndex, eraSlotIndex(100, 0, 8)})
+
+			_, err = beaconclient.ImportEra(context.Background(), bc.Db, bc.Metrics, []string{path})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("The parent root of the block at slot 100"))
+		})
+	})
+})
+
+var _ = Describe("Sorting era files", Label("unit"), func() {
+	It("Should order the files by their era number", func() {
+		sorted := beaconclient.SortEraFiles([]string{"dir/mainnet-00010-5ec1ffb8.era", "b.era", "mainnet-00002-4b363db9.era", "a.era", "dir/mainnet-00001-40cf2f3c.era"})
+		Expect(sorted).To(Equal([]string{"dir/mainnet-00001-40cf2f3c.era", "mainnet-00002-4b363db9.era", "dir/mainnet-00010-5ec1ffb8.era", "b.era", "a.era"}))
+	})
+})
+
+// A single entry of an era file.
+type eraEntry struct {
+	entryType [2]byte
+	data      []byte
+}
+
+// Write an era file containing the version entry followed by the provided entries.
+func writeEraFile(path string, entries ...eraEntry) {
+	var buf bytes.Buffer
+	for _, entry := range append([]eraEntry{{era.TypeVersion, nil}}, entries...) {
+		header := make([]byte, 8)
+		copy(header, entry.entryType[:])
+		binary.LittleEndian.PutUint32(header[2:], uint32(len(entry.data)))
+		buf.Write(header)
+		buf.Write(entry.data)
+	}
+	Expect(os.WriteFile(path, buf.Bytes(), 0644)).To(Succeed())
+}
+
+// Compress an SSZ object using the snappy framing format.
+func compressEra(data []byte) []byte {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	_, err := w.Write(data)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// Encode an era slot index.
+func eraSlotIndex(startSlot uint64, offsets ...int64) []byte {
+	data := make([]byte, 16+8*len(offsets))
+	binary.LittleEndian.PutUint64(data, startSlot)
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(data[8+8*i:], uint64(offset))
+	}
+	binary.LittleEndian.PutUint64(data[len(data)-8:], uint64(len(offsets)))
+	return data
+}
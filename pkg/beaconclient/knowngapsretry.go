@@ -0,0 +1,145 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the retry policy for eth_beacon.known_gaps entries that fail to be reprocessed.
+
+package beaconclient
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Record a failed attempt to reprocess an entry, and back off before it can be checked out again.
+	recordKgFailureStmt string = `UPDATE eth_beacon.known_gaps
+	SET reprocessing_error=$3, priority=priority+1, attempts=attempts+1,
+	next_attempt_at=now() + make_interval(secs => LEAST($4 * power(2, LEAST(attempts, 30)), $5))
+	WHERE start_slot=$1 AND end_slot=$2
+	RETURNING attempts;`
+	// Used to release a single entry once its failure has been recorded.
+	releaseKgEntryStmt string = `UPDATE eth_beacon.known_gaps
+	SET checked_out=false, checked_out_by=null, checked_out_at=null
+	WHERE start_slot=$1 AND end_slot=$2`
+	// Record slots the beacon server does not have yet as their own entry, which waits before it can be checked out.
+	insertDeferredKgEntryStmt string = `INSERT INTO eth_beacon.known_gaps (start_slot, end_slot, checked_out, entry_error, entry_process, next_attempt_at)
+	VALUES ($1, $2, false, $3, $4, now() + make_interval(secs => $5))
+	ON CONFLICT (start_slot, end_slot) DO NOTHING;`
+	// Release an entry whose slots the beacon server does not have yet, without counting an attempt.
+	releaseDeferredKgEntryStmt string = `UPDATE eth_beacon.known_gaps
+	SET checked_out=false, checked_out_by=null, checked_out_at=null, next_attempt_at=now() + make_interval(secs => $3)
+	WHERE start_slot=$1 AND end_slot=$2`
+	// Move an entry that has exhausted its attempts to the dead letter table.
+	deadLetterKgEntryStmt string = `WITH moved AS (
+		DELETE FROM eth_beacon.known_gaps
+		WHERE start_slot=$1 AND end_slot=$2
+		RETURNING start_slot, end_slot, attempts, reprocessing_error, entry_error, entry_process, entry_time
+	)
+	INSERT INTO eth_beacon.known_gaps_dead_letter (start_slot, end_slot, attempts, last_error, error_class, response_status,
+	entry_error, entry_process, entry_time)
+	SELECT start_slot, end_slot, attempts, reprocessing_error, $3, $4, entry_error, entry_process, entry_time FROM moved
+	ON CONFLICT (start_slot, end_slot) DO UPDATE
+	SET attempts=EXCLUDED.attempts, last_error=EXCLUDED.last_error, error_class=EXCLUDED.error_class,
+	response_status=EXCLUDED.response_status, dead_lettered_at=now();`
+)
+
+// How many times a known_gaps entry is reprocessed, and how long to wait between attempts.
+type RetryPolicy struct {
+	MaxAttempts int           // The number of failed attempts before an entry is moved to the dead letter table, 0 means unlimited.
+	Backoff     time.Duration // The wait after the first failed attempt, it doubles after every failed attempt.
+	MaxBackoff  time.Duration // The longest wait between attempts.
+}
+
+// The retry policy to use, invalid durations fall back to the defaults.
+func (bc *BeaconClient) knownGapsRetryPolicy() RetryPolicy {
+	policy := bc.KnownGapsRetryPolicy
+	if policy.Backoff <= 0 {
+		policy.Backoff = bcDefaultRetryBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = bcDefaultMaxRetryBackoff
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+	return policy
+}
+
+// Has an entry with the given number of failed attempts exhausted the policy.
+func (p RetryPolicy) isExhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// Determine the class of the error, and the status of the response that caused it, if there was one.
+func classifyError(err error, errProcess string) (string, *int) {
+	var slotErr *SlotError
+	if errors.As(err, &slotErr) {
+		if slotErr.StatusCode == 0 {
+			return slotErr.Class, nil
+		}
+		status := slotErr.StatusCode
+		return slotErr.Class, &status
+	}
+	if errProcess == "" {
+		return "unknown", nil
+	}
+	return errProcess, nil
+}
+
+// Record a failed attempt to reprocess a single slot entry in eth_beacon.known_gaps. If the entry has
+// exhausted its attempts, it is moved to the dead letter table. Otherwise it is released when release is true,
+// so it can be checked out again once the backoff has passed.
+func recordKnownGapFailure(db sql.Database, slot Slot, reprocessingErr error, errProcess string, policy RetryPolicy, release bool, metric *BeaconClientMetrics) error {
+	var attempts int
+	err := db.QueryRow(context.Background(), recordKgFailureStmt, slot.Number(), slot.Number(), reprocessingErr.Error(),
+		policy.Backoff.Seconds(), policy.MaxBackoff.Seconds()).Scan(&attempts)
+	if err != nil {
+		loghelper.LogSlotError(slot.Number(), err).Error("Unable to record the failed attempt for the known gap")
+		return err
+	}
+	metric.IncrementKnownGapsReprocessError(1)
+
+	if policy.isExhausted(attempts) {
+		errorClass, responseStatus := classifyError(reprocessingErr, errProcess)
+		if _, err := db.Exec(context.Background(), deadLetterKgEntryStmt, slot.Number(), slot.Number(), errorClass, responseStatus); err != nil {
+			loghelper.LogSlotError(slot.Number(), err).Error("Unable to move the known gap to the dead letter table")
+			return err
+		}
+		metric.IncrementKnownGapsDeadLettered(1)
+		log.WithFields(log.Fields{
+			"slot":       slot,
+			"attempts":   attempts,
+			"errorClass": errorClass,
+		}).Error("The known gap has exhausted its attempts, moved it to the dead letter table")
+		return nil
+	}
+
+	if release {
+		if _, err := db.Exec(context.Background(), releaseKgEntryStmt, slot.Number(), slot.Number()); err != nil {
+			loghelper.LogSlotError(slot.Number(), err).Error("Unable to release the known gap")
+			return err
+		}
+	}
+	log.WithFields(log.Fields{
+		"slot":     slot,
+		"attempts": attempts,
+	}).Warn("Recorded a failed attempt to reprocess the known gap")
+	return nil
+}
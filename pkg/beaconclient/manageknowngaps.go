@@ -0,0 +1,181 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions operators use to inspect and manage the eth_beacon.known_gaps table.
+
+package beaconclient
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// The columns returned when listing known_gaps entries.
+	listKgEntriesStmt string = `SELECT start_slot, end_slot, checked_out, checked_out_by, reprocessing_error,
+	entry_error, entry_time, entry_process, priority, attempts, next_attempt_at
+	FROM eth_beacon.known_gaps`
+	// Used to make the selected entries available to known gaps processing again, with their attempts reset.
+	requeueKgEntriesStmt string = `UPDATE eth_beacon.known_gaps
+	SET checked_out=false, checked_out_by=null, checked_out_at=null, reprocessing_error=null, attempts=0, next_attempt_at=null`
+	// The entries a node is still processing, they are left out of a requeue.
+	liveLeaseKgCondition string = `(checked_out=false OR checked_out_at < now() - make_interval(secs => $?))`
+	// Used to update the priority of the selected entries.
+	priorityKgEntriesStmt string = `UPDATE eth_beacon.known_gaps
+	SET priority=$1`
+	// Used to delete the selected entries.
+	deleteKgEntriesStmt string = `DELETE FROM eth_beacon.known_gaps`
+)
+
+// A single row within the eth_beacon.known_gaps table.
+type KnownGapEntry struct {
+	StartSlot         uint64     // The start slot, inclusive.
+	EndSlot           uint64     // The end slot, inclusive.
+	CheckedOut        bool       // Is a node currently processing this entry.
+	CheckedOutBy      *int       // The unique identifier of the node processing this entry.
+	ReprocessingError *string    // The error from the last attempt to process this entry.
+	EntryError        *string    // The error that caused this entry to be added.
+	EntryTime         time.Time  // When this entry was added.
+	EntryProcess      *string    // The process that added this entry.
+	Priority          *int       // Entries with a lower priority are processed first.
+	Attempts          int        // The number of failed attempts to reprocess this entry.
+	NextAttemptAt     *time.Time // The entry is not processed again before this time.
+}
+
+// Selects the known_gaps entries to operate on. Empty fields are ignored.
+type KnownGapsFilter struct {
+	StartSlot    *uint64 // Only select entries starting at or after this slot.
+	EndSlot      *uint64 // Only select entries ending at or before this slot.
+	Process      string  // Only select entries added by this process.
+	ErrorText    string  // Only select entries whose entry_error or reprocessing_error contains this text.
+	CheckedOutBy *int    // Only select entries checked out by this node.
+}
+
+// Does the filter select every entry.
+func (f KnownGapsFilter) IsEmpty() bool {
+	return f == KnownGapsFilter{}
+}
+
+// Build the WHERE clause for the filter. Placeholders are numbered after the args that are already in use.
+func (f KnownGapsFilter) whereClause(args []interface{}) (string, []interface{}) {
+	var conditions []string
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+	if f.StartSlot != nil {
+		add("start_slot >= $?", *f.StartSlot)
+	}
+	if f.EndSlot != nil {
+		add("end_slot <= $?", *f.EndSlot)
+	}
+	if f.Process != "" {
+		add("entry_process = $?", f.Process)
+	}
+	if f.ErrorText != "" {
+		add("(entry_error ILIKE '%' || $? || '%' OR reprocessing_error ILIKE '%' || $? || '%')", f.ErrorText)
+	}
+	if f.CheckedOutBy != nil {
+		add("checked_out_by = $?", *f.CheckedOutBy)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List the known_gaps entries selected by the filter, highest priority first.
+func ListKnownGaps(ctx context.Context, db sql.Database, filter KnownGapsFilter) ([]KnownGapEntry, error) {
+	return listKnownGaps(ctx, db, filter, 0, 0)
+}
+
+// List a page of the known_gaps entries selected by the filter, a limit of 0 returns every entry after the offset.
+func listKnownGaps(ctx context.Context, db sql.Database, filter KnownGapsFilter, limit int, offset int) ([]KnownGapEntry, error) {
+	where, args := filter.whereClause(nil)
+	query := listKgEntriesStmt + where + " ORDER BY priority ASC, start_slot ASC"
+	if limit > 0 {
+		args = append(args, limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	if offset > 0 {
+		args = append(args, offset)
+		query += " OFFSET $" + strconv.Itoa(len(args))
+	}
+	var entries []KnownGapEntry
+	if err := db.Select(ctx, &entries, query, args...); err != nil {
+		loghelper.LogError(err).Error("Unable to list the eth_beacon.known_gaps entries")
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Release the selected entries, clear their reprocessing_error and reset their attempts, so known gaps processing
+// picks them up again. Entries checked out by a node whose lease has not expired are skipped, so they are not
+// processed twice. A lease duration of 0 uses the default.
+func RequeueKnownGaps(ctx context.Context, db sql.Database, filter KnownGapsFilter, leaseDuration time.Duration) (int64, error) {
+	if leaseDuration <= 0 {
+		leaseDuration = bcDefaultCheckoutLease
+	}
+	where, args := filter.whereClause(nil)
+	args = append(args, leaseDuration.Seconds())
+	condition := strings.ReplaceAll(liveLeaseKgCondition, "$?", "$"+strconv.Itoa(len(args)))
+	if where == "" {
+		where = " WHERE " + condition
+	} else {
+		where += " AND " + condition
+	}
+	return execKnownGapsStmt(ctx, db, "requeue", requeueKgEntriesStmt+where, args...)
+}
+
+// Set the priority of the selected entries.
+func SetKnownGapsPriority(ctx context.Context, db sql.Database, filter KnownGapsFilter, priority int) (int64, error) {
+	where, args := filter.whereClause([]interface{}{priority})
+	return execKnownGapsStmt(ctx, db, "priority", priorityKgEntriesStmt+where, args...)
+}
+
+// Delete the selected entries. This should only be used for gaps that are confirmed resolved.
+func DeleteKnownGaps(ctx context.Context, db sql.Database, filter KnownGapsFilter) (int64, error) {
+	where, args := filter.whereClause(nil)
+	return execKnownGapsStmt(ctx, db, "delete", deleteKgEntriesStmt+where, args...)
+}
+
+// Release every entry checked out by the given node. This is what a node does when it shuts down gracefully.
+func ReleaseKnownGaps(ctx context.Context, db sql.Database, uniqueNodeIdentifier int) (int64, error) {
+	return execKnownGapsStmt(ctx, db, "release", releaseKgLockStmt, uniqueNodeIdentifier)
+}
+
+// Execute a statement against the known_gaps table and return the number of entries it affected.
+func execKnownGapsStmt(ctx context.Context, db sql.Database, operation string, stmt string, args ...interface{}) (int64, error) {
+	res, err := db.Exec(ctx, stmt, args...)
+	if err != nil {
+		loghelper.LogError(err).WithField("operation", operation).Error("Unable to update the eth_beacon.known_gaps table")
+		return 0, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.WithFields(log.Fields{
+		"operation": operation,
+		"entries":   rows,
+	}).Info("Updated the eth_beacon.known_gaps table")
+	return rows, nil
+}
@@ -0,0 +1,77 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Manageknowngaps", Label("unit", "behavioral", "manage"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpTest(BeaconNodeTester.TestConfig, "99")
+	})
+
+	Context("When managing the entries in the eth_beacon.known_gaps table", func() {
+		It("Should only operate on the selected entries", func() {
+			BeaconNodeTester.writeEventToKnownGaps(bc, 100, 101)
+			BeaconNodeTester.writeEventToKnownGaps(bc, 200, 201)
+			ctx := context.Background()
+
+			entries, err := beaconclient.ListKnownGaps(ctx, bc.Db, beaconclient.KnownGapsFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+
+			startSlot := uint64(150)
+			rows, err := beaconclient.SetKnownGapsPriority(ctx, bc.Db, beaconclient.KnownGapsFilter{StartSlot: &startSlot}, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(1)))
+			entries, err = beaconclient.ListKnownGaps(ctx, bc.Db, beaconclient.KnownGapsFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries[0].StartSlot).To(Equal(uint64(200)))
+
+			rows, err = beaconclient.DeleteKnownGaps(ctx, bc.Db, beaconclient.KnownGapsFilter{StartSlot: &startSlot})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(1)))
+			entries, err = beaconclient.ListKnownGaps(ctx, bc.Db, beaconclient.KnownGapsFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].StartSlot).To(Equal(uint64(100)))
+		})
+		It("Should not requeue the entries with a live lease", func() {
+			BeaconNodeTester.writeEventToKnownGaps(bc, 100, 101)
+			BeaconNodeTester.writeEventToKnownGaps(bc, 200, 201)
+			ctx := context.Background()
+			_, err := bc.Db.Exec(ctx, `UPDATE eth_beacon.known_gaps SET checked_out=true, checked_out_by=5, checked_out_at=now() WHERE start_slot=100`)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = bc.Db.Exec(ctx, `UPDATE eth_beacon.known_gaps SET checked_out=true, checked_out_by=5, checked_out_at=now() - interval '1 hour' WHERE start_slot=200`)
+			Expect(err).ToNot(HaveOccurred())
+
+			rows, err := beaconclient.RequeueKnownGaps(ctx, bc.Db, beaconclient.KnownGapsFilter{}, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rows).To(Equal(int64(1)))
+
+			var checkedOut []uint64
+			err = bc.Db.Select(ctx, &checkedOut, `SELECT start_slot FROM eth_beacon.known_gaps WHERE checked_out=true`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkedOut).To(Equal([]uint64{100}))
+		})
+	})
+})
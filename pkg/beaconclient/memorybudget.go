@@ -0,0 +1,265 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the memory budget that is shared by every goroutine processing slots.
+
+package beaconclient
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// Each downloaded object is held as SSZ bytes and as a decoded object, so we reserve
+	// this many times the Content-Length of the response.
+	memoryBudgetDecodeFactor int64 = 2
+	// The number of bytes to reserve when the beacon server does not provide a Content-Length.
+	memoryBudgetUnknownSize int64 = 64 * 1024 * 1024
+)
+
+// A byte denominated budget that every slot processing goroutine acquires from before downloading
+// a SignedBeaconBlock or BeaconState. A limit of 0 means the budget is unlimited, but usage is still tracked.
+type MemoryBudget struct {
+	mu       sync.Mutex
+	limit    int64                // The maximum number of bytes that can be reserved at once.
+	inUse    int64                // The number of bytes currently reserved.
+	released chan struct{}        // Closed, and replaced, whenever bytes are released.
+	metrics  *BeaconClientMetrics // Used to expose the budget's usage.
+}
+
+// Create a new MemoryBudget with the provided limit in bytes.
+func CreateMemoryBudget(limit int64, metrics *BeaconClientMetrics) *MemoryBudget {
+	mb := &MemoryBudget{
+		released: make(chan struct{}),
+		metrics:  metrics,
+	}
+	mb.SetLimit(limit)
+	return mb
+}
+
+// Update the maximum number of bytes that can be reserved at once.
+func (mb *MemoryBudget) SetLimit(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	mb.mu.Lock()
+	mb.limit = limit
+	mb.notify()
+	mb.mu.Unlock()
+	if mb.metrics != nil {
+		mb.metrics.SetMemoryBudgetLimit(limit)
+	}
+	log.WithField("limit", limit).Info("Updated the memory budget for slot processing")
+}
+
+// Return the maximum number of bytes that can be reserved at once.
+func (mb *MemoryBudget) Limit() int64 {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.limit
+}
+
+// Return the number of bytes currently reserved.
+func (mb *MemoryBudget) InUse() int64 {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.inUse
+}
+
+// Reserve the provided number of bytes, waiting until they are available or the context is cancelled.
+// A reservation larger than the limit is only granted once nothing else is reserved.
+func (mb *MemoryBudget) Acquire(ctx context.Context, size int64) error {
+	waited := false
+	for {
+		mb.mu.Lock()
+		if mb.limit == 0 || mb.inUse == 0 || mb.inUse+size <= mb.limit {
+			mb.inUse += size
+			inUse := mb.inUse
+			mb.mu.Unlock()
+			if mb.metrics != nil {
+				mb.metrics.SetMemoryBudgetInUse(inUse)
+				if waited {
+					mb.metrics.IncrementMemoryBudgetWaits(1)
+				}
+			}
+			return nil
+		}
+		released := mb.released
+		mb.mu.Unlock()
+
+		if !waited {
+			log.WithFields(log.Fields{"size": size}).Debug("Waiting for the memory budget to free up")
+			waited = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// Release bytes that were previously reserved.
+func (mb *MemoryBudget) Release(size int64) {
+	if size <= 0 {
+		return
+	}
+	mb.mu.Lock()
+	mb.inUse -= size
+	if mb.inUse < 0 {
+		mb.inUse = 0
+	}
+	inUse := mb.inUse
+	mb.notify()
+	mb.mu.Unlock()
+	if mb.metrics != nil {
+		mb.metrics.SetMemoryBudgetInUse(inUse)
+	}
+}
+
+// Wake every goroutine waiting on the budget. The caller must hold the lock.
+func (mb *MemoryBudget) notify() {
+	close(mb.released)
+	mb.released = make(chan struct{})
+}
+
+// Keeps track of the bytes a single slot has reserved, so they can be released together.
+//
+// A slot downloads its SignedBeaconBlock and BeaconState concurrently. Each download reports its Content-Length,
+// and once every download has reported, the total is acquired from the budget in one step. Acquiring
+// the total at once ensures that a slot never holds part of the budget while waiting for the rest.
+type memoryReservation struct {
+	ctx      context.Context
+	budget   *MemoryBudget
+	mu       sync.Mutex
+	pending  int           // The number of downloads that have not reported their size yet.
+	size     int64         // The total number of bytes requested by the downloads.
+	reserved int64         // The number of bytes acquired from the budget.
+	ready    chan struct{} // Closed once the budget has been acquired, or failed to be acquired.
+	err      error         // The error from acquiring the budget.
+	turn     *memoryTurn   // When set, the budget is only acquired once the reservations before it have been.
+}
+
+// The place of a reservation in a sequence of reservations that must acquire from the budget in order.
+//
+// Head slots are committed in the order they were received, and each slot holds its memory until it is committed.
+// If a later slot could acquire the budget first, an earlier slot might wait for memory that is only released
+// once the earlier slot is committed. Taking turns ensures the earlier slots always hold their memory first.
+type memoryTurn struct {
+	previous <-chan struct{} // Closed once the previous reservation has acquired, or will not acquire, from the budget.
+	done     chan struct{}   // Closed once this reservation has acquired, or will not acquire, from the budget.
+	once     sync.Once
+}
+
+// Create the turn that follows this one. A nil turn starts a new sequence.
+func (mt *memoryTurn) next() *memoryTurn {
+	next := &memoryTurn{done: make(chan struct{})}
+	if mt != nil {
+		next.previous = mt.done
+	}
+	return next
+}
+
+// Wait until the previous reservation in the sequence has taken its turn.
+func (mt *memoryTurn) wait(ctx context.Context) error {
+	if mt == nil || mt.previous == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-mt.previous:
+		return nil
+	}
+}
+
+// Let the next reservation in the sequence take its turn. It is safe to call more than once.
+func (mt *memoryTurn) finish() {
+	if mt == nil {
+		return
+	}
+	mt.once.Do(func() { close(mt.done) })
+}
+
+// Create a reservation for a single slot that will perform the given number of downloads.
+// A nil budget results in a reservation that does nothing. The turn is optional.
+func (mb *MemoryBudget) newReservation(ctx context.Context, downloads int, turn *memoryTurn) *memoryReservation {
+	if mb == nil || downloads <= 0 {
+		turn.finish()
+		return nil
+	}
+	return &memoryReservation{ctx: ctx, budget: mb, pending: downloads, ready: make(chan struct{}), turn: turn}
+}
+
+// Report the Content-Length of a download and wait until the memory for every download of the slot
+// has been acquired. A negative length means it is unknown.
+func (mr *memoryReservation) acquire(contentLength int64) error {
+	if mr == nil {
+		return nil
+	}
+	size := memoryBudgetUnknownSize
+	if contentLength >= 0 {
+		size = contentLength * memoryBudgetDecodeFactor
+	}
+
+	mr.mu.Lock()
+	mr.size += size
+	mr.pending -= 1
+	last := mr.pending == 0
+	mr.mu.Unlock()
+
+	if last {
+		mr.err = mr.turn.wait(mr.ctx)
+		if mr.err == nil {
+			mr.err = mr.budget.Acquire(mr.ctx, mr.size)
+		}
+		if mr.err == nil {
+			mr.reserved = mr.size
+		}
+		mr.turn.finish()
+		close(mr.ready)
+	}
+
+	select {
+	case <-mr.ctx.Done():
+		return mr.ctx.Err()
+	case <-mr.ready:
+		return mr.err
+	}
+}
+
+// Report a download that failed before its body was read, so the other downloads of the slot are not kept waiting.
+func (mr *memoryReservation) skip() {
+	_ = mr.acquire(0)
+}
+
+// Release everything held by this reservation.
+func (mr *memoryReservation) release() {
+	if mr == nil {
+		return
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	// A reservation released before every download reported will never acquire from the budget.
+	mr.turn.finish()
+	if mr.pending == 0 {
+		<-mr.ready
+		mr.budget.Release(mr.reserved)
+		mr.reserved = 0
+	}
+}
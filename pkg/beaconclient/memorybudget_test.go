@@ -0,0 +1,128 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	beaconclient "github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Memorybudget", Label("unit"), func() {
+	var (
+		metrics *beaconclient.BeaconClientMetrics
+		budget  *beaconclient.MemoryBudget
+	)
+
+	BeforeEach(func() {
+		var err error
+		metrics, err = beaconclient.CreateBeaconClientMetrics()
+		Expect(err).ToNot(HaveOccurred())
+		budget = beaconclient.CreateMemoryBudget(100, metrics)
+	})
+
+	Describe("Acquiring memory within the limit", func() {
+		It("Should not block and should update the metrics", func() {
+			Expect(budget.Acquire(context.Background(), 60)).To(Succeed())
+			Expect(budget.Acquire(context.Background(), 40)).To(Succeed())
+			Expect(budget.InUse()).To(Equal(int64(100)))
+			Expect(atomic.LoadInt64(&metrics.MemoryBudgetInUse)).To(Equal(int64(100)))
+			Expect(atomic.LoadInt64(&metrics.MemoryBudgetLimit)).To(Equal(int64(100)))
+
+			budget.Release(100)
+			Expect(budget.InUse()).To(Equal(int64(0)))
+			Expect(atomic.LoadInt64(&metrics.MemoryBudgetInUse)).To(Equal(int64(0)))
+		})
+	})
+
+	Describe("Acquiring memory beyond the limit", func() {
+		It("Should wait until memory is released", func() {
+			Expect(budget.Acquire(context.Background(), 80)).To(Succeed())
+
+			acquired := make(chan error)
+			go func() {
+				acquired <- budget.Acquire(context.Background(), 50)
+			}()
+			Consistently(acquired, 100*time.Millisecond).ShouldNot(Receive())
+
+			budget.Release(80)
+			Eventually(acquired).Should(Receive(BeNil()))
+			Expect(budget.InUse()).To(Equal(int64(50)))
+			Expect(atomic.LoadUint64(&metrics.MemoryBudgetWaits)).To(Equal(uint64(1)))
+		})
+		It("Should return an error when the context is cancelled", func() {
+			Expect(budget.Acquire(context.Background(), 80)).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			acquired := make(chan error)
+			go func() {
+				acquired <- budget.Acquire(ctx, 50)
+			}()
+			cancel()
+			Eventually(acquired).Should(Receive(MatchError(context.Canceled)))
+			Expect(budget.InUse()).To(Equal(int64(80)))
+		})
+		It("Should grant a request larger than the limit once nothing else is reserved", func() {
+			Expect(budget.Acquire(context.Background(), 150)).To(Succeed())
+			Expect(budget.InUse()).To(Equal(int64(150)))
+		})
+	})
+
+	Describe("Acquiring memory for head slots that are fetched out of order", func() {
+		It("Should give the memory to the earlier slot first", func() {
+			// Each download reserves twice its Content-Length, so either slot fills the budget.
+			reservations := budget.NewHeadReservations(context.Background(), 2)
+			later := make(chan error)
+			go func() {
+				later <- reservations[1].Acquire(50)
+			}()
+			Consistently(later, 100*time.Millisecond).ShouldNot(Receive())
+			Expect(budget.InUse()).To(Equal(int64(0)))
+
+			// The earlier slot must not wait on the later one, which is only released after the earlier one is committed.
+			earlier := make(chan error)
+			go func() {
+				earlier <- reservations[0].Acquire(50)
+			}()
+			Eventually(earlier).Should(Receive(BeNil()))
+			Consistently(later, 100*time.Millisecond).ShouldNot(Receive())
+
+			reservations[0].Release()
+			Eventually(later).Should(Receive(BeNil()))
+			reservations[1].Release()
+			Expect(budget.InUse()).To(Equal(int64(0)))
+		})
+		It("Should not keep the later slot waiting when the earlier slot acquires nothing", func() {
+			reservations := budget.NewHeadReservations(context.Background(), 2)
+			reservations[0].Release()
+			Expect(reservations[1].Acquire(50)).To(Succeed())
+			Expect(budget.InUse()).To(Equal(int64(100)))
+		})
+	})
+
+	Describe("Using an unlimited budget", func() {
+		It("Should never block", func() {
+			budget.SetLimit(0)
+			Expect(budget.Acquire(context.Background(), 1000)).To(Succeed())
+			Expect(budget.Acquire(context.Background(), 1000)).To(Succeed())
+			Expect(budget.InUse()).To(Equal(int64(2000)))
+		})
+	})
+})
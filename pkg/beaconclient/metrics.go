@@ -66,6 +66,30 @@ func CreateBeaconClientMetrics() (*BeaconClientMetrics, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = prometheusRegisterHelper("memory_budget_waits", "Keeps track of the number of times a slot had to wait for the memory budget.", &metrics.MemoryBudgetWaits)
+	if err != nil {
+		return nil, err
+	}
+	err = prometheusRegisterHelper("leases_reclaimed", "Keeps track of the number of checked out rows we reclaimed after their lease expired.", &metrics.LeasesReclaimed)
+	if err != nil {
+		return nil, err
+	}
+	err = prometheusRegisterHelper("known_gaps_dead_lettered", "Keeps track of the number of known_gaps entries moved to the dead letter table after exhausting their attempts.", &metrics.KnownGapsDeadLettered)
+	if err != nil {
+		return nil, err
+	}
+	err = prometheusRegisterHelper("head_late_events", "Keeps track of the number of head events that arrived after an event for a later slot.", &metrics.HeadLateEvents)
+	if err != nil {
+		return nil, err
+	}
+	err = prometheusRegisterGaugeHelper("memory_budget_limit_bytes", "The maximum number of bytes slot processing can reserve at once, 0 means unlimited.", &metrics.MemoryBudgetLimit)
+	if err != nil {
+		return nil, err
+	}
+	err = prometheusRegisterGaugeHelper("memory_budget_in_use_bytes", "The number of bytes currently reserved by slot processing.", &metrics.MemoryBudgetInUse)
+	if err != nil {
+		return nil, err
+	}
 	return metrics, nil
 }
 
@@ -88,6 +112,25 @@ func prometheusRegisterHelper(name string, help string, varPointer *uint64) erro
 	return nil
 }
 
+func prometheusRegisterGaugeHelper(name string, help string, varPointer *int64) error {
+	err := prometheus.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   "beacon_client",
+			Subsystem:   "",
+			Name:        name,
+			Help:        help,
+			ConstLabels: map[string]string{},
+		},
+		func() float64 {
+			return float64(atomic.LoadInt64(varPointer))
+		}))
+	if err != nil && err.Error() != "duplicate metrics collector registration attempted" {
+		loghelper.LogError(err).WithField("name", name).Error("Unable to register gauge.")
+		return err
+	}
+	return nil
+}
+
 // A structure utilized for keeping track of various metrics. Currently, mostly used in testing.
 type BeaconClientMetrics struct {
 	SlotInserts             uint64 // Number of head events we successfully wrote to the DB.
@@ -98,6 +141,12 @@ type BeaconClientMetrics struct {
 	HistoricSlotProcessed   uint64 // Number of historic slots successfully processed.
 	HeadError               uint64 // Number of errors that occurred when decoding the head message.
 	HeadReorgError          uint64 // Number of errors that occurred when decoding the reorg message.
+	MemoryBudgetWaits       uint64 // Number of times a slot had to wait for the memory budget.
+	LeasesReclaimed         uint64 // Number of checked out rows reclaimed after their lease expired.
+	KnownGapsDeadLettered   uint64 // Number of known_gaps entries moved to the dead letter table.
+	HeadLateEvents          uint64 // Number of head events that arrived after an event for a later slot.
+	MemoryBudgetLimit       int64  // The maximum number of bytes that can be reserved by slot processing.
+	MemoryBudgetInUse       int64  // The number of bytes currently reserved by slot processing.
 }
 
 // Wrapper function to increment inserts. If we want to use mutexes later we can easily update all
@@ -148,3 +197,33 @@ func (m *BeaconClientMetrics) IncrementKnownGapsReprocessError(inc uint64) {
 func (m *BeaconClientMetrics) IncrementHistoricSlotProcessed(inc uint64) {
 	atomic.AddUint64(&m.HistoricSlotProcessed, inc)
 }
+
+// Wrapper function to increment the number of times a slot waited for the memory budget.
+func (m *BeaconClientMetrics) IncrementMemoryBudgetWaits(inc uint64) {
+	atomic.AddUint64(&m.MemoryBudgetWaits, inc)
+}
+
+// Wrapper function to increment the number of checked out rows we reclaimed.
+func (m *BeaconClientMetrics) IncrementLeasesReclaimed(inc uint64) {
+	atomic.AddUint64(&m.LeasesReclaimed, inc)
+}
+
+// Wrapper function to increment the number of known_gaps entries moved to the dead letter table.
+func (m *BeaconClientMetrics) IncrementKnownGapsDeadLettered(inc uint64) {
+	atomic.AddUint64(&m.KnownGapsDeadLettered, inc)
+}
+
+// Wrapper function to set the memory budget limit.
+func (m *BeaconClientMetrics) SetMemoryBudgetLimit(limit int64) {
+	atomic.StoreInt64(&m.MemoryBudgetLimit, limit)
+}
+
+// Wrapper function to set the number of bytes reserved from the memory budget.
+func (m *BeaconClientMetrics) SetMemoryBudgetInUse(inUse int64) {
+	atomic.StoreInt64(&m.MemoryBudgetInUse, inUse)
+}
+
+// Wrapper function to increment the number of head events that arrived after an event for a later slot.
+func (m *BeaconClientMetrics) IncrementHeadLateEvents(inc uint64) {
+	atomic.AddUint64(&m.HeadLateEvents, inc)
+}
@@ -88,6 +88,12 @@ type DbBeaconState struct {
 	MhKey     string // The ipld multihash key.
 }
 
+// A range of slots, both ends are inclusive.
+type SlotRange struct {
+	StartSlot Slot // The first slot in the range.
+	EndSlot   Slot // The last slot in the range.
+}
+
 // A structure to capture whats being written to the eth-beacon.known_gaps table.
 type DbKnownGaps struct {
 	StartSlot         uint64 // The start slot for known_gaps, inclusive.
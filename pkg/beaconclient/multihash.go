@@ -16,6 +16,10 @@
 package beaconclient
 
 import (
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	"github.com/multiformats/go-multihash"
@@ -25,6 +29,9 @@ import (
 
 const SSZ_SHA2_256_PREFIX uint64 = 0xb502
 
+// The multicodec of SSZ encoded objects, used for the CIDs of the objects in public.blocks.
+const SSZ_CODEC uint64 = 0xb501
+
 // MultihashKeyFromSSZRoot converts a SSZ-SHA2-256 root hash into a blockstore prefixed multihash key
 func MultihashKeyFromSSZRoot(root []byte) (string, error) {
 	mh, err := multihash.Encode(root, SSZ_SHA2_256_PREFIX)
@@ -37,3 +44,14 @@ func MultihashKeyFromSSZRoot(root []byte) (string, error) {
 	log.WithFields(log.Fields{"mhKey": mhKey, "len": len(root)}).Debug("The MHKEY")
 	return mhKey, nil
 }
+
+// CidFromMhKey converts a blockstore prefixed multihash key from public.blocks into a CIDv1 of an SSZ object.
+func CidFromMhKey(mhKey string) (cid.Cid, error) {
+	dsKey := datastore.NewKey(strings.TrimPrefix(mhKey, blockstore.BlockPrefix.String()))
+	mh, err := dshelp.DsKeyToMultihash(dsKey)
+	if err != nil {
+		loghelper.LogError(err).WithField("mhKey", mhKey).Error("Unable to decode the multihash Key")
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(SSZ_CODEC, mh), nil
+}
@@ -21,7 +21,6 @@ package beaconclient
 import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
 )
 
 // This function will perform the necessary steps to handle a reorg.
@@ -30,18 +29,26 @@ func (bc *BeaconClient) handleReorg() {
 	for {
 		reorg := <-bc.ReOrgTracking.ProcessCh
 		log.WithFields(log.Fields{"reorg": reorg}).Debug("Received a new reorg message.")
-		slot, err := ParseSlot(reorg.Slot)
-		if nil != err {
-			loghelper.LogSlotError(slot.Number(), err)
-		}
-		writeReorgs(bc.Db, slot, reorg.NewHeadBlock, bc.Metrics)
+		bc.processReorg(reorg)
 	}
 }
 
-// This function will handle the latest head event.
+// This function will handle the latest head event. The objects for each slot are fetched concurrently, while
+// the slots are committed in the order they were received. At most HeadBufferSize slots wait to be committed,
+// once the buffer is full we stop reading new head events until a slot is committed.
 func (bc *BeaconClient) handleHead() {
 	log.Info("Starting to process head.")
+	bufferSize := bc.HeadBufferSize
+	if bufferSize <= 0 {
+		bufferSize = bcDefaultHeadBufferSize
+	}
+	pending := make(chan *headSlot, bufferSize)
+	go bc.commitHeadSlots(pending)
+
 	errorSlots := 0
+	var latestSlot Slot
+	var turn *memoryTurn
+	received := false
 	for {
 		head := <-bc.HeadTracking.ProcessCh
 		// Process all the work here.
@@ -53,28 +60,35 @@ func (bc *BeaconClient) handleHead() {
 			errorSlots = errorSlots + 1
 			continue
 		}
-		if errorSlots != 0 && bc.PreviousSlot != 0 {
+		if errorSlots != 0 && received {
 			log.WithFields(log.Fields{
-				"lastProcessedSlot": bc.PreviousSlot,
+				"lastProcessedSlot": latestSlot,
 				"errorSlots":        errorSlots,
 			}).Warn("We added slots to the knownGaps table because we got bad head messages.")
-			writeKnownGaps(bc.Db, bc.KnownGapTableIncrement, bc.PreviousSlot+1, slot, fmt.Errorf("Bad Head Messages"), "headProcessing", bc.Metrics)
+			writeKnownGaps(bc.Db, bc.KnownGapTableIncrement, latestSlot+1, slot, fmt.Errorf("Bad Head Messages"), "headProcessing", bc.Metrics)
 			errorSlots = 0
 		}
 
-		log.WithFields(log.Fields{"head": head}).Debug("We are going to start processing the slot.")
+		// A head for the same slot as the latest head is a fork, it is committed after the latest head.
+		if received && slot < latestSlot {
+			bc.handleLateHead(slot, latestSlot)
+			continue
+		}
 
-		// Not used anywhere yet but might be useful to have.
-		if bc.PreviousSlot == 0 && bc.PreviousBlockRoot == "" {
-			bc.StartingSlot = slot
+		if !bc.addHeadInFlight() {
+			log.WithFields(log.Fields{"head": head}).Warn("Head tracking is stopping, the slot will not be processed.")
+			continue
 		}
+		log.WithFields(log.Fields{"head": head}).Debug("We are going to start processing the slot.")
 
-		go processHeadSlot(slot, head.Block, head.State, bc.SlotProcessingDetails())
+		turn = turn.next()
+		hs := &headSlot{slot: slot, blockRoot: head.Block, stateRoot: head.State, fetched: make(chan struct{}), turn: turn}
+		pending <- hs
+		go hs.fetch(bc.SlotProcessingDetails())
 
-		log.WithFields(log.Fields{"head": head.Slot}).Debug("We finished calling processHeadSlot.")
+		log.WithFields(log.Fields{"head": head.Slot}).Debug("We added the slot to the head pipeline.")
 
-		// Update the previous block
-		bc.PreviousSlot = slot
-		bc.PreviousBlockRoot = head.Block
+		latestSlot = slot
+		received = true
 	}
 }
@@ -21,7 +21,8 @@ package beaconclient
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -31,40 +32,57 @@ import (
 )
 
 var (
-	// Get a single highest priority and non-checked out row row from eth_beacon.historical_process
-	getHpEntryStmt string = `SELECT start_slot, end_slot FROM eth_beacon.historic_process
-	WHERE checked_out=false AND end_slot >= $1
-	ORDER BY priority ASC
-	LIMIT 1;`
-	// Used to periodically check to see if there is a new entry in the eth_beacon.historic_process table.
-	checkHpEntryStmt string = `SELECT * FROM eth_beacon.historic_process WHERE checked_out=false AND end_slot >= $1;`
-	// Used to checkout a row from the eth_beacon.historic_process table
-	lockHpEntryStmt string = `UPDATE eth_beacon.historic_process
-	SET checked_out=true, checked_out_by=$3
-	WHERE start_slot=$1 AND end_slot=$2;`
+	// Atomically checkout the highest priority row from eth_beacon.historic_process that is not checked out,
+	// or whose lease has expired. A row checked out without a lease, by a node that predates leases, is left to that node until it is released. Rows being claimed by another node at the same time are skipped.
+	// Returns whether the row was checked out before, meaning its lease was reclaimed, and the slots already completed.
+	claimHpEntryStmt string = `WITH claimable AS (
+		SELECT start_slot, end_slot, checked_out FROM eth_beacon.historic_process
+		WHERE (checked_out=false OR checked_out_at < now() - make_interval(secs => $3))
+		AND end_slot >= $1 AND start_slot <= $2
+		ORDER BY priority ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE eth_beacon.historic_process hp
+	SET checked_out=true, checked_out_by=$4, checked_out_at=now()
+	FROM claimable
+	WHERE hp.start_slot=claimable.start_slot AND hp.end_slot=claimable.end_slot
+	RETURNING hp.start_slot, hp.end_slot, claimable.checked_out, hp.completed_slots;`
 	// Used to delete an entry from the eth_beacon.historic_process table
 	deleteHpEntryStmt string = `DELETE FROM eth_beacon.historic_process
 	WHERE start_slot=$1 AND end_slot=$2;`
 	// Used to update every single row that this node has checked out.
 	releaseHpLockStmt string = `UPDATE eth_beacon.historic_process
-	SET checked_out=false, checked_out_by=null
+	SET checked_out=false, checked_out_by=null, checked_out_at=null
 	WHERE checked_out_by=$1`
 )
 
 type HistoricProcessing struct {
-	db                   sql.Database         //db connection
-	metrics              *BeaconClientMetrics // metrics for beaconclient
-	uniqueNodeIdentifier int                  // node unique identifier.
+	db                       sql.Database         //db connection
+	metrics                  *BeaconClientMetrics // metrics for beaconclient
+	uniqueNodeIdentifier     int                  // node unique identifier.
+	latestSlotInBeaconServer *int64               // the latest slot in the beacon server, rows starting after it are left alone.
+	leaseDuration            time.Duration        // how long a checked out row is held without a heartbeat.
 }
 
 // Get a single row of historical slots from the table.
 func (hp HistoricProcessing) getSlotRange(ctx context.Context, slotCh chan<- slotsToProcess, minimumSlot Slot) []error {
-	return getBatchProcessRow(ctx, hp.db, getHpEntryStmt, checkHpEntryStmt, lockHpEntryStmt, slotCh, strconv.Itoa(hp.uniqueNodeIdentifier), minimumSlot)
+	return getBatchProcessRow(ctx, hp.db, claimHpEntryStmt, slotCh, hp.uniqueNodeIdentifier, minimumSlot, hp.latestSlotInBeaconServer, hp.leaseDuration, hp.metrics)
 }
 
-// Remove the table entry.
-func (hp HistoricProcessing) removeTableEntry(ctx context.Context, processCh <-chan slotsToProcess) error {
-	return removeRowPostProcess(ctx, hp.db, processCh, QueryBySlotStmt, deleteHpEntryStmt)
+// Renew the lease on the rows this node has checked out.
+func (hp HistoricProcessing) maintainLease(ctx context.Context) {
+	maintainCheckoutLease(ctx, hp.db, heartbeatHpLeaseStmt, hp.uniqueNodeIdentifier, hp.leaseDuration)
+}
+
+// Record that a slot within the table entry is done, and remove the entry once every slot is done.
+func (hp HistoricProcessing) completeSlot(entry slotsToProcess, slot Slot) error {
+	return completeSlotInRow(hp.db, completeHpSlotStmt, deleteHpEntryStmt, entry, slot)
+}
+
+// Hand the slots the beacon server does not have yet to eth_beacon.known_gaps, which retries them after a delay.
+func (hp HistoricProcessing) deferSlots(entry slotsToProcess, startSlot Slot, endSlot Slot) error {
+	return deferSlotRange(hp.db, entry, startSlot, endSlot, hp.completeSlot)
 }
 
 // Remove the table entry.
@@ -76,6 +94,10 @@ func (hp HistoricProcessing) handleProcessingErrors(ctx context.Context, errMess
 		case errMs := <-errMessages:
 			loghelper.LogSlotError(errMs.slot.Number(), errMs.err)
 			writeKnownGaps(hp.db, 1, errMs.slot, errMs.slot, errMs.err, errMs.errProcess, hp.metrics)
+			// The slot is now tracked in eth_beacon.known_gaps, so it is done as far as this entry is concerned.
+			if err := hp.completeSlot(errMs.entry, errMs.slot); err != nil {
+				loghelper.LogSlotError(errMs.slot.Number(), err).Error("Unable to mark the failed slot as complete")
+			}
 		}
 	}
 }
@@ -97,34 +119,39 @@ func (hp HistoricProcessing) releaseDbLocks() error {
 }
 
 // Process the slot range.
-func processSlotRangeWorker(ctx context.Context, workCh <-chan Slot, errCh chan<- batchHistoricError, spd SlotProcessingDetails, incrementTracker func(uint64)) {
+// Successful slots are sent to the completedCh, failed slots to the errCh.
+func processSlotRangeWorker(ctx context.Context, workCh <-chan slotInEntry, completedCh chan<- slotInEntry, errCh chan<- batchHistoricError, spd SlotProcessingDetails, incrementTracker func(uint64)) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case slot := <-workCh:
-			log.Debug("Handling slot: ", slot)
-			err, errProcess := handleHistoricSlot(ctx, slot, spd)
+		case work := <-workCh:
+			log.Debug("Handling slot: ", work.slot)
+			err, errProcess := handleHistoricSlot(ctx, work.slot, spd)
 			if err != nil {
 				errMs := batchHistoricError{
 					err:        err,
 					errProcess: errProcess,
-					slot:       slot,
+					slot:       work.slot,
+					entry:      work.entry,
 				}
 				errCh <- errMs
 			} else {
 				incrementTracker(1)
+				completedCh <- work
 			}
 		}
 	}
 }
 
-// A wrapper function that insert the start_slot and end_slot from a single row into a channel.
-// It also locks the row by updating the checked_out column.
-// The statement for getting the start_slot and end_slot must be provided.
-// The statement for "locking" the row must also be provided.
-func getBatchProcessRow(ctx context.Context, db sql.Database, getStartEndSlotStmt string, checkNewRowsStmt string, checkOutRowStmt string, slotCh chan<- slotsToProcess, uniqueNodeIdentifier string, minimumSlot Slot) []error {
+// A wrapper function that checks out a single row and inserts its start_slot and end_slot into a channel.
+// The row is claimed with a single statement, so several nodes can share the same table without
+// checking out the same row. The statement for claiming the row must be provided.
+// Rows that start after the latest slot in the beacon server are not checked out.
+// Rows checked out by another node are reclaimed once their lease has expired, along with the slots they completed.
+func getBatchProcessRow(ctx context.Context, db sql.Database, claimRowStmt string, slotCh chan<- slotsToProcess, uniqueNodeIdentifier int, minimumSlot Slot, latestSlotInBeaconServer *int64, leaseDuration time.Duration, metrics *BeaconClientMetrics) []error {
 	errCount := make([]error, 0)
+	leaseSeconds := leaseDuration.Seconds()
 
 	// 5 is an arbitrary number. It allows us to retry a few times before
 	// ending the application.
@@ -138,83 +165,27 @@ func getBatchProcessRow(ctx context.Context, db sql.Database, getStartEndSlotStm
 				log.WithFields(log.Fields{
 					"errCount": errCount,
 				}).Error("New error entry added")
+				prevErrCount = len(errCount)
 			}
-			processRow, err := db.Exec(context.Background(), checkNewRowsStmt, minimumSlot)
-			if err != nil {
-				errCount = append(errCount, err)
-			}
-			row, err := processRow.RowsAffected()
-			if err != nil {
-				errCount = append(errCount, err)
-			}
-			if row < 1 {
-				time.Sleep(3 * time.Second)
-				log.Debug("We are checking rows, be patient")
-				break
-			}
-			log.Debug("We found a new row")
-			dbCtx := context.Background()
+			maximumSlot := maximumSlotToProcess(latestSlotInBeaconServer)
 
-			// Setup TX
-			tx, err := db.Begin(dbCtx)
-			if err != nil {
-				loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
-				errCount = append(errCount, err)
-				break
-			}
-			defer func() {
-				err := tx.Rollback(dbCtx)
-				if err != nil && err != pgx.ErrTxClosed {
-					loghelper.LogError(err).Error("We were unable to Rollback a transaction")
-					errCount = append(errCount, err)
-				}
-			}()
-
-			// Query the DB for slots.
 			sp := slotsToProcess{}
-			err = tx.QueryRow(dbCtx, getStartEndSlotStmt, minimumSlot).Scan(&sp.startSlot, &sp.endSlot)
+			var reclaimed bool
+			err := db.QueryRow(context.Background(), claimRowStmt, minimumSlot, maximumSlot, leaseSeconds, uniqueNodeIdentifier).Scan(&sp.startSlot, &sp.endSlot, &reclaimed, &sp.completed)
 			if err != nil {
 				if err == pgx.ErrNoRows {
-					time.Sleep(1 * time.Second)
+					time.Sleep(3 * time.Second)
+					log.Debug("We are checking rows, be patient")
 					break
 				}
-				loghelper.LogSlotRangeStatementError(sp.startSlot.Number(), sp.endSlot.Number(), getStartEndSlotStmt, err).Error("Unable to get a row")
+				loghelper.LogError(err).WithField("statement", claimRowStmt).Error("Unable to checkout a row")
 				errCount = append(errCount, err)
 				break
 			}
 
-			// Checkout the Row
-			res, err := tx.Exec(dbCtx, checkOutRowStmt, sp.startSlot, sp.endSlot, uniqueNodeIdentifier)
-			if err != nil {
-				loghelper.LogSlotRangeStatementError(sp.startSlot.Number(), sp.endSlot.Number(), checkOutRowStmt, err).Error("Unable to checkout the row")
-				errCount = append(errCount, err)
-				break
-			}
-			rows, err := res.RowsAffected()
-			if err != nil {
-				loghelper.LogSlotRangeStatementError(sp.startSlot.Number(), sp.endSlot.Number(), checkOutRowStmt, fmt.Errorf("Unable to determine the rows affected when trying to checkout a row."))
-				errCount = append(errCount, err)
-				break
-			}
-			if rows > 1 {
-				loghelper.LogSlotRangeStatementError(sp.startSlot.Number(), sp.endSlot.Number(), checkOutRowStmt, err).WithFields(log.Fields{
-					"rowsReturn": rows,
-				}).Error("We locked too many rows.....")
-				errCount = append(errCount, err)
-				break
-			}
-			if rows == 0 {
-				loghelper.LogSlotRangeStatementError(sp.startSlot.Number(), sp.endSlot.Number(), checkOutRowStmt, err).WithFields(log.Fields{
-					"rowsReturn": rows,
-				}).Error("We did not lock a single row.")
-				errCount = append(errCount, err)
-				break
-			}
-			err = tx.Commit(dbCtx)
-			if err != nil {
-				loghelper.LogSlotRangeError(sp.startSlot.Number(), sp.endSlot.Number(), err).Error("Unable commit transactions.")
-				errCount = append(errCount, err)
-				break
+			if reclaimed {
+				log.WithField("slots", sp).Warn("Reclaimed a row whose lease has expired")
+				metrics.IncrementLeasesReclaimed(1)
 			}
 			log.WithField("slots", sp).Debug("Added a new slots to be processed")
 			slotCh <- sp
@@ -226,44 +197,15 @@ func getBatchProcessRow(ctx context.Context, db sql.Database, getStartEndSlotStm
 	return errCount
 }
 
-// After a row has been processed it should be removed from its appropriate table.
-func removeRowPostProcess(ctx context.Context, db sql.Database, processCh <-chan slotsToProcess, checkProcessedStmt, removeStmt string) error {
-	errCh := make(chan error)
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case slots := <-processCh:
-			// Make sure the start and end slot exist in the slots table.
-			go func() {
-				log.WithFields(log.Fields{
-					"startSlot": slots.startSlot,
-					"endSlot":   slots.endSlot,
-				}).Debug("Starting to check to see if the following slots have been processed")
-				for {
-					isStartProcess, err := isSlotProcessed(db, checkProcessedStmt, slots.startSlot)
-					if err != nil {
-						errCh <- err
-					}
-					isEndProcess, err := isSlotProcessed(db, checkProcessedStmt, slots.endSlot)
-					if err != nil {
-						errCh <- err
-					}
-					if isStartProcess && isEndProcess {
-						break
-					}
-					time.Sleep(3 * time.Second)
-				}
-
-				_, err := db.Exec(context.Background(), removeStmt, slots.startSlot.Number(), slots.endSlot.Number())
-				if err != nil {
-					errCh <- err
-				}
-
-			}()
-			if len(errCh) != 0 {
-				return <-errCh
-			}
-		}
+// The highest slot that can be checked out for processing. If we do not know the latest slot
+// in the beacon server, every slot can be checked out.
+func maximumSlotToProcess(latestSlotInBeaconServer *int64) int64 {
+	if latestSlotInBeaconServer == nil {
+		return math.MaxInt64
+	}
+	latestSlot := atomic.LoadInt64(latestSlotInBeaconServer)
+	if latestSlot == 0 {
+		return math.MaxInt64
 	}
+	return latestSlot
 }
@@ -20,7 +20,7 @@ package beaconclient
 
 import (
 	"context"
-	"strconv"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
@@ -28,17 +28,23 @@ import (
 )
 
 var (
-	// Get a single non-checked out row row from eth_beacon.known_gaps.
-	getKgEntryStmt string = `SELECT start_slot, end_slot FROM eth_beacon.known_gaps
-	WHERE checked_out=false AND end_slot >= $1
-	ORDER BY priority ASC
-	LIMIT 1;`
-	// Used to periodically check to see if there is a new entry in the eth_beacon.known_gaps table.
-	checkKgEntryStmt string = `SELECT * FROM eth_beacon.known_gaps WHERE checked_out=false AND end_slot >= $1;`
-	// Used to checkout a row from the eth_beacon.known_gaps table
-	lockKgEntryStmt string = `UPDATE eth_beacon.known_gaps
-	SET checked_out=true, checked_out_by=$3
-	WHERE start_slot=$1 AND end_slot=$2;`
+	// Atomically checkout the highest priority row from eth_beacon.known_gaps that is not checked out,
+	// or whose lease has expired. A row checked out without a lease, by a node that predates leases, is left to that node until it is released. Rows that are backing off after a failed attempt are left alone. Rows being claimed by another node at the same time are skipped.
+	// Returns whether the row was checked out before, meaning its lease was reclaimed, and the slots already completed.
+	claimKgEntryStmt string = `WITH claimable AS (
+		SELECT start_slot, end_slot, checked_out FROM eth_beacon.known_gaps
+		WHERE (checked_out=false OR checked_out_at < now() - make_interval(secs => $3))
+		AND (next_attempt_at IS NULL OR next_attempt_at <= now())
+		AND end_slot >= $1 AND start_slot <= $2
+		ORDER BY priority ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE eth_beacon.known_gaps kg
+	SET checked_out=true, checked_out_by=$4, checked_out_at=now()
+	FROM claimable
+	WHERE kg.start_slot=claimable.start_slot AND kg.end_slot=claimable.end_slot
+	RETURNING kg.start_slot, kg.end_slot, claimable.checked_out, kg.completed_slots;`
 	// Used to delete an entry from the knownGaps table
 	deleteKgEntryStmt string = `DELETE FROM eth_beacon.known_gaps
 	WHERE start_slot=$1 AND end_slot=$2;`
@@ -47,20 +53,28 @@ var (
 	WHERE start_slot=$1 AND end_slot=$2;`
 	// Used to update every single row that this node has checked out.
 	releaseKgLockStmt string = `UPDATE eth_beacon.known_gaps
-	SET checked_out=false, checked_out_by=null
+	SET checked_out=false, checked_out_by=null, checked_out_at=null
 	WHERE checked_out_by=$1`
 )
 
 type KnownGapsProcessing struct {
-	db                   sql.Database         //db connection
-	metrics              *BeaconClientMetrics // metrics for beaconclient
-	uniqueNodeIdentifier int                  // node unique identifier.
+	db                       sql.Database         //db connection
+	metrics                  *BeaconClientMetrics // metrics for beaconclient
+	uniqueNodeIdentifier     int                  // node unique identifier.
+	latestSlotInBeaconServer *int64               // the latest slot in the beacon server, rows starting after it are left alone.
+	leaseDuration            time.Duration        // how long a checked out row is held without a heartbeat.
+	retryPolicy              RetryPolicy          // how many times an entry is reprocessed before it is dead lettered.
 }
 
 // This function will perform all the heavy lifting for tracking the head of the chain.
 func (bc *BeaconClient) ProcessKnownGaps(ctx context.Context, maxWorkers int, minimumSlot Slot) []error {
 	log.Info("We are starting the known gaps processing service.")
-	bc.KnownGapsProcess = KnownGapsProcessing{db: bc.Db, uniqueNodeIdentifier: bc.UniqueNodeIdentifier, metrics: bc.Metrics}
+	bc.KnownGapsProcess = KnownGapsProcessing{db: bc.Db, uniqueNodeIdentifier: bc.UniqueNodeIdentifier, metrics: bc.Metrics,
+		latestSlotInBeaconServer: &bc.LatestSlotInBeaconServer, leaseDuration: bc.checkoutLeaseDuration(), retryPolicy: bc.knownGapsRetryPolicy()}
+	bc.refreshLatestSlotInBeaconServer()
+	bc.refreshFinalizedEpoch()
+	go bc.trackLatestSlotInBeaconServer(ctx)
+	bc.trackBeaconServerAvailability(ctx)
 	errs := handleBatchProcess(ctx, maxWorkers, bc.KnownGapsProcess, bc.SlotProcessingDetails(), bc.Metrics.IncrementKnownGapsProcessed, minimumSlot)
 	log.Debug("Exiting known gaps processing service")
 	return errs
@@ -79,12 +93,30 @@ func (bc *BeaconClient) StopKnownGapsProcessing(cancel context.CancelFunc) error
 
 // Get a single row of historical slots from the table.
 func (kgp KnownGapsProcessing) getSlotRange(ctx context.Context, slotCh chan<- slotsToProcess, minimumSlot Slot) []error {
-	return getBatchProcessRow(ctx, kgp.db, getKgEntryStmt, checkKgEntryStmt, lockKgEntryStmt, slotCh, strconv.Itoa(kgp.uniqueNodeIdentifier), minimumSlot)
+	return getBatchProcessRow(ctx, kgp.db, claimKgEntryStmt, slotCh, kgp.uniqueNodeIdentifier, minimumSlot, kgp.latestSlotInBeaconServer, kgp.leaseDuration, kgp.metrics)
 }
 
-// Remove the table entry.
-func (kgp KnownGapsProcessing) removeTableEntry(ctx context.Context, processCh <-chan slotsToProcess) error {
-	return removeRowPostProcess(ctx, kgp.db, processCh, QueryBySlotStmt, deleteKgEntryStmt)
+// Renew the lease on the rows this node has checked out.
+func (kgp KnownGapsProcessing) maintainLease(ctx context.Context) {
+	maintainCheckoutLease(ctx, kgp.db, heartbeatKgLeaseStmt, kgp.uniqueNodeIdentifier, kgp.leaseDuration)
+}
+
+// Record that a slot within the table entry is done, and remove the entry once every slot is done.
+func (kgp KnownGapsProcessing) completeSlot(entry slotsToProcess, slot Slot) error {
+	return completeSlotInRow(kgp.db, completeKgSlotStmt, deleteKgEntryStmt, entry, slot)
+}
+
+// Hand the slots the beacon server does not have yet back to eth_beacon.known_gaps. An entry whose slots are all
+// deferred is released until the delay has passed, otherwise the slots get their own entry.
+func (kgp KnownGapsProcessing) deferSlots(entry slotsToProcess, startSlot Slot, endSlot Slot) error {
+	if startSlot == entry.startSlot && endSlot == entry.endSlot {
+		_, err := kgp.db.Exec(context.Background(), releaseDeferredKgEntryStmt, entry.startSlot, entry.endSlot, bcDeferredSlotDelay.Seconds())
+		if err != nil {
+			loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to release the deferred entry")
+		}
+		return err
+	}
+	return deferSlotRange(kgp.db, entry, startSlot, endSlot, kgp.completeSlot)
 }
 
 // Remove the table entry.
@@ -94,6 +126,15 @@ func (kgp KnownGapsProcessing) handleProcessingErrors(ctx context.Context, errMe
 		case <-ctx.Done():
 			return
 		case errMs := <-errMessages:
+			// A single slot entry that failed again backs off before it is released, or is dead lettered.
+			if errMs.entry.startSlot == errMs.slot && errMs.entry.endSlot == errMs.slot {
+				loghelper.LogSlotError(errMs.slot.Number(), errMs.err).Error("We received an error when processing a knownGap")
+				err := recordKnownGapFailure(kgp.db, errMs.slot, errMs.err, errMs.errProcess, kgp.retryPolicy, true, kgp.metrics)
+				if err != nil {
+					loghelper.LogSlotError(errMs.slot.Number(), err).Error("Error processing known gap")
+				}
+				continue
+			}
 			// Check to see if this if this entry already exists.
 			res, err := kgp.db.Exec(context.Background(), checkKgSingleSlotStmt, errMs.slot, errMs.slot)
 			if err != nil {
@@ -109,13 +150,17 @@ func (kgp KnownGapsProcessing) handleProcessingErrors(ctx context.Context, errMe
 
 			if rows > 0 {
 				loghelper.LogSlotError(errMs.slot.Number(), errMs.err).Error("We received an error when processing a knownGap")
-				err = updateKnownGapErrors(kgp.db, errMs.slot, errMs.slot, errMs.err, kgp.metrics)
+				err = recordKnownGapFailure(kgp.db, errMs.slot, errMs.err, errMs.errProcess, kgp.retryPolicy, false, kgp.metrics)
 				if err != nil {
 					loghelper.LogSlotError(errMs.slot.Number(), err).Error("Error processing known gap")
 				}
 			} else {
 				writeKnownGaps(kgp.db, 1, errMs.slot, errMs.slot, errMs.err, errMs.errProcess, kgp.metrics)
 			}
+			// The slot is now tracked by its own entry, so it is done as far as this entry is concerned.
+			if err := kgp.completeSlot(errMs.entry, errMs.slot); err != nil {
+				loghelper.LogSlotError(errMs.slot.Number(), err).Error("Unable to mark the failed slot as complete")
+			}
 		}
 	}
 
@@ -44,12 +44,22 @@ type SlotProcessingDetails struct {
 	PerformBeaconStateProcessing bool                 // Should we process BeaconStates?
 	PerformBeaconBlockProcessing bool                 // Should we process BeaconBlocks?
 
+	BeaconServerAvailability *BeaconServerAvailability // The slots the beacon server has backfilled.
+	LatestSlotInBeaconServer *int64                    // The latest slot in the beacon server, slots after it are deferred.
+	MemoryBudget             *MemoryBudget             // The memory budget to acquire from before downloading objects.
+	BatchWriter              *BatchDatabaseWriter      // Used to write historic slots in batches, nil writes each slot on its own.
+	StateCadence             StateCadence              // Which slots we store BeaconStates for.
+	FinalizedEpoch           *uint64                   // The latest finalized epoch, used when only finalized epoch boundaries are stored.
+	memoryTurn               *memoryTurn               // Set for head slots, so they acquire from the memory budget in order.
+
 	StartingSlot      Slot   // If we're performing head tracking. What is the first slot we processed.
 	PreviousSlot      Slot   // Whats the previous slot we processed
 	PreviousBlockRoot string // Whats the previous block root, used to check the next blocks parent.
 }
 
 func (bc *BeaconClient) SlotProcessingDetails() SlotProcessingDetails {
+	bc.previousLock.RLock()
+	defer bc.previousLock.RUnlock()
 	return SlotProcessingDetails{
 		Context:        bc.Context,
 		ServerEndpoint: bc.ServerEndpoint,
@@ -60,6 +70,13 @@ func (bc *BeaconClient) SlotProcessingDetails() SlotProcessingDetails {
 		PerformBeaconBlockProcessing: bc.PerformBeaconBlockProcessing,
 		PerformBeaconStateProcessing: bc.PerformBeaconStateProcessing,
 
+		BeaconServerAvailability: bc.BeaconServerAvailability,
+		LatestSlotInBeaconServer: &bc.LatestSlotInBeaconServer,
+		MemoryBudget:             bc.MemoryBudget,
+		BatchWriter:              bc.BatchWriter,
+		StateCadence:             bc.StateCadence,
+		FinalizedEpoch:           &bc.FinalizedEpoch,
+
 		KnownGapTableIncrement: bc.KnownGapTableIncrement,
 		StartingSlot:           bc.StartingSlot,
 		PreviousSlot:           bc.PreviousSlot,
@@ -80,6 +97,8 @@ type ProcessSlot struct {
 	Db                 sql.Database         // The DB object used to write to the DB.
 	Metrics            *BeaconClientMetrics // An object to keep track of the beaconclient metrics
 	PerformanceMetrics PerformanceMetrics   // An object to keep track of performance metrics.
+	Memory             *memoryReservation   // The memory reserved for the SSZ and decoded objects of this slot.
+	ProcessingStart    time.Time            // When we started processing the slot.
 	// BeaconBlock
 
 	SszSignedBeaconBlock  []byte             // The entire SSZ encoded SignedBeaconBlock
@@ -121,18 +140,36 @@ func processFullSlot(
 	knownGapsTableIncrement int,
 	headOrHistoric string,
 	spd *SlotProcessingDetails) (error, string) {
+	ps, err, errReason := fetchSlot(ctx, slot, blockRoot, stateRoot, headOrHistoric, spd)
+	if err != nil || ps == nil {
+		return err, errReason
+	}
+	defer ps.Memory.release()
+	return ps.commitSlot(ctx, previousSlot, previousBlockRoot, knownGapsTableIncrement, spd)
+}
+
+// Download the SignedBeaconBlock and BeaconState for the slot, and compute their roots. Nothing is written to the DB.
+// A nil ProcessSlot without an error means there is nothing to write, either because the context was canceled,
+// or because the slot is already in the DB. The caller must release the memory held by the returned ProcessSlot.
+func fetchSlot(
+	ctx context.Context,
+	slot Slot,
+	blockRoot string,
+	stateRoot string,
+	headOrHistoric string,
+	spd *SlotProcessingDetails) (*ProcessSlot, error, string) {
 	select {
 	case <-ctx.Done():
-		return nil, ""
+		return nil, nil, ""
 	default:
-		totalStart := time.Now()
 		ps := &ProcessSlot{
-			Slot:           slot,
-			BlockRoot:      blockRoot,
-			StateRoot:      stateRoot,
-			HeadOrHistoric: headOrHistoric,
-			Db:             spd.Db,
-			Metrics:        spd.Metrics,
+			Slot:            slot,
+			BlockRoot:       blockRoot,
+			StateRoot:       stateRoot,
+			HeadOrHistoric:  headOrHistoric,
+			Db:              spd.Db,
+			Metrics:         spd.Metrics,
+			ProcessingStart: time.Now(),
 			PerformanceMetrics: PerformanceMetrics{
 				BeaconNodeBlockRetrievalTime: 0,
 				BeaconNodeStateRetrievalTime: 0,
@@ -147,9 +184,28 @@ func processFullSlot(
 			},
 		}
 
+		// The state_root is still recorded in eth_beacon.slots for slots whose BeaconState we do not store.
+		performBeaconStateProcessing := spd.shouldStoreState(slot)
+
+		downloads := 0
+		if performBeaconStateProcessing {
+			downloads += 1
+		}
+		if spd.PerformBeaconBlockProcessing {
+			downloads += 1
+		}
+		ps.Memory = spd.MemoryBudget.newReservation(ctx, downloads, spd.memoryTurn)
+		// The memory is handed to the caller along with the ProcessSlot, unless we return early.
+		fetched := false
+		defer func() {
+			if !fetched {
+				ps.Memory.release()
+			}
+		}()
+
 		g, _ := errgroup.WithContext(context.Background())
 
-		if spd.PerformBeaconStateProcessing {
+		if performBeaconStateProcessing {
 			// Get the BeaconState.
 			g.Go(func() error {
 				select {
@@ -186,13 +242,13 @@ func processFullSlot(
 		}
 
 		if err := g.Wait(); err != nil {
-			return err, "processSlot"
+			return nil, err, "processSlot"
 		}
 
 		parseBeaconTime := time.Now()
 		finalBlockRoot, finalStateRoot, _, err := ps.provideFinalHash()
 		if err != nil {
-			return err, "CalculateBlockRoot"
+			return nil, err, "CalculateBlockRoot"
 		}
 		ps.PerformanceMetrics.ParseBeaconObjectForHash = time.Since(parseBeaconTime)
 
@@ -202,94 +258,131 @@ func processFullSlot(
 			if spd.PerformBeaconBlockProcessing {
 				blockExists, err := checkSlotAndRoot(ps.Db, CheckSignedBeaconBlockStmt, ps.Slot, finalBlockRoot)
 				if err != nil {
-					return err, "checkDb"
+					return nil, err, "checkDb"
 				}
 				blockRequired = !blockExists
 			}
 
 			var stateRequired bool
-			if spd.PerformBeaconStateProcessing {
+			if performBeaconStateProcessing {
 				stateExists, err := checkSlotAndRoot(ps.Db, CheckBeaconStateStmt, ps.Slot, finalStateRoot)
 				if err != nil {
-					return err, "checkDb"
+					return nil, err, "checkDb"
 				}
 				stateRequired = !stateExists
 			}
 
 			if !blockRequired && !stateRequired {
 				log.WithField("slot", slot).Info("Slot already in the DB.")
-				return nil, ""
+				return nil, nil, ""
 			}
 			ps.PerformanceMetrics.CheckDbPreProcessing = time.Since(checkDbTime)
 		}
 
-		// Get this object ready to write
+		fetched = true
+		return ps, nil, ""
+	}
+}
+
+// Write a slot returned by fetchSlot to the DB. Head slots are checked against the previous slot within
+// the same transaction.
+func (ps *ProcessSlot) commitSlot(
+	ctx context.Context,
+	previousSlot Slot,
+	previousBlockRoot string,
+	knownGapsTableIncrement int,
+	spd *SlotProcessingDetails) (error, string) {
+	headOrHistoric := strings.ToLower(ps.HeadOrHistoric)
+
+	// Historic slots can be written together with other slots.
+	if spd.BatchWriter != nil && headOrHistoric == "historic" {
 		createDbWriteTime := time.Now()
-		dw, err := ps.createWriteObjects()
+		dw, err := ps.createWriteModels()
 		if err != nil {
 			return err, "blockRoot"
 		}
 		ps.PerformanceMetrics.CreateDbWriteObject = time.Since(createDbWriteTime)
 
-		// Write the object to the DB.
 		dbFullTransactionTime := time.Now()
-		defer func() {
-			err := dw.Tx.Rollback(dw.Ctx)
-			if err != nil && err != pgx.ErrTxClosed {
-				loghelper.LogError(err).Error("We were unable to Rollback a transaction")
-			}
-		}()
-
-		transactionTime := time.Now()
-		err = dw.transactFullSlot()
-		if err != nil {
+		if err = spd.BatchWriter.write(ctx, dw); err != nil {
 			return err, "processSlot"
 		}
-		ps.PerformanceMetrics.TransactSlotOnly = time.Since(transactionTime)
-
-		// Handle any reorgs or skipped slots.
-		reorgTime := time.Now()
-		headOrHistoric = strings.ToLower(headOrHistoric)
-		if headOrHistoric != "head" && headOrHistoric != "historic" {
-			return fmt.Errorf("headOrHistoric must be either historic or head"), ""
-		}
-		if ps.HeadOrHistoric == "head" && previousSlot != 0 && previousBlockRoot != "" && ps.Status != "skipped" {
-			ps.checkPreviousSlot(dw.Tx, dw.Ctx, previousSlot, previousBlockRoot, knownGapsTableIncrement)
-		}
-		ps.PerformanceMetrics.CheckReorg = time.Since(reorgTime)
-
-		// Commit the transaction
-		commitTime := time.Now()
-		if err = dw.Tx.Commit(dw.Ctx); err != nil {
-			return err, "transactionCommit"
-		}
-		ps.PerformanceMetrics.CommitTransaction = time.Since(commitTime)
-
-		// Total metric capture time.
 		ps.PerformanceMetrics.TotalDbTransaction = time.Since(dbFullTransactionTime)
-		ps.PerformanceMetrics.TotalProcessing = time.Since(totalStart)
+		ps.PerformanceMetrics.TotalProcessing = time.Since(ps.ProcessingStart)
 
 		log.WithFields(log.Fields{
-			"slot":               slot,
+			"slot":               ps.Slot,
 			"performanceMetrics": fmt.Sprintf("%+v\n", ps.PerformanceMetrics),
 		}).Debug("Performance Metric output!")
-
 		return nil, ""
 	}
-}
 
-// Handle a slot that is at head. A wrapper function for calling `handleFullSlot`.
-func processHeadSlot(slot Slot, blockRoot string, stateRoot string, spd SlotProcessingDetails) {
-	// Get the knownGaps at startUp
-	if spd.PreviousSlot == 0 && spd.PreviousBlockRoot == "" {
-		writeStartUpGaps(spd.Db, spd.KnownGapTableIncrement, slot, spd.Metrics)
+	// Get this object ready to write
+	createDbWriteTime := time.Now()
+	dw, err := ps.createWriteObjects()
+	if err != nil {
+		return err, "blockRoot"
 	}
-	// TODO(telackey): Why context.Background()?
-	err, errReason := processFullSlot(context.Background(), slot, blockRoot, stateRoot,
-		spd.PreviousSlot, spd.PreviousBlockRoot, spd.KnownGapTableIncrement, "head", &spd)
+	ps.PerformanceMetrics.CreateDbWriteObject = time.Since(createDbWriteTime)
+
+	// Write the object to the DB.
+	dbFullTransactionTime := time.Now()
+	defer func() {
+		err := dw.Tx.Rollback(dw.Ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction")
+		}
+	}()
+
+	transactionTime := time.Now()
+	err = dw.transactFullSlot()
 	if err != nil {
-		writeKnownGaps(spd.Db, spd.KnownGapTableIncrement, slot, slot, err, errReason, spd.Metrics)
+		return err, "processSlot"
 	}
+	ps.PerformanceMetrics.TransactSlotOnly = time.Since(transactionTime)
+
+	// Handle any reorgs or skipped slots.
+	reorgTime := time.Now()
+	if headOrHistoric != "head" && headOrHistoric != "historic" {
+		return fmt.Errorf("headOrHistoric must be either historic or head"), ""
+	}
+	if headOrHistoric == "head" && previousSlot != 0 && previousBlockRoot != "" && ps.Status != "skipped" {
+		ps.checkPreviousSlot(dw.Tx, dw.Ctx, previousSlot, previousBlockRoot, knownGapsTableIncrement)
+	}
+	ps.PerformanceMetrics.CheckReorg = time.Since(reorgTime)
+
+	// Commit the transaction
+	commitTime := time.Now()
+	if err = dw.Tx.Commit(dw.Ctx); err != nil {
+		return err, "transactionCommit"
+	}
+	ps.PerformanceMetrics.CommitTransaction = time.Since(commitTime)
+
+	// Total metric capture time.
+	ps.PerformanceMetrics.TotalDbTransaction = time.Since(dbFullTransactionTime)
+	ps.PerformanceMetrics.TotalProcessing = time.Since(ps.ProcessingStart)
+
+	log.WithFields(log.Fields{
+		"slot":               ps.Slot,
+		"performanceMetrics": fmt.Sprintf("%+v\n", ps.PerformanceMetrics),
+	}).Debug("Performance Metric output!")
+
+	return nil, ""
+}
+
+// Can the beacon server provide everything we need to process the given slot.
+func (spd SlotProcessingDetails) isSlotAvailable(slot Slot) bool {
+	if int64(slot) > maximumSlotToProcess(spd.LatestSlotInBeaconServer) {
+		return false
+	}
+	storeState := spd.PerformBeaconStateProcessing && spd.StateCadence.isOnCadence(slot)
+	if storeState && !spd.isFinalizedForCadence(slot) {
+		return false
+	}
+	if spd.BeaconServerAvailability == nil {
+		return true
+	}
+	return spd.BeaconServerAvailability.IsBackfilled(slot, spd.PerformBeaconBlockProcessing, storeState)
 }
 
 // Handle a historic slot. A wrapper function for calling `handleFullSlot`.
@@ -308,7 +401,7 @@ func (ps *ProcessSlot) getSignedBeaconBlock(serverAddress string) error {
 	}
 
 	blockEndpoint := serverAddress + BcBlockQueryEndpoint + blockIdentifier
-	sszSignedBeaconBlock, rc, err := querySsz(blockEndpoint, ps.Slot)
+	sszSignedBeaconBlock, rc, err := querySsz(blockEndpoint, ps.Slot, ps.Memory)
 
 	if err != nil || rc != 200 {
 		loghelper.LogSlotError(ps.Slot.Number(), err).Error("Unable to properly query the slot.")
@@ -332,7 +425,7 @@ func (ps *ProcessSlot) getSignedBeaconBlock(serverAddress string) error {
 		ps.SszSignedBeaconBlock = []byte{}
 		ps.ParentBlockRoot = ""
 		ps.Status = "skipped"
-		return err
+		return &SlotError{Class: ErrorClassDecode, StatusCode: rc, Err: err}
 	}
 
 	ps.FullSignedBeaconBlock = &signedBeaconBlock
@@ -352,7 +445,7 @@ func (ps *ProcessSlot) getBeaconState(serverEndpoint string) error {
 	}
 
 	stateEndpoint := serverEndpoint + BcStateQueryEndpoint + stateIdentifier
-	sszBeaconState, _, err := querySsz(stateEndpoint, ps.Slot)
+	sszBeaconState, rc, err := querySsz(stateEndpoint, ps.Slot, ps.Memory)
 	if err != nil {
 		loghelper.LogSlotError(ps.Slot.Number(), err).Error("Unable to properly query the BeaconState.")
 		return err
@@ -362,7 +455,7 @@ func (ps *ProcessSlot) getBeaconState(serverEndpoint string) error {
 	err = beaconState.UnmarshalSSZ(sszBeaconState)
 	if err != nil {
 		loghelper.LogSlotError(ps.Slot.Number(), err).Error("Unable to unmarshal the BeaconState.")
-		return err
+		return &SlotError{Class: ErrorClassDecode, StatusCode: rc, Err: err}
 	}
 
 	ps.FullBeaconState = &beaconState
@@ -406,8 +499,22 @@ func (ps *ProcessSlot) checkPreviousSlot(tx sql.Tx, ctx context.Context, previou
 	}
 }
 
-// Transforms all the raw data into DB models that can be written to the DB.
+// Transforms all the raw data into DB models that can be written to the DB, within a new transaction.
 func (ps *ProcessSlot) createWriteObjects() (*DatabaseWriter, error) {
+	dw, err := ps.createWriteModels()
+	if err != nil {
+		return nil, err
+	}
+	dw.Tx, err = ps.Db.Begin(dw.Ctx)
+	if err != nil {
+		loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
+		return nil, err
+	}
+	return dw, nil
+}
+
+// Transforms all the raw data into DB models that can be written to the DB.
+func (ps *ProcessSlot) createWriteModels() (*DatabaseWriter, error) {
 	var status string
 	if ps.Status != "" {
 		status = ps.Status
@@ -425,7 +532,7 @@ func (ps *ProcessSlot) createWriteObjects() (*DatabaseWriter, error) {
 
 	payloadHeader := ps.provideExecutionPayloadDetails()
 
-	dw, err := CreateDatabaseWrite(ps.Db, ps.Slot, stateRoot, blockRoot, ps.ParentBlockRoot, eth1DataBlockHash,
+	dw, err := createDatabaseWriteModels(ps.Db, ps.Slot, stateRoot, blockRoot, ps.ParentBlockRoot, eth1DataBlockHash,
 		payloadHeader, status, &ps.SszSignedBeaconBlock, &ps.SszBeaconState, ps.Metrics)
 	if err != nil {
 		return dw, err
@@ -0,0 +1,334 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to build and verify SSZ Merkle proofs for blocks and states.
+
+package beaconclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+)
+
+// A single step of a proof path: a field name, optionally followed by list or vector indices, e.g. validators[3].
+var proofPathStep = regexp.MustCompile(`^([a-z0-9_]+)((?:\[\d+\])*)$`)
+
+// A Merkle proof that a leaf is part of the object with the given root. The branch is ordered from the sibling of
+// the leaf up to the child of the root, as expected by is_valid_merkle_branch in the consensus specs. When the path
+// ends at an element of a list or vector of basic values, the leaf is the 32 byte chunk containing that element.
+type MerkleProof struct {
+	Version string   `json:"version"` // The fork of the object.
+	Path    string   `json:"path"`    // The path of the leaf within the object, e.g. body.execution_payload.block_hash.
+	Gindex  uint64   `json:"gindex"`  // The generalized index of the leaf.
+	Root    string   `json:"root"`    // The block root or state root the proof is against.
+	Leaf    string   `json:"leaf"`    // The root of the leaf.
+	Branch  []string `json:"branch"`  // The sibling roots along the path to the root.
+}
+
+// The response of the proof endpoints.
+type ProofResponse struct {
+	Data []MerkleProof `json:"data"`
+}
+
+// Build proofs for paths within a stored block or state. The kind is either block or state, and the identifier is
+// head, genesis, a slot or a 0x prefixed root. Block proofs are against the block root, not the SignedBeaconBlock.
+func BuildStoredProofs(ctx context.Context, db sql.Database, kind string, id string, paths []string) ([]MerkleProof, error) {
+	if len(paths) == 0 {
+		return nil, &apiError{Code: http.StatusBadRequest, Message: "At least one path must be provided"}
+	}
+	var prove func(path string) (MerkleProof, error)
+	switch kind {
+	case "block":
+		obj, err := findApiObject(ctx, db, id, queryApiHeadBlockStmt, queryApiBlockBySlotStmt, queryApiBlockByRootStmt, kind)
+		if err != nil {
+			return nil, err
+		}
+		data, err := loadApiData(ctx, db, obj, kind)
+		if err != nil {
+			return nil, err
+		}
+		var block SignedBeaconBlock
+		if err := block.UnmarshalSSZ(data); err != nil {
+			return nil, err
+		}
+		prove = block.Block().MerkleProof
+	case "state":
+		obj, err := findApiObject(ctx, db, id, queryApiHeadStateStmt, queryApiStateBySlotStmt, queryApiStateByRootStmt, kind)
+		if err != nil {
+			return nil, err
+		}
+		data, err := loadApiData(ctx, db, obj, kind)
+		if err != nil {
+			return nil, err
+		}
+		var state BeaconState
+		if err := state.UnmarshalSSZ(data); err != nil {
+			return nil, err
+		}
+		prove = state.MerkleProof
+	default:
+		return nil, fmt.Errorf("Unable to build proofs for a %s", kind)
+	}
+
+	proofs := make([]MerkleProof, 0, len(paths))
+	for _, path := range paths {
+		proof, err := prove(path)
+		if err != nil {
+			return nil, &apiError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+// Build a proof that the value at the path is part of the block root.
+func (b *BeaconBlock) MerkleProof(path string) (MerkleProof, error) {
+	node, typ, err := b.Tree()
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	version := "phase0"
+	if b.IsBellatrix() {
+		version = "bellatrix"
+	} else if b.IsAltair() {
+		version = "altair"
+	}
+	return buildMerkleProof(node, typ, version, path)
+}
+
+// Build a proof that the value at the path is part of the state root.
+func (s *BeaconState) MerkleProof(path string) (MerkleProof, error) {
+	node, typ, err := s.Tree()
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	return buildMerkleProof(node, typ, s.Version(), path)
+}
+
+// Check that the proof is valid for its root.
+func VerifyMerkleProof(proof MerkleProof) (bool, error) {
+	root, err := parseRoot(proof.Root)
+	if err != nil {
+		return false, err
+	}
+	leaf, err := parseRoot(proof.Leaf)
+	if err != nil {
+		return false, err
+	}
+	branch := make([]Root, 0, len(proof.Branch))
+	for _, s := range proof.Branch {
+		node, err := parseRoot(s)
+		if err != nil {
+			return false, err
+		}
+		branch = append(branch, node)
+	}
+	return VerifyMerkleBranch(leaf, branch, proof.Gindex, root), nil
+}
+
+// Check that the branch proves the leaf at the generalized index is part of the root.
+func VerifyMerkleBranch(leaf Root, branch []Root, gindex uint64, root Root) bool {
+	if gindex == 0 || len(branch) != bits.Len64(gindex)-1 {
+		return false
+	}
+	value := leaf
+	for i, sibling := range branch {
+		if (gindex>>uint(i))&1 == 1 {
+			value = sha256.Sum256(append(sibling[:], value[:]...))
+		} else {
+			value = sha256.Sum256(append(value[:], sibling[:]...))
+		}
+	}
+	return value == root
+}
+
+// Compute the generalized index of the path within an object of the given type. Paths use the field names of the
+// consensus specs, separated by dots, with indices into lists and vectors in square brackets. Only the type is known,
+// so list indices are checked against the limit of the list, not its length.
+func ResolveGindex(typ view.TypeDef, path string) (uint64, error) {
+	return resolveGindex(typ, path, nil)
+}
+
+// Compute the generalized index of the path. When listLength is provided, it returns the length of the list at the
+// given generalized index, and list indices are checked against it.
+func resolveGindex(typ view.TypeDef, path string, listLength func(gindex uint64) (uint64, error)) (uint64, error) {
+	gindex := uint64(1)
+	descend := func(depth uint8, index uint64) error {
+		if bits.Len64(gindex)+int(depth) > 64 {
+			return fmt.Errorf("The path %s is too deep to prove", path)
+		}
+		gindex = gindex<<depth | index
+		return nil
+	}
+	// Descend into a list or vector of the given chunk count, mixing in the length of a list first.
+	descendSeq := func(isList bool, chunks uint64, chunk uint64) error {
+		if isList {
+			if err := descend(1, 0); err != nil {
+				return err
+			}
+		}
+		return descend(tree.CoverDepth(chunks), chunk)
+	}
+
+	if path == "" {
+		return gindex, nil
+	}
+	for _, step := range strings.Split(path, ".") {
+		match := proofPathStep.FindStringSubmatch(step)
+		if match == nil {
+			return 0, fmt.Errorf("Invalid step %q in the path %s", step, path)
+		}
+		container, ok := typ.(*view.ContainerTypeDef)
+		if !ok {
+			return 0, fmt.Errorf("Unable to select the field %s in the path %s, it is not a container", match[1], path)
+		}
+		field := -1
+		for i, f := range container.Fields {
+			if f.Name == match[1] {
+				field = i
+				break
+			}
+		}
+		if field < 0 {
+			return 0, fmt.Errorf("The %s container has no field %s", container.ContainerName, match[1])
+		}
+		if err := descend(tree.CoverDepth(uint64(len(container.Fields))), uint64(field)); err != nil {
+			return 0, err
+		}
+		typ = container.Fields[field].Type
+
+		for _, indexStr := range strings.Split(strings.Trim(match[2], "[]"), "][") {
+			if indexStr == "" {
+				continue
+			}
+			index, err := strconv.ParseUint(indexStr, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			var (
+				isList bool
+				length uint64 // The number of elements.
+				chunks uint64 // The number of leaves of the data tree.
+				chunk  uint64 // The leaf containing the element.
+			)
+			switch t := typ.(type) {
+			case *view.ComplexListTypeDef:
+				isList, length, chunks, chunk, typ = true, t.ListLimit, t.ListLimit, index, t.ElemType
+			case *view.ComplexVectorTypeDef:
+				length, chunks, chunk, typ = t.VectorLength, t.VectorLength, index, t.ElemType
+			case *view.BasicListTypeDef:
+				size := t.ElemType.TypeByteLength()
+				isList, length, chunks, chunk, typ = true, t.ListLimit, (t.ListLimit*size+31)/32, index*size/32, t.ElemType
+			case *view.BasicVectorTypeDef:
+				size := t.ElemType.TypeByteLength()
+				length, chunks, chunk, typ = t.VectorLength, (t.VectorLength*size+31)/32, index*size/32, t.ElemType
+			default:
+				return 0, fmt.Errorf("Unable to index %s in the path %s, it is not a list or vector", match[1], path)
+			}
+			if isList && listLength != nil {
+				if length, err = listLength(gindex); err != nil {
+					return 0, err
+				}
+			}
+			if index >= length {
+				return 0, fmt.Errorf("The index %d is out of range in the path %s", index, path)
+			}
+			if err := descendSeq(isList, chunks, chunk); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return gindex, nil
+}
+
+// Build the proof for a path within a tree.
+func buildMerkleProof(node tree.Node, typ view.TypeDef, version string, path string) (MerkleProof, error) {
+	hashFn := tree.GetHashFn()
+	// The length of a list is mixed in as the right child of the list.
+	listLength := func(gindex uint64) (uint64, error) {
+		length, err := node.Getter(tree.Gindex64(gindex<<1 | 1))
+		if err != nil {
+			return 0, err
+		}
+		chunk := length.MerkleRoot(hashFn)
+		return binary.LittleEndian.Uint64(chunk[:8]), nil
+	}
+	gindex, err := resolveGindex(typ, path, listLength)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+	root := node.MerkleRoot(hashFn)
+
+	// Walk down from the root, the sibling at each level is part of the branch.
+	depth := bits.Len64(gindex) - 1
+	branch := make([]string, depth)
+	for i := depth - 1; i >= 0; i-- {
+		var left, right tree.Node
+		if node.IsLeaf() {
+			// Unused parts of lists are stored as the root of an empty subtree, which has no children to navigate.
+			if node.MerkleRoot(hashFn) != tree.ZeroHashes[i+1] {
+				return MerkleProof{}, fmt.Errorf("Unable to navigate to the path %s", path)
+			}
+			left, right = &tree.ZeroHashes[i], &tree.ZeroHashes[i]
+		} else {
+			if left, err = node.Left(); err != nil {
+				return MerkleProof{}, err
+			}
+			if right, err = node.Right(); err != nil {
+				return MerkleProof{}, err
+			}
+		}
+		if (gindex>>uint(i))&1 == 1 {
+			node, branch[i] = right, toHex(Root(left.MerkleRoot(hashFn)))
+		} else {
+			node, branch[i] = left, toHex(Root(right.MerkleRoot(hashFn)))
+		}
+	}
+
+	return MerkleProof{
+		Version: version,
+		Path:    path,
+		Gindex:  gindex,
+		Root:    toHex(Root(root)),
+		Leaf:    toHex(Root(node.MerkleRoot(hashFn))),
+		Branch:  branch,
+	}, nil
+}
+
+// Parse a 0x prefixed 32 byte root.
+func parseRoot(s string) (Root, error) {
+	var root Root
+	data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return root, err
+	}
+	if len(data) != len(root) {
+		return root, fmt.Errorf("Invalid root: %s", s)
+	}
+	copy(root[:], data)
+	return root, nil
+}
@@ -0,0 +1,123 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	beaconclient "github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Proof", Label("unit"), func() {
+	spec := configs.Mainnet
+	message := bellatrix.SignedBeaconBlock{}
+	message.Message.Slot = 4700013
+	message.Message.Body.SyncAggregate.SyncCommitteeBits = make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)
+	message.Message.Body.ExecutionPayload.BlockHash[0] = 0xaa
+	message.Message.Body.ExecutionPayload.Transactions = common.PayloadTransactions{common.Transaction{1, 2}, common.Transaction{3}}
+	var buf bytes.Buffer
+	if err := message.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		panic(err)
+	}
+	var block beaconclient.SignedBeaconBlock
+	if err := block.UnmarshalSSZForFork(spec, "bellatrix", buf.Bytes()); err != nil {
+		panic(err)
+	}
+
+	Describe("Resolving a path", func() {
+		It("Should compute the generalized index from the field names", func() {
+			typ := bellatrix.BeaconBlockType(spec)
+			gindex, err := beaconclient.ResolveGindex(typ, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gindex).To(Equal(uint64(1)))
+			gindex, err = beaconclient.ResolveGindex(typ, "state_root")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gindex).To(Equal(uint64(11)))
+			gindex, err = beaconclient.ResolveGindex(typ, "body.execution_payload.block_hash")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gindex).To(Equal(uint64(3228)))
+		})
+		It("Should compute the generalized index of the elements of a list", func() {
+			typ := phase0.BeaconStateType(spec)
+			// The balances are packed four to a chunk, below the length mix-in of the list.
+			gindex, err := beaconclient.ResolveGindex(typ, "balances[3]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gindex).To(Equal(uint64(44*2) << 38))
+			gindex, err = beaconclient.ResolveGindex(typ, "balances[4]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gindex).To(Equal(uint64(44*2)<<38 + 1))
+		})
+		It("Should reject paths that are not in the type", func() {
+			typ := bellatrix.BeaconBlockType(spec)
+			for _, path := range []string{"nope", "Slot", "slot[1]", "slot.value", "body.attestations[128]", "body..graffiti"} {
+				_, err := beaconclient.ResolveGindex(typ, path)
+				Expect(err).To(HaveOccurred(), path)
+			}
+		})
+	})
+
+	Describe("Building a proof", func() {
+		It("Should build proofs against the block root that verify", func() {
+			root := block.Block().HashTreeRoot()
+			for _, path := range []string{"slot", "body.execution_payload.block_hash", "body.execution_payload.transactions[1]", "body.sync_aggregate.sync_committee_bits"} {
+				proof, err := block.Block().MerkleProof(path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(proof.Version).To(Equal("bellatrix"))
+				Expect(proof.Root).To(Equal("0x" + hex.EncodeToString(root[:])))
+				valid, err := beaconclient.VerifyMerkleProof(proof)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(valid).To(BeTrue(), path)
+			}
+
+			proof, err := block.Block().MerkleProof("body.execution_payload.block_hash")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(proof.Leaf).To(Equal("0xaa00000000000000000000000000000000000000000000000000000000000000"))
+			Expect(proof.Branch).To(HaveLen(11))
+		})
+		It("Should reject list indices beyond the length of the list", func() {
+			for _, path := range []string{"body.execution_payload.transactions[2]", "body.attestations[3]", "body.execution_payload.transactions[0][2]"} {
+				_, err := block.Block().MerkleProof(path)
+				Expect(err).To(HaveOccurred(), path)
+			}
+			_, err := block.Block().MerkleProof("body.execution_payload.transactions[0][1]")
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Should not verify a proof that was changed", func() {
+			proof, err := block.Block().MerkleProof("slot")
+			Expect(err).ToNot(HaveOccurred())
+			proof.Leaf = "0x0000000000000000000000000000000000000000000000000000000000000000"
+			valid, err := beaconclient.VerifyMerkleProof(proof)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(valid).To(BeFalse())
+
+			proof, err = block.Block().MerkleProof("slot")
+			Expect(err).ToNot(HaveOccurred())
+			proof.Gindex = 9
+			valid, err = beaconclient.VerifyMerkleProof(proof)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(valid).To(BeFalse())
+		})
+	})
+})
@@ -20,14 +20,44 @@ package beaconclient
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
 )
 
+// The classes of errors that can occur when fetching a slot from the Beacon Server.
+const (
+	ErrorClassRequest  = "request"  // The request could not be made, or the response could not be read.
+	ErrorClassResponse = "response" // The Beacon Server responded with an error status.
+	ErrorClassDecode   = "decode"   // The response could not be decoded.
+)
+
+// An error that occurred when fetching a slot, along with its class and the response status, if there was one.
+type SlotError struct {
+	Class      string // The class of the error, for example request, response or decode.
+	StatusCode int    // The status of the response, 0 if there was no response.
+	Err        error  // The underlying error.
+}
+
+func (e *SlotError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SlotError) Unwrap() error {
+	return e.Err
+}
+
+// How long a JSON query to the Beacon Server may take, including reading the response body.
+const jsonQueryTimeout = 30 * time.Second
+
+// The client used for JSON queries. Unlike http.Get, it will not wait forever on a Beacon Server that stops responding.
+var jsonClient = &http.Client{Timeout: jsonQueryTimeout}
+
 // Object to unmarshal the BlockRootResponse
 type BlockRootResponse struct {
 	Data BlockRootMessage `json:"data"`
@@ -38,35 +68,135 @@ type BlockRootMessage struct {
 	Root string `json:"root"`
 }
 
+// Object to unmarshal the BlockHeaderResponse
+type BlockHeaderResponse struct {
+	Data BlockHeaderData `json:"data"`
+}
+
+// Object to unmarshal the data within the BlockHeaderResponse
+type BlockHeaderData struct {
+	Root      string              `json:"root"`
+	Canonical bool                `json:"canonical"`
+	Header    SignedHeaderMessage `json:"header"`
+}
+
+// Object to unmarshal the signed header within the BlockHeaderResponse
+type SignedHeaderMessage struct {
+	Message   HeaderMessage `json:"message"`
+	Signature string        `json:"signature"`
+}
+
+// Object to unmarshal the BeaconBlockHeader itself
+type HeaderMessage struct {
+	Slot          string `json:"slot"`
+	ProposerIndex string `json:"proposer_index"`
+	ParentRoot    string `json:"parent_root"`
+	StateRoot     string `json:"state_root"`
+	BodyRoot      string `json:"body_root"`
+}
+
+// Object to unmarshal the StateRootResponse
+type StateRootResponse struct {
+	Data StateRootMessage `json:"data"`
+}
+
+// Object to unmarshal the StateRoot Message
+type StateRootMessage struct {
+	Root string `json:"root"`
+}
+
+// Object to unmarshal the FinalityCheckpointsResponse
+type FinalityCheckpointsResponse struct {
+	Data FinalityCheckpoints `json:"data"`
+}
+
+// Object to unmarshal the checkpoints within the FinalityCheckpointsResponse
+type FinalityCheckpoints struct {
+	PreviousJustified Checkpoint `json:"previous_justified"`
+	CurrentJustified  Checkpoint `json:"current_justified"`
+	Finalized         Checkpoint `json:"finalized"`
+}
+
+// Object to unmarshal a single checkpoint
+type Checkpoint struct {
+	Epoch string `json:"epoch"`
+	Root  string `json:"root"`
+}
+
+// A helper function to query endpoints that return JSON. The status code is returned
+// so the caller can distinguish a missing object (404) from an actual error.
+func queryJson(endpoint string, v interface{}) (int, error) {
+	log.WithFields(log.Fields{"endpoint": endpoint}).Debug("Querying endpoint")
+	response, err := jsonClient.Get(endpoint)
+	if err != nil {
+		loghelper.LogEndpoint(endpoint).WithField("err", err).Error("Unable to query Beacon Node!")
+		return 0, fmt.Errorf("Unable to query Beacon Node: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	rc := response.StatusCode
+	// Any 2xx code is OK.
+	if rc < 200 || rc >= 300 {
+		return rc, fmt.Errorf("HTTP Error: %d", rc)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		loghelper.LogEndpoint(endpoint).WithField("err", err).Error("Unable to read the response body!")
+		return rc, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		loghelper.LogEndpoint(endpoint).WithFields(log.Fields{
+			"rawMessage": string(body),
+			"err":        err,
+		}).Error("Unable to unmarshal the response")
+		return rc, err
+	}
+	return rc, nil
+}
+
 // A helper function to query endpoints that utilize slots.
-func querySsz(endpoint string, slot Slot) ([]byte, int, error) {
+// The memory for the response is acquired from the reservation, based on its Content-Length, before the body is downloaded.
+func querySsz(endpoint string, slot Slot, memory *memoryReservation) ([]byte, int, error) {
 	log.WithFields(log.Fields{"endpoint": endpoint}).Debug("Querying endpoint")
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		loghelper.LogSlotError(slot.Number(), err).Error("Unable to create a request!")
-		return nil, 0, fmt.Errorf("Unable to create a request!: %s", err.Error())
+		memory.skip()
+		return nil, 0, &SlotError{Class: ErrorClassRequest, Err: fmt.Errorf("Unable to create a request!: %s", err.Error())}
 	}
 	req.Header.Set("Accept", "application/octet-stream")
 	response, err := client.Do(req)
 	if err != nil {
 		loghelper.LogSlotError(slot.Number(), err).Error("Unable to query Beacon Node!")
-		return nil, 0, fmt.Errorf("Unable to query Beacon Node: %s", err.Error())
+		memory.skip()
+		return nil, 0, &SlotError{Class: ErrorClassRequest, Err: fmt.Errorf("Unable to query Beacon Node: %s", err.Error())}
 	}
 	defer response.Body.Close()
 
 	rc := response.StatusCode
 	// Any 2xx code is OK.
 	if rc < 200 || rc >= 300 {
-		return nil, rc, fmt.Errorf("HTTP Error: %d", rc)
+		memory.skip()
+		return nil, rc, &SlotError{Class: ErrorClassResponse, StatusCode: rc, Err: fmt.Errorf("HTTP Error: %d", rc)}
+	}
+
+	if err := memory.acquire(response.ContentLength); err != nil {
+		loghelper.LogSlotError(slot.Number(), err).Error("Unable to acquire memory for the response!")
+		return nil, rc, fmt.Errorf("Unable to acquire memory for the response: %s", err.Error())
 	}
 
 	var body bytes.Buffer
+	if response.ContentLength > 0 {
+		body.Grow(int(response.ContentLength))
+	}
 	buf := bufio.NewWriter(&body)
 	_, err = io.Copy(buf, response.Body)
 	if err != nil {
 		loghelper.LogSlotError(slot.Number(), err).Error("Unable to turn response into a []bytes array!")
-		return nil, rc, fmt.Errorf("Unable to turn response into a []bytes array!: %s", err.Error())
+		return nil, rc, &SlotError{Class: ErrorClassRequest, StatusCode: rc, Err: fmt.Errorf("Unable to turn response into a []bytes array!: %s", err.Error())}
 	}
 
 	return body.Bytes(), rc, nil
@@ -0,0 +1,69 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/reader"
+)
+
+var _ = Describe("Reader", Label("unit", "behavioral", "reader"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When reading the stored objects", func() {
+		It("Should decode the blocks and states by slot, root and key", func() {
+			ctx := context.Background()
+			rd := reader.NewReader(bc.Db, nil)
+			head := BeaconNodeTester.TestEvents["100"].HeadMessage
+			dbBlock := queryDbSignedBeaconBlock(bc.Db, head.Slot, head.Block)
+
+			block, err := rd.SignedBeaconBlockBySlot(ctx, 100)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Version()).To(Equal("phase0"))
+			Expect(block.Block().Slot()).To(Equal(beaconclient.Slot(100)))
+			byRoot, err := rd.SignedBeaconBlockByRoot(ctx, head.Block)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(byRoot.Block().HashTreeRoot()).To(Equal(block.Block().HashTreeRoot()))
+			byMhKey, err := rd.SignedBeaconBlockByMhKey(ctx, dbBlock.MhKey)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(byMhKey.Block().HashTreeRoot()).To(Equal(block.Block().HashTreeRoot()))
+
+			state, err := rd.BeaconStateBySlot(ctx, 100)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Slot()).To(Equal(beaconclient.Slot(100)))
+			state, err = rd.BeaconStateByRoot(ctx, head.State)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Slot()).To(Equal(beaconclient.Slot(100)))
+
+			slots, err := rd.CanonicalSlots(ctx, 99, 101)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(slots).To(HaveLen(2))
+			Expect(slots[0].Slot).To(Equal(uint64(100)))
+			Expect(*slots[0].BlockRoot).To(Equal(head.Block))
+			Expect(slots[0].Status).To(Equal("proposed"))
+
+			_, err = rd.SignedBeaconBlockBySlot(ctx, 99)
+			Expect(err).To(MatchError(reader.ErrNotFound))
+		})
+	})
+})
@@ -0,0 +1,109 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the per slot progress tracking for the rows checked out from
+// eth_beacon.historic_process and eth_beacon.known_gaps.
+
+package beaconclient
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Mark a single slot within the row as complete, and return whether every slot within the row is complete.
+	// Only the bits of the slots within the row are ever set, so the row is complete once all of them are.
+	completeHpSlotStmt string = `UPDATE eth_beacon.historic_process
+	SET completed_slots=set_bit(COALESCE(completed_slots, decode(repeat('00', (($2::bigint - $1::bigint) / 8 + 1)::int), 'hex')), $3::int, 1)
+	WHERE start_slot=$1 AND end_slot=$2
+	RETURNING bit_count(completed_slots) = end_slot - start_slot + 1;`
+	completeKgSlotStmt string = `UPDATE eth_beacon.known_gaps
+	SET completed_slots=set_bit(COALESCE(completed_slots, decode(repeat('00', (($2::bigint - $1::bigint) / 8 + 1)::int), 'hex')), $3::int, 1)
+	WHERE start_slot=$1 AND end_slot=$2
+	RETURNING bit_count(completed_slots) = end_slot - start_slot + 1;`
+)
+
+// A bitmap of the completed slots within a row. It uses the same bit order as set_bit in postgres,
+// bit n is the n%8 least significant bit of byte n/8.
+type slotProgress []byte
+
+// Has the slot at the given offset from the start of the row been completed.
+func (p slotProgress) isComplete(offset uint64) bool {
+	if offset/8 >= uint64(len(p)) {
+		return false
+	}
+	return p[offset/8]&(1<<(offset%8)) != 0
+}
+
+// Has every slot within the row been completed.
+func (p slotProgress) isRangeComplete(slots slotsToProcess) bool {
+	if slots.startSlot > slots.endSlot {
+		return false
+	}
+	for offset := uint64(0); offset <= uint64(slots.endSlot-slots.startSlot); offset++ {
+		if !p.isComplete(offset) {
+			return false
+		}
+	}
+	return true
+}
+
+// Has the slot within the row been completed.
+func (slots slotsToProcess) isSlotComplete(slot Slot) bool {
+	if slot < slots.startSlot || slot > slots.endSlot {
+		return false
+	}
+	return slots.completed.isComplete(uint64(slot - slots.startSlot))
+}
+
+// Record that a slot within the row is complete. Once every slot within the row is complete, the row is removed.
+// Slots outside of the row are ignored, and so are rows that no longer exist.
+func completeSlotInRow(db sql.Database, completeSlotStmt string, removeStmt string, slots slotsToProcess, slot Slot) error {
+	if slot < slots.startSlot || slot > slots.endSlot {
+		return nil
+	}
+	var complete bool
+	err := db.QueryRow(context.Background(), completeSlotStmt, slots.startSlot.Number(), slots.endSlot.Number(), int(slot-slots.startSlot)).Scan(&complete)
+	if err == pgx.ErrNoRows {
+		log.WithFields(log.Fields{
+			"startSlot": slots.startSlot,
+			"endSlot":   slots.endSlot,
+			"slot":      slot,
+		}).Debug("The row has already been removed")
+		return nil
+	}
+	if err != nil {
+		loghelper.LogSlotError(slot.Number(), err).WithField("statement", completeSlotStmt).Error("Unable to mark the slot as complete")
+		return err
+	}
+	if !complete {
+		return nil
+	}
+
+	if _, err := db.Exec(context.Background(), removeStmt, slots.startSlot.Number(), slots.endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(slots.startSlot.Number(), slots.endSlot.Number(), err).Error("Unable to remove the completed row")
+		return err
+	}
+	log.WithFields(log.Fields{
+		"startSlot": slots.startSlot,
+		"endSlot":   slots.endSlot,
+	}).Debug("Every slot in the row is complete, removed the row")
+	return nil
+}
@@ -0,0 +1,47 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Slotprogress", Label("unit", "behavioral", "progress"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpMockedTest()
+	})
+
+	Context("When some slots within the row were already completed", func() {
+		It("Should only process the remaining slots and remove the row", func() {
+			BeaconNodeTester.writeEventToHistoricProcess(bc, 100, 101, 10)
+			_, err := bc.Db.Exec(context.Background(), `UPDATE eth_beacon.historic_process SET completed_slots='\x01'::bytea`)
+			Expect(err).ToNot(HaveOccurred())
+
+			BeaconNodeTester.runHistoricalProcess(bc, 2, 1, 0, 0, 0)
+			validateSlot(bc, BeaconNodeTester.TestEvents["101"].HeadMessage, 3, "proposed")
+
+			var remaining int
+			err = bc.Db.QueryRow(context.Background(), `SELECT count(*) FROM eth_beacon.historic_process`).Scan(&remaining)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(remaining).To(Equal(0))
+		})
+	})
+})
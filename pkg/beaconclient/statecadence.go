@@ -0,0 +1,140 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the logic used to decide which slots we store BeaconStates for.
+
+package beaconclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	NotFinalizedStateCadence error = fmt.Errorf("The BeaconState will be stored once the epoch is finalized.")
+)
+
+// Describes which slots we fetch and store BeaconStates for. The zero value stores the BeaconState for every slot.
+type StateCadence struct {
+	Interval  uint64 // Store the BeaconState for every slot that is a multiple of Interval. 0 and 1 store every slot.
+	Finalized bool   // Only store the BeaconStates of epoch boundaries that have been finalized.
+}
+
+// Parse the state cadence provided by the user. The accepted values are:
+//
+// "slot" - Store the BeaconState for every slot.
+//
+// "epoch" - Store the BeaconState for every epoch boundary.
+//
+// "finalized" - Store the BeaconState for every finalized epoch boundary.
+//
+// N - Store the BeaconState for every Nth slot.
+func ParseStateCadence(cadence string) (StateCadence, error) {
+	switch strings.ToLower(strings.TrimSpace(cadence)) {
+	case "", "slot":
+		return StateCadence{Interval: 1}, nil
+	case "epoch":
+		return StateCadence{Interval: bcSlotsPerEpoch}, nil
+	case "finalized":
+		return StateCadence{Interval: bcSlotsPerEpoch, Finalized: true}, nil
+	}
+	interval, err := strconv.ParseUint(cadence, 10, 64)
+	if err != nil || interval == 0 {
+		return StateCadence{}, fmt.Errorf("Invalid state cadence %q, use slot, epoch, finalized or a positive number of slots", cadence)
+	}
+	return StateCadence{Interval: interval}, nil
+}
+
+func (sc StateCadence) String() string {
+	switch {
+	case sc.Finalized:
+		return "finalized"
+	case sc.Interval <= 1:
+		return "slot"
+	case sc.Interval == bcSlotsPerEpoch:
+		return "epoch"
+	default:
+		return strconv.FormatUint(sc.Interval, 10)
+	}
+}
+
+// Does the slot fall on the cadence. Finality is not considered.
+func (sc StateCadence) isOnCadence(slot Slot) bool {
+	if sc.Interval <= 1 {
+		return true
+	}
+	return slot.Number()%sc.Interval == 0
+}
+
+// Has the slot been finalized, for cadences that only store finalized BeaconStates.
+// Every slot is treated as finalized for the other cadences.
+func (spd SlotProcessingDetails) isFinalizedForCadence(slot Slot) bool {
+	if !spd.StateCadence.Finalized {
+		return true
+	}
+	var finalizedEpoch uint64
+	if spd.FinalizedEpoch != nil {
+		finalizedEpoch = atomic.LoadUint64(spd.FinalizedEpoch)
+	}
+	return calculateEpoch(slot, bcSlotsPerEpoch) <= finalizedEpoch
+}
+
+// Should we fetch and store the BeaconState for the given slot.
+func (spd SlotProcessingDetails) shouldStoreState(slot Slot) bool {
+	return spd.PerformBeaconStateProcessing && spd.StateCadence.isOnCadence(slot) && spd.isFinalizedForCadence(slot)
+}
+
+// Query the beacon server for the latest finalized epoch, and store it.
+// Nothing is done unless the cadence only stores finalized BeaconStates.
+func (bc *BeaconClient) refreshFinalizedEpoch() {
+	if !bc.StateCadence.Finalized {
+		return
+	}
+	finalizedEpoch, err := queryFinalizedEpoch(bc.ServerEndpoint)
+	if err != nil {
+		loghelper.LogError(err).Warn("Unable to update the finalized epoch")
+		return
+	}
+	if atomic.SwapUint64(&bc.FinalizedEpoch, finalizedEpoch) != finalizedEpoch {
+		log.WithField("finalizedEpoch", finalizedEpoch).Debug("Updated the finalized epoch")
+	}
+}
+
+// Query the beacon server for the latest finalized epoch.
+func queryFinalizedEpoch(serverEndpoint string) (uint64, error) {
+	var checkpoints FinalityCheckpointsResponse
+	if _, err := queryJson(serverEndpoint+BcFinalityCheckpointsEndpoint, &checkpoints); err != nil {
+		return 0, err
+	}
+	finalizedEpoch, err := strconv.ParseUint(checkpoints.Data.Finalized.Epoch, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse the finalized epoch: %w", err)
+	}
+	return finalizedEpoch, nil
+}
+
+// Query the beacon server for the first slot of the latest finalized epoch. Every slot up to and including it is final.
+func QueryFinalizedSlot(serverEndpoint string) (Slot, error) {
+	finalizedEpoch, err := queryFinalizedEpoch(serverEndpoint)
+	if err != nil {
+		return 0, err
+	}
+	return Slot(finalizedEpoch * bcSlotsPerEpoch), nil
+}
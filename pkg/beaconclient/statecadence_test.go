@@ -0,0 +1,53 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	beaconclient "github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Statecadence", Label("unit"), func() {
+	Describe("Parsing the state cadence", func() {
+		It("Should accept the named cadences", func() {
+			cadence, err := beaconclient.ParseStateCadence("slot")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cadence).To(Equal(beaconclient.StateCadence{Interval: 1}))
+
+			cadence, err = beaconclient.ParseStateCadence("Epoch")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cadence).To(Equal(beaconclient.StateCadence{Interval: 32}))
+
+			cadence, err = beaconclient.ParseStateCadence("finalized")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cadence).To(Equal(beaconclient.StateCadence{Interval: 32, Finalized: true}))
+			Expect(cadence.String()).To(Equal("finalized"))
+		})
+		It("Should accept a number of slots", func() {
+			cadence, err := beaconclient.ParseStateCadence("64")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cadence).To(Equal(beaconclient.StateCadence{Interval: 64}))
+			Expect(cadence.String()).To(Equal("64"))
+		})
+		It("Should reject invalid cadences", func() {
+			_, err := beaconclient.ParseStateCadence("0")
+			Expect(err).To(HaveOccurred())
+			_, err = beaconclient.ParseStateCadence("hourly")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,290 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains the functions used to verify the SSZ objects stored in the DB against their roots.
+
+package beaconclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+var (
+	// Get the slots to verify, along with the keys of their stored objects. A key is null when the
+	// eth_beacon.signed_block or eth_beacon.state row does not exist.
+	queryVerifySlotsStmt string = `SELECT s.slot, s.block_root, s.state_root, s.status,
+	sb.mh_key AS block_mh_key, st.mh_key AS state_mh_key
+	FROM eth_beacon.slots s
+	LEFT JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	LEFT JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root
+	WHERE s.slot >= $1 AND s.slot <= $2 AND s.status <> 'skipped'
+	ORDER BY s.slot ASC, s.block_root ASC;`
+	// Get a single object from public.blocks.
+	queryBlocksDataStmt string = `SELECT data FROM public.blocks WHERE key=$1;`
+	// Remove a SignedBeaconBlock or BeaconState row that failed verification, so reprocessing writes it again.
+	deleteVerifySignedBlockStmt string = `DELETE FROM eth_beacon.signed_block WHERE slot=$1 AND block_root=$2;`
+	deleteVerifyStateStmt       string = `DELETE FROM eth_beacon.state WHERE slot=$1 AND state_root=$2;`
+	// Remove an object from public.blocks, unless another row still refers to it. The object is only written
+	// when its key does not exist, so a damaged object has to be removed before it can be written again.
+	deleteVerifyBlocksDataStmt string = `DELETE FROM public.blocks WHERE key=$1
+	AND NOT EXISTS (SELECT 1 FROM eth_beacon.signed_block WHERE mh_key=$1)
+	AND NOT EXISTS (SELECT 1 FROM eth_beacon.state WHERE mh_key=$1);`
+)
+
+// The problems that verification can find.
+const (
+	VerifyMissingBlock           = "missingBlock"           // The slot has no eth_beacon.signed_block row.
+	VerifyMissingBlockData       = "missingBlockData"       // The SignedBeaconBlock is not in public.blocks.
+	VerifyMissingStateData       = "missingStateData"       // The BeaconState is not in public.blocks.
+	VerifyDecodeBlock            = "decodeBlock"            // The SignedBeaconBlock could not be decoded.
+	VerifyDecodeState            = "decodeState"            // The BeaconState could not be decoded.
+	VerifyBlockRootMismatch      = "blockRootMismatch"      // The HashTreeRoot of the block does not match block_root.
+	VerifyBlockStateRootMismatch = "blockStateRootMismatch" // The StateRoot within the block does not match state_root.
+	VerifyStateRootMismatch      = "stateRootMismatch"      // The HashTreeRoot of the state does not match state_root.
+)
+
+// A single problem found by verification.
+type VerifyIssue struct {
+	Slot      uint64 `json:"slot"`      // The slot.
+	Status    string `json:"status"`    // The status of the slot, proposed or forked.
+	BlockRoot string `json:"blockRoot"` // The block_root in eth_beacon.slots.
+	StateRoot string `json:"stateRoot"` // The state_root in eth_beacon.slots.
+	Kind      string `json:"kind"`      // The kind of problem, for example blockRootMismatch.
+	Detail    string `json:"detail"`    // The recomputed root or the error, if there is one.
+}
+
+// The outcome of verifying a range of slots.
+type VerifyReport struct {
+	StartSlot      uint64        `json:"startSlot"`      // The first slot verified.
+	EndSlot        uint64        `json:"endSlot"`        // The last slot verified.
+	SlotsChecked   uint64        `json:"slotsChecked"`   // The number of eth_beacon.slots rows checked.
+	BlocksVerified uint64        `json:"blocksVerified"` // The number of SignedBeaconBlocks whose roots matched.
+	StatesVerified uint64        `json:"statesVerified"` // The number of BeaconStates whose roots matched.
+	Issues         []VerifyIssue `json:"issues"`         // The problems that were found.
+	Enqueued       []uint64      `json:"enqueued"`       // The slots whose damaged objects were removed, and that were added to eth_beacon.known_gaps.
+}
+
+// A row returned by queryVerifySlotsStmt.
+type verifySlotRow struct {
+	Slot       uint64
+	BlockRoot  string
+	StateRoot  string
+	Status     string
+	BlockMhKey *string
+	StateMhKey *string
+}
+
+// Load the SignedBeaconBlocks and BeaconStates stored for the slots from startSlot to endSlot, recompute their
+// roots, and compare them with the roots in the DB. Only one object is held in memory at a time.
+// When enqueue is true, the objects with problems are removed and their slots are added to eth_beacon.known_gaps,
+// so known gaps processing downloads and writes them again.
+func VerifySlots(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot, enqueue bool) (VerifyReport, error) {
+	if endSlot < startSlot {
+		return VerifyReport{}, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+	var rows []verifySlotRow
+	if err := db.Select(ctx, &rows, queryVerifySlotsStmt, startSlot.Number(), endSlot.Number()); err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to get the slots to verify")
+		return VerifyReport{}, err
+	}
+
+	report := VerifyReport{StartSlot: startSlot.Number(), EndSlot: endSlot.Number(), Issues: []VerifyIssue{}, Enqueued: []uint64{}}
+	for _, row := range rows {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+		report.SlotsChecked++
+		issues, err := verifySlot(ctx, db, row, &report)
+		if err != nil {
+			return report, err
+		}
+		if len(issues) == 0 {
+			continue
+		}
+		report.Issues = append(report.Issues, issues...)
+		if !enqueue {
+			continue
+		}
+		if err := repairVerifiedSlot(ctx, db, row, issues); err != nil {
+			return report, err
+		}
+		report.Enqueued = append(report.Enqueued, row.Slot)
+	}
+
+	log.WithFields(log.Fields{
+		"startSlot":      startSlot,
+		"endSlot":        endSlot,
+		"slotsChecked":   report.SlotsChecked,
+		"blocksVerified": report.BlocksVerified,
+		"statesVerified": report.StatesVerified,
+		"issues":         len(report.Issues),
+	}).Info("Verified the stored slots")
+	return report, nil
+}
+
+// Verify the objects stored for a single slot. Only errors from the DB are returned, problems with the
+// stored objects are returned as issues.
+func verifySlot(ctx context.Context, db sql.Database, row verifySlotRow, report *VerifyReport) ([]VerifyIssue, error) {
+	var issues []VerifyIssue
+	issue := func(kind string, detail string) {
+		issues = append(issues, VerifyIssue{Slot: row.Slot, Status: row.Status, BlockRoot: row.BlockRoot, StateRoot: row.StateRoot, Kind: kind, Detail: detail})
+	}
+
+	if row.BlockMhKey == nil {
+		issue(VerifyMissingBlock, "")
+	} else {
+		data, err := loadBlocksData(ctx, db, *row.BlockMhKey)
+		if err != nil {
+			return nil, err
+		}
+		var block SignedBeaconBlock
+		switch {
+		case data == nil:
+			issue(VerifyMissingBlockData, *row.BlockMhKey)
+		case block.UnmarshalSSZ(data) != nil:
+			issue(VerifyDecodeBlock, "Unable to unmarshal the SignedBeaconBlock")
+		default:
+			blockRoot := toHex(block.Block().HashTreeRoot())
+			blockStateRoot := toHex(block.Block().StateRoot())
+			if blockRoot != row.BlockRoot {
+				issue(VerifyBlockRootMismatch, blockRoot)
+			}
+			if blockStateRoot != row.StateRoot {
+				issue(VerifyBlockStateRootMismatch, blockStateRoot)
+			}
+			if blockRoot == row.BlockRoot && blockStateRoot == row.StateRoot {
+				report.BlocksVerified++
+			}
+		}
+	}
+
+	// BeaconStates are not stored for every slot, so only the states that have a row are verified.
+	if row.StateMhKey != nil {
+		data, err := loadBlocksData(ctx, db, *row.StateMhKey)
+		if err != nil {
+			return nil, err
+		}
+		var state BeaconState
+		switch {
+		case data == nil:
+			issue(VerifyMissingStateData, *row.StateMhKey)
+		case state.UnmarshalSSZ(data) != nil:
+			issue(VerifyDecodeState, "Unable to unmarshal the BeaconState")
+		default:
+			stateRoot := toHex(state.HashTreeRoot())
+			if stateRoot != row.StateRoot {
+				issue(VerifyStateRootMismatch, stateRoot)
+			} else {
+				report.StatesVerified++
+			}
+		}
+	}
+
+	for _, i := range issues {
+		log.WithFields(log.Fields{
+			"slot":   i.Slot,
+			"kind":   i.Kind,
+			"detail": i.Detail,
+		}).Warn("Verification found a problem with the stored slot")
+	}
+	return issues, nil
+}
+
+// Remove the objects of the slot that failed verification, and add the slot to eth_beacon.known_gaps in the same
+// transaction. Reprocessing skips the objects that are already in the DB, so they must be removed first.
+func repairVerifiedSlot(ctx context.Context, db sql.Database, row verifySlotRow, issues []VerifyIssue) error {
+	var badBlock, badState bool
+	for _, i := range issues {
+		switch i.Kind {
+		case VerifyMissingBlockData, VerifyDecodeBlock, VerifyBlockRootMismatch, VerifyBlockStateRootMismatch:
+			badBlock = true
+		case VerifyMissingStateData, VerifyDecodeState, VerifyStateRootMismatch:
+			badState = true
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		loghelper.LogError(err).Error("We are unable to Begin a SQL transaction")
+		return err
+	}
+	defer func() {
+		err := tx.Rollback(ctx)
+		if err != nil && err != pgx.ErrTxClosed {
+			loghelper.LogError(err).Error("We were unable to Rollback a transaction")
+		}
+	}()
+
+	remove := func(deleteRowStmt string, root string, mhKey string) error {
+		if _, err := tx.Exec(ctx, deleteRowStmt, row.Slot, root); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, deleteVerifyBlocksDataStmt, mhKey)
+		return err
+	}
+	if badBlock {
+		if err := remove(deleteVerifySignedBlockStmt, row.BlockRoot, *row.BlockMhKey); err != nil {
+			loghelper.LogSlotError(row.Slot, err).Error("Unable to remove the SignedBeaconBlock that failed verification")
+			return err
+		}
+	}
+	if badState {
+		if err := remove(deleteVerifyStateStmt, row.StateRoot, *row.StateMhKey); err != nil {
+			loghelper.LogSlotError(row.Slot, err).Error("Unable to remove the BeaconState that failed verification")
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, UpsertKnownGapsStmt, row.Slot, row.Slot, false, "", fmt.Sprintf("verify found %s", issues[0].Kind), "verify"); err != nil {
+		loghelper.LogSlotError(row.Slot, err).Error("Unable to add the entry to the eth_beacon.known_gaps table")
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		loghelper.LogSlotError(row.Slot, err).Error("Unable to commit the repair of the slot")
+		return err
+	}
+	return nil
+}
+
+// Add a single entry to the eth_beacon.known_gaps table, so the slots are reprocessed.
+func enqueueKnownGap(ctx context.Context, db sql.Database, startSlot Slot, endSlot Slot, entryError error, entryProcess string) error {
+	_, err := db.Exec(ctx, UpsertKnownGapsStmt, startSlot.Number(), endSlot.Number(), false, "", entryError.Error(), entryProcess)
+	if err != nil {
+		loghelper.LogSlotRangeError(startSlot.Number(), endSlot.Number(), err).Error("Unable to add the entry to the eth_beacon.known_gaps table")
+		return err
+	}
+	return nil
+}
+
+// Load a single object from public.blocks, nil is returned when it does not exist.
+func loadBlocksData(ctx context.Context, db sql.Database, key string) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow(ctx, queryBlocksDataStmt, key).Scan(&data)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		loghelper.LogError(err).WithField("key", key).Error("Unable to load the object from public.blocks")
+		return nil, err
+	}
+	return data, nil
+}
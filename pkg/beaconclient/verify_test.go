@@ -0,0 +1,73 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package beaconclient_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+)
+
+var _ = Describe("Verify", Label("unit", "behavioral", "verify"), func() {
+	var bc *beaconclient.BeaconClient
+	BeforeEach(func() {
+		bc = setUpStoredSlots()
+	})
+
+	Context("When verifying the stored slots", func() {
+		It("Should match the roots, and report the missing objects", func() {
+			report, err := beaconclient.VerifySlots(context.Background(), bc.Db, 100, 101, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.SlotsChecked).To(Equal(uint64(2)))
+			Expect(report.BlocksVerified).To(Equal(uint64(2)))
+			Expect(report.Issues).To(BeEmpty())
+
+			_, err = bc.Db.Exec(context.Background(), `DELETE FROM public.blocks WHERE key IN (SELECT mh_key FROM eth_beacon.signed_block WHERE slot=101)`)
+			Expect(err).ToNot(HaveOccurred())
+			report, err = beaconclient.VerifySlots(context.Background(), bc.Db, 100, 101, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Issues).To(HaveLen(1))
+			Expect(report.Issues[0].Slot).To(Equal(uint64(101)))
+			Expect(report.Issues[0].Kind).To(Equal(beaconclient.VerifyMissingBlockData))
+			Expect(report.Enqueued).To(BeEmpty())
+		})
+	})
+	Context("When repairing a damaged object", func() {
+		It("Should write the object again once known gaps are processed", func() {
+			head := BeaconNodeTester.TestEvents["101"].HeadMessage
+			mhKey := BeaconNodeTester.TestEvents["101"].CorrectSignedBeaconBlockMhKey
+			_, err := bc.Db.Exec(context.Background(), `UPDATE public.blocks SET data='\x00'::bytea WHERE key=$1`, mhKey)
+			Expect(err).ToNot(HaveOccurred())
+
+			report, err := beaconclient.VerifySlots(context.Background(), bc.Db, 100, 101, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Issues).To(HaveLen(1))
+			Expect(report.Issues[0].Kind).To(Equal(beaconclient.VerifyDecodeBlock))
+			Expect(report.Enqueued).To(Equal([]uint64{101}))
+
+			BeaconNodeTester.SetupBeaconNodeMock(BeaconNodeTester.TestEvents, BeaconNodeTester.TestConfig.protocol, BeaconNodeTester.TestConfig.address, BeaconNodeTester.TestConfig.port, BeaconNodeTester.TestConfig.dummyParentRoot)
+			BeaconNodeTester.runKnownGapsProcess(bc, 2, 3, 0, 0, 0)
+			validateSignedBeaconBlock(bc, head, BeaconNodeTester.TestEvents["100"].HeadMessage.Block, BeaconNodeTester.TestEvents["101"].CorrectEth1DataBlockHash, mhKey, BeaconNodeTester.TestEvents["101"].CorrectExecutionPayloadHeader)
+
+			report, err = beaconclient.VerifySlots(context.Background(), bc.Db, 100, 101, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Issues).To(BeEmpty())
+			Expect(report.BlocksVerified).To(Equal(uint64(2)))
+		})
+	})
+})
@@ -0,0 +1,228 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a streaming writer for CARv1 and CARv2 files.
+
+package car
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+)
+
+// The versions of the CAR format we can write.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+const (
+	// The multicodec of the index written to CARv2 files.
+	multihashIndexSortedCodec uint64 = 0x0401
+	// The size of the CARv2 header that follows the pragma.
+	v2HeaderSize = 40
+)
+
+// The pragma at the start of every CARv2 file, a DAG-CBOR encoded {version: 2}.
+var v2Pragma = []byte{0x0a, 0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}
+
+// A single entry in the CARv2 index.
+type indexEntry struct {
+	digest []byte
+	offset uint64 // The offset of the section, from the start of the CARv1 payload.
+}
+
+// Writer streams blocks into a CAR file. Each block is written as soon as it is provided, only the
+// index of a CARv2 file is held in memory.
+type Writer struct {
+	w        io.Writer
+	version  int
+	dataSize uint64                             // The number of bytes written to the CARv1 payload.
+	index    map[uint64]map[uint32][]indexEntry // The index entries by multihash code and entry width.
+}
+
+// Create a new Writer and write the header. A CARv2 file requires an io.WriteSeeker, since the header is
+// rewritten with the size of the payload once the Writer is closed.
+func NewWriter(w io.Writer, version int, roots []cid.Cid) (*Writer, error) {
+	cw := &Writer{w: w, version: version}
+	switch version {
+	case V1:
+	case V2:
+		if _, ok := w.(io.WriteSeeker); !ok {
+			return nil, fmt.Errorf("A CARv2 file can only be written to an io.WriteSeeker")
+		}
+		cw.index = make(map[uint64]map[uint32][]indexEntry)
+		// The header is written again once we know the size of the payload.
+		if _, err := w.Write(append(append([]byte{}, v2Pragma...), make([]byte, v2HeaderSize)...)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported CAR version: %d", version)
+	}
+
+	header := encodeV1Header(roots)
+	if err := cw.write(varint.ToUvarint(uint64(len(header))), header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Write a single block to the CAR file.
+func (cw *Writer) Put(c cid.Cid, data []byte) error {
+	offset := cw.dataSize
+	cidBytes := c.Bytes()
+	if err := cw.write(varint.ToUvarint(uint64(len(cidBytes)+len(data))), cidBytes, data); err != nil {
+		return err
+	}
+	if cw.version != V2 {
+		return nil
+	}
+	decoded, err := multihash.Decode(c.Hash())
+	if err != nil {
+		return err
+	}
+	width := uint32(len(decoded.Digest) + 8)
+	if cw.index[decoded.Code] == nil {
+		cw.index[decoded.Code] = make(map[uint32][]indexEntry)
+	}
+	cw.index[decoded.Code][width] = append(cw.index[decoded.Code][width], indexEntry{digest: decoded.Digest, offset: offset})
+	return nil
+}
+
+// Finish the CAR file. For CARv2 files, the index is written after the payload and the header is updated.
+// The underlying writer is not closed.
+func (cw *Writer) Close() error {
+	if cw.version != V2 {
+		return nil
+	}
+	ws := cw.w.(io.WriteSeeker)
+	dataOffset := uint64(len(v2Pragma) + v2HeaderSize)
+	if _, err := ws.Write(cw.encodeIndex()); err != nil {
+		return err
+	}
+
+	header := make([]byte, v2HeaderSize)
+	// The first 16 bytes are the characteristics bitfield, we do not set any of them.
+	binary.LittleEndian.PutUint64(header[16:], dataOffset)
+	binary.LittleEndian.PutUint64(header[24:], cw.dataSize)
+	binary.LittleEndian.PutUint64(header[32:], dataOffset+cw.dataSize)
+	if _, err := ws.Seek(int64(len(v2Pragma)), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(header); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Write to the payload and keep track of its size.
+func (cw *Writer) write(parts ...[]byte) error {
+	for _, p := range parts {
+		n, err := cw.w.Write(p)
+		cw.dataSize += uint64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode the index in the MultihashIndexSorted format. The entries are grouped by multihash code and by
+// width, and each group is sorted by digest.
+func (cw *Writer) encodeIndex() []byte {
+	var buf bytes.Buffer
+	buf.Write(varint.ToUvarint(multihashIndexSortedCodec))
+
+	codes := make([]uint64, 0, len(cw.index))
+	for code := range cw.index {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	_ = binary.Write(&buf, binary.LittleEndian, int32(len(codes)))
+
+	for _, code := range codes {
+		_ = binary.Write(&buf, binary.LittleEndian, code)
+		widths := make([]uint32, 0, len(cw.index[code]))
+		for width := range cw.index[code] {
+			widths = append(widths, width)
+		}
+		sort.Slice(widths, func(i, j int) bool { return widths[i] < widths[j] })
+		_ = binary.Write(&buf, binary.LittleEndian, int32(len(widths)))
+
+		for _, width := range widths {
+			entries := cw.index[code][width]
+			sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].digest, entries[j].digest) < 0 })
+			_ = binary.Write(&buf, binary.LittleEndian, width)
+			_ = binary.Write(&buf, binary.LittleEndian, int64(len(entries))*int64(width))
+			for _, e := range entries {
+				buf.Write(e.digest)
+				_ = binary.Write(&buf, binary.LittleEndian, e.offset)
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// Encode the CARv1 header, the DAG-CBOR encoding of {roots: [...], version: 1}.
+func encodeV1Header(roots []cid.Cid) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0xa2) // A map with two entries.
+	buf.Write(cborHead(3, uint64(len("roots"))))
+	buf.WriteString("roots")
+	buf.Write(cborHead(4, uint64(len(roots))))
+	for _, root := range roots {
+		// A CID is a byte string with tag 42, prefixed by the multibase identity prefix.
+		cidBytes := root.Bytes()
+		buf.Write([]byte{0xd8, 0x2a})
+		buf.Write(cborHead(2, uint64(len(cidBytes)+1)))
+		buf.WriteByte(0x00)
+		buf.Write(cidBytes)
+	}
+	buf.Write(cborHead(3, uint64(len("version"))))
+	buf.WriteString("version")
+	buf.WriteByte(0x01)
+	return buf.Bytes()
+}
+
+// Encode the head of a CBOR data item, the major type and its argument.
+func cborHead(major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return []byte{major | byte(n)}
+	case n <= 0xff:
+		return []byte{major | 24, byte(n)}
+	case n <= 0xffff:
+		b := []byte{major | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	case n <= 0xffffffff:
+		b := []byte{major | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	default:
+		b := []byte{major | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(b[1:], n)
+		return b
+	}
+}
@@ -0,0 +1,117 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package car_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/car"
+)
+
+var _ = Describe("Car", Label("unit"), func() {
+	blocks := [][]byte{[]byte("first block"), []byte("second block")}
+	var cids []cid.Cid
+	for _, data := range blocks {
+		mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		if err != nil {
+			panic(err)
+		}
+		cids = append(cids, cid.NewCidV1(cid.Raw, mh))
+	}
+
+	Describe("Writing a CARv1 file", func() {
+		It("Should write the header followed by every block", func() {
+			var buf bytes.Buffer
+			cw, err := car.NewWriter(&buf, car.V1, cids[:1])
+			Expect(err).ToNot(HaveOccurred())
+			for i := range blocks {
+				Expect(cw.Put(cids[i], blocks[i])).To(Succeed())
+			}
+			Expect(cw.Close()).To(Succeed())
+
+			data := buf.Bytes()
+			headerLen, n, err := varint.FromUvarint(data)
+			Expect(err).ToNot(HaveOccurred())
+			header := data[n : n+int(headerLen)]
+			Expect(header[0]).To(Equal(byte(0xa2)))
+			Expect(bytes.Contains(header, cids[0].Bytes())).To(BeTrue())
+			Expect(bytes.HasSuffix(header, []byte("version\x01"))).To(BeTrue())
+
+			rest := data[n+int(headerLen):]
+			for i := range blocks {
+				sectionLen, n, err := varint.FromUvarint(rest)
+				Expect(err).ToNot(HaveOccurred())
+				section := rest[n : n+int(sectionLen)]
+				cidLen, c, err := cid.CidFromBytes(section)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c).To(Equal(cids[i]))
+				Expect(section[cidLen:]).To(Equal(blocks[i]))
+				rest = rest[n+int(sectionLen):]
+			}
+			Expect(rest).To(BeEmpty())
+		})
+	})
+
+	Describe("Writing a CARv2 file", func() {
+		It("Should wrap the CARv1 payload and add an index", func() {
+			var v1 bytes.Buffer
+			cw, err := car.NewWriter(&v1, car.V1, cids)
+			Expect(err).ToNot(HaveOccurred())
+			for i := range blocks {
+				Expect(cw.Put(cids[i], blocks[i])).To(Succeed())
+			}
+			Expect(cw.Close()).To(Succeed())
+
+			f, err := os.Create(filepath.Join(GinkgoT().TempDir(), "test.car"))
+			Expect(err).ToNot(HaveOccurred())
+			cw, err = car.NewWriter(f, car.V2, cids)
+			Expect(err).ToNot(HaveOccurred())
+			for i := range blocks {
+				Expect(cw.Put(cids[i], blocks[i])).To(Succeed())
+			}
+			Expect(cw.Close()).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			data, err := os.ReadFile(f.Name())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data[:11]).To(Equal([]byte{0x0a, 0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}))
+			dataOffset := binary.LittleEndian.Uint64(data[27:])
+			dataSize := binary.LittleEndian.Uint64(data[35:])
+			indexOffset := binary.LittleEndian.Uint64(data[43:])
+			Expect(dataOffset).To(Equal(uint64(51)))
+			Expect(dataSize).To(Equal(uint64(v1.Len())))
+			Expect(indexOffset).To(Equal(dataOffset + dataSize))
+			Expect(data[dataOffset : dataOffset+dataSize]).To(Equal(v1.Bytes()))
+
+			codec, _, err := varint.FromUvarint(data[indexOffset:])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(codec).To(Equal(uint64(0x0401)))
+		})
+		It("Should not write to a writer that can not seek", func() {
+			_, err := car.NewWriter(&bytes.Buffer{}, car.V2, cids)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
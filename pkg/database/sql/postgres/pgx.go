@@ -194,6 +194,11 @@ func (t pgxTxWrapper) Exec(ctx context.Context, sql string, args ...interface{})
 	return resultWrapper{ct: res}, err
 }
 
+// CopyFrom satisfies sql.Tx
+func (t pgxTxWrapper) CopyFrom(ctx context.Context, tableName []string, columnNames []string, rows [][]interface{}) (int64, error) {
+	return t.tx.CopyFrom(ctx, pgx.Identifier(tableName), columnNames, pgx.CopyFromRows(rows))
+}
+
 // Commit satisfies sql.Tx
 func (t pgxTxWrapper) Commit(ctx context.Context) error {
 	return t.tx.Commit(ctx)
@@ -0,0 +1,113 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a reader for e2store files, the container format used by era files.
+
+package era
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The size of the header in front of every e2store entry: a 2 byte type, a 4 byte length and 2 reserved bytes.
+const headerSize = 8
+
+// The types of the e2store entries found in era files.
+var (
+	TypeVersion                     = [2]byte{0x65, 0x32} // "e2", the first entry of every group.
+	TypeEmpty                       = [2]byte{0x00, 0x00} // An entry with no meaning, used for padding.
+	TypeCompressedSignedBeaconBlock = [2]byte{0x01, 0x00} // A snappy framed SSZ SignedBeaconBlock.
+	TypeCompressedBeaconState       = [2]byte{0x02, 0x00} // A snappy framed SSZ BeaconState.
+	TypeSlotIndex                   = [2]byte{0x69, 0x32} // "i2", the offsets of the entries for each slot.
+)
+
+// A single e2store entry.
+type Entry struct {
+	Type   [2]byte // The type of the entry.
+	Data   []byte  // The data of the entry.
+	Offset int64   // The offset of the header of the entry, from the start of the file.
+}
+
+// E2StoreReader reads the entries of an e2store file in order.
+type E2StoreReader struct {
+	r      io.Reader
+	offset int64
+}
+
+// Create a new E2StoreReader.
+func NewE2StoreReader(r io.Reader) *E2StoreReader {
+	return &E2StoreReader{r: r}
+}
+
+// Read the next entry. io.EOF is returned once every entry has been read.
+func (er *E2StoreReader) Next() (*Entry, error) {
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(er.r, header)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the e2store header at offset %d: %w", er.offset, err)
+	}
+	entry := &Entry{Offset: er.offset}
+	copy(entry.Type[:], header[:2])
+	length := binary.LittleEndian.Uint32(header[2:6])
+	if reserved := binary.LittleEndian.Uint16(header[6:]); reserved != 0 {
+		return nil, fmt.Errorf("The e2store entry at offset %d has a non zero reserved field: %d", er.offset, reserved)
+	}
+
+	entry.Data = make([]byte, length)
+	m, err := io.ReadFull(er.r, entry.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the e2store entry at offset %d: %w", er.offset, err)
+	}
+	er.offset += int64(n + m)
+	return entry, nil
+}
+
+// E2StoreWriter writes entries to an e2store file.
+type E2StoreWriter struct {
+	w      io.Writer
+	offset int64
+}
+
+// Create a new E2StoreWriter.
+func NewE2StoreWriter(w io.Writer) *E2StoreWriter {
+	return &E2StoreWriter{w: w}
+}
+
+// Write a single entry. The offset of its header, from the start of the file, is returned.
+func (ew *E2StoreWriter) Write(entryType [2]byte, data []byte) (int64, error) {
+	if uint64(len(data)) > uint64(^uint32(0)) {
+		return 0, fmt.Errorf("The e2store entry is too large: %d bytes", len(data))
+	}
+	offset := ew.offset
+	header := make([]byte, headerSize)
+	copy(header, entryType[:])
+	binary.LittleEndian.PutUint32(header[2:6], uint32(len(data)))
+	n, err := ew.w.Write(header)
+	ew.offset += int64(n)
+	if err != nil {
+		return offset, fmt.Errorf("Unable to write the e2store header at offset %d: %w", offset, err)
+	}
+	m, err := ew.w.Write(data)
+	ew.offset += int64(m)
+	if err != nil {
+		return offset, fmt.Errorf("Unable to write the e2store entry at offset %d: %w", offset, err)
+	}
+	return offset, nil
+}
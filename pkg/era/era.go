@@ -0,0 +1,130 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a reader for era files. Each era file contains the SignedBeaconBlocks of 8192 slots,
+// followed by the BeaconState at the end of that range, and the indices of both.
+
+package era
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// The number of slots covered by a single era file.
+const SlotsPerHistoricalRoot uint64 = 8192
+
+// The offsets of the entries for a range of slots. An offset is relative to the start of the index entry,
+// a zero offset means the slot is empty.
+type SlotIndex struct {
+	StartSlot uint64
+	Offsets   []int64
+}
+
+// An object read from an era file.
+type Object struct {
+	Type [2]byte // TypeCompressedSignedBeaconBlock or TypeCompressedBeaconState.
+	SSZ  []byte  // The decompressed SSZ encoding of the object.
+}
+
+// Reader reads the blocks and state of an era file in the order they are stored. The slot indices are
+// collected as they are read, they are complete once Next returns io.EOF.
+type Reader struct {
+	e2      *E2StoreReader
+	indices []SlotIndex
+	version bool
+}
+
+// Create a new Reader.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{e2: NewE2StoreReader(r)}
+}
+
+// Read the next SignedBeaconBlock or BeaconState. io.EOF is returned once every entry has been read.
+func (r *Reader) Next() (*Object, error) {
+	for {
+		entry, err := r.e2.Next()
+		if err != nil {
+			if err == io.EOF && !r.version {
+				return nil, fmt.Errorf("The file does not start with an e2store version entry")
+			}
+			return nil, err
+		}
+		if !r.version && entry.Type != TypeVersion {
+			return nil, fmt.Errorf("The file does not start with an e2store version entry")
+		}
+
+		switch entry.Type {
+		case TypeVersion:
+			r.version = true
+		case TypeSlotIndex:
+			index, err := DecodeSlotIndex(entry.Data)
+			if err != nil {
+				return nil, err
+			}
+			r.indices = append(r.indices, index)
+		case TypeCompressedSignedBeaconBlock, TypeCompressedBeaconState:
+			ssz, err := DecompressSnappyFramed(entry.Data)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to decompress the entry at offset %d: %w", entry.Offset, err)
+			}
+			return &Object{Type: entry.Type, SSZ: ssz}, nil
+		default:
+			// Other entry types may be added to era files, they are ignored.
+		}
+	}
+}
+
+// The index of the SignedBeaconBlocks, it is absent from the era file that only contains the genesis state.
+func (r *Reader) BlockIndex() (SlotIndex, bool) {
+	if len(r.indices) < 2 {
+		return SlotIndex{}, false
+	}
+	return r.indices[0], true
+}
+
+// The index of the BeaconState.
+func (r *Reader) StateIndex() (SlotIndex, bool) {
+	if len(r.indices) == 0 {
+		return SlotIndex{}, false
+	}
+	return r.indices[len(r.indices)-1], true
+}
+
+// Decode a slot index entry: the start slot, an offset for every slot and the number of slots,
+// each as a little endian int64.
+func DecodeSlotIndex(data []byte) (SlotIndex, error) {
+	if len(data) < 16 || len(data)%8 != 0 {
+		return SlotIndex{}, fmt.Errorf("The slot index has an invalid length: %d", len(data))
+	}
+	count := binary.LittleEndian.Uint64(data[len(data)-8:])
+	if count != uint64(len(data)/8-2) {
+		return SlotIndex{}, fmt.Errorf("The slot index has %d offsets, but a count of %d", len(data)/8-2, count)
+	}
+	index := SlotIndex{StartSlot: binary.LittleEndian.Uint64(data), Offsets: make([]int64, count)}
+	for i := range index.Offsets {
+		index.Offsets[i] = int64(binary.LittleEndian.Uint64(data[8+8*i:]))
+	}
+	return index, nil
+}
+
+// Decompress data using the snappy framing format.
+func DecompressSnappyFramed(data []byte) ([]byte, error) {
+	return io.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+}
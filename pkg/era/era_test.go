@@ -0,0 +1,198 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package era_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/golang/snappy"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/era"
+)
+
+var _ = Describe("Era", Label("unit"), func() {
+	block := []byte("signed beacon block")
+	state := []byte("beacon state")
+
+	Describe("Reading an era file", func() {
+		It("Should return the decompressed objects and the indices", func() {
+			var buf bytes.Buffer
+			writeEntry(&buf, era.TypeVersion, nil)
+			writeEntry(&buf, era.TypeCompressedSignedBeaconBlock, compress(block))
+			writeEntry(&buf, era.TypeEmpty, []byte{0, 0})
+			writeEntry(&buf, era.TypeCompressedBeaconState, compress(state))
+			writeEntry(&buf, era.TypeSlotIndex, slotIndex(8192, 8, 0, 0))
+			writeEntry(&buf, era.TypeSlotIndex, slotIndex(16384, -24))
+
+			rd := era.NewReader(&buf)
+			obj, err := rd.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Type).To(Equal(era.TypeCompressedSignedBeaconBlock))
+			Expect(obj.SSZ).To(Equal(block))
+			obj, err = rd.Next()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Type).To(Equal(era.TypeCompressedBeaconState))
+			Expect(obj.SSZ).To(Equal(state))
+			_, err = rd.Next()
+			Expect(err).To(Equal(io.EOF))
+
+			blockIndex, ok := rd.BlockIndex()
+			Expect(ok).To(BeTrue())
+			Expect(blockIndex).To(Equal(era.SlotIndex{StartSlot: 8192, Offsets: []int64{8, 0, 0}}))
+			stateIndex, ok := rd.StateIndex()
+			Expect(ok).To(BeTrue())
+			Expect(stateIndex.StartSlot).To(Equal(uint64(16384)))
+		})
+		It("Should not have a block index when the file only contains a state", func() {
+			var buf bytes.Buffer
+			writeEntry(&buf, era.TypeVersion, nil)
+			writeEntry(&buf, era.TypeCompressedBeaconState, compress(state))
+			writeEntry(&buf, era.TypeSlotIndex, slotIndex(0, -24))
+
+			rd := era.NewReader(&buf)
+			_, err := rd.Next()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rd.Next()
+			Expect(err).To(Equal(io.EOF))
+			_, ok := rd.BlockIndex()
+			Expect(ok).To(BeFalse())
+		})
+		It("Should reject a file that does not start with a version entry", func() {
+			var buf bytes.Buffer
+			writeEntry(&buf, era.TypeCompressedBeaconState, compress(state))
+			_, err := era.NewReader(&buf).Next()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should reject an entry with a non zero reserved field", func() {
+			data := []byte{0x65, 0x32, 0, 0, 0, 0, 1, 0}
+			_, err := era.NewE2StoreReader(bytes.NewReader(data)).Next()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("Writing an era file", func() {
+		It("Should be read back with the same objects and indices", func() {
+			var buf bytes.Buffer
+			ew, err := era.NewWriter(&buf, 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ew.StartSlot()).To(Equal(uint64(8192)))
+			Expect(ew.StateSlot()).To(Equal(uint64(16384)))
+			Expect(ew.AddBlock(8192, block)).To(Succeed())
+			Expect(ew.AddBlock(8200, block)).To(Succeed())
+			Expect(ew.SetState(state)).To(Succeed())
+			Expect(ew.Close()).To(Succeed())
+
+			rd := era.NewReader(bytes.NewReader(buf.Bytes()))
+			var types [][2]byte
+			for {
+				obj, err := rd.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ToNot(HaveOccurred())
+				types = append(types, obj.Type)
+			}
+			Expect(types).To(Equal([][2]byte{era.TypeCompressedSignedBeaconBlock, era.TypeCompressedSignedBeaconBlock, era.TypeCompressedBeaconState}))
+
+			blockIndex, ok := rd.BlockIndex()
+			Expect(ok).To(BeTrue())
+			Expect(blockIndex.StartSlot).To(Equal(uint64(8192)))
+			Expect(blockIndex.Offsets).To(HaveLen(int(era.SlotsPerHistoricalRoot)))
+			for i, offset := range blockIndex.Offsets {
+				if i == 0 || i == 8 {
+					Expect(offset).To(BeNumerically("<", 0))
+				} else {
+					Expect(offset).To(BeZero())
+				}
+			}
+			stateIndex, ok := rd.StateIndex()
+			Expect(ok).To(BeTrue())
+			Expect(stateIndex.StartSlot).To(Equal(uint64(16384)))
+			Expect(stateIndex.Offsets).To(HaveLen(1))
+		})
+		It("Should only write the state index for era 0", func() {
+			var buf bytes.Buffer
+			ew, err := era.NewWriter(&buf, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ew.AddBlock(0, block)).ToNot(Succeed())
+			Expect(ew.SetState(state)).To(Succeed())
+			Expect(ew.Close()).To(Succeed())
+
+			rd := era.NewReader(bytes.NewReader(buf.Bytes()))
+			_, err = rd.Next()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rd.Next()
+			Expect(err).To(Equal(io.EOF))
+			_, ok := rd.BlockIndex()
+			Expect(ok).To(BeFalse())
+		})
+		It("Should reject blocks that are out of order, outside the era or after the state", func() {
+			ew, err := era.NewWriter(&bytes.Buffer{}, 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ew.AddBlock(8192, block)).ToNot(Succeed())
+			Expect(ew.AddBlock(10, block)).To(Succeed())
+			Expect(ew.AddBlock(10, block)).ToNot(Succeed())
+			Expect(ew.Close()).ToNot(Succeed())
+			Expect(ew.SetState(state)).To(Succeed())
+			Expect(ew.AddBlock(11, block)).ToNot(Succeed())
+		})
+		It("Should use the standard file name", func() {
+			root := [32]byte{0x4b, 0x36, 0x3d, 0xb9, 0xff}
+			Expect(era.FileName("mainnet", 12, root)).To(Equal("mainnet-00012-4b363db9.era"))
+		})
+	})
+	Describe("Decoding a slot index", func() {
+		It("Should reject an index whose count does not match its length", func() {
+			data := slotIndex(0, 8, 16)
+			binary.LittleEndian.PutUint64(data[len(data)-8:], 3)
+			_, err := era.DecodeSlotIndex(data)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+// Write a single e2store entry.
+func writeEntry(buf *bytes.Buffer, entryType [2]byte, data []byte) {
+	header := make([]byte, 8)
+	copy(header, entryType[:])
+	binary.LittleEndian.PutUint32(header[2:], uint32(len(data)))
+	buf.Write(header)
+	buf.Write(data)
+}
+
+// Compress data using the snappy framing format.
+func compress(data []byte) []byte {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	_, err := w.Write(data)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// Encode a slot index entry.
+func slotIndex(startSlot uint64, offsets ...int64) []byte {
+	data := make([]byte, 16+8*len(offsets))
+	binary.LittleEndian.PutUint64(data, startSlot)
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(data[8+8*i:], uint64(offset))
+	}
+	binary.LittleEndian.PutUint64(data[len(data)-8:], uint64(len(offsets)))
+	return data
+}
@@ -0,0 +1,165 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a writer for era files.
+
+package era
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// Writer writes a single era file. The SignedBeaconBlocks are added in slot order, followed by the BeaconState.
+// Era N contains the blocks of the slots from (N-1)*8192 to N*8192-1, and the state at slot N*8192.
+// Era 0 only contains the genesis state.
+//
+// The state is the one after processing slot N*8192, but before applying the block at that slot, so its latest block
+// is the last block of the era. When slot N*8192 has a block, the post-block state served by the beacon API is not
+// the right state.
+type Writer struct {
+	e2       *E2StoreWriter
+	era      uint64
+	blocks   []int64 // The offset of the block entry for each slot, zero for an empty slot.
+	lastSlot int64   // The slot of the last block added, -1 before the first block.
+	state    int64   // The offset of the state entry.
+	hasState bool
+	closed   bool
+}
+
+// Create a new Writer for the given era, and write the version entry.
+func NewWriter(w io.Writer, era uint64) (*Writer, error) {
+	ew := &Writer{e2: NewE2StoreWriter(w), era: era, lastSlot: -1}
+	if era > 0 {
+		ew.blocks = make([]int64, SlotsPerHistoricalRoot)
+	}
+	if _, err := ew.e2.Write(TypeVersion, nil); err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+// The first slot whose block belongs in the era file.
+func (ew *Writer) StartSlot() uint64 {
+	if ew.era == 0 {
+		return 0
+	}
+	return (ew.era - 1) * SlotsPerHistoricalRoot
+}
+
+// The slot of the BeaconState in the era file.
+func (ew *Writer) StateSlot() uint64 {
+	return ew.era * SlotsPerHistoricalRoot
+}
+
+// Add the SSZ encoded SignedBeaconBlock of a slot. Blocks must be added in slot order, before the state.
+func (ew *Writer) AddBlock(slot uint64, ssz []byte) error {
+	if ew.hasState {
+		return fmt.Errorf("The block for slot %d was added after the state", slot)
+	}
+	if ew.era == 0 || slot < ew.StartSlot() || slot >= ew.StateSlot() {
+		return fmt.Errorf("The block for slot %d does not belong in era %d", slot, ew.era)
+	}
+	if int64(slot) <= ew.lastSlot {
+		return fmt.Errorf("The block for slot %d was not added in slot order", slot)
+	}
+	offset, err := ew.writeCompressed(TypeCompressedSignedBeaconBlock, ssz)
+	if err != nil {
+		return err
+	}
+	ew.blocks[slot-ew.StartSlot()] = offset
+	ew.lastSlot = int64(slot)
+	return nil
+}
+
+// Add the SSZ encoded BeaconState at the end of the era. It must be the state before any block at StateSlot is applied.
+func (ew *Writer) SetState(ssz []byte) error {
+	if ew.hasState {
+		return fmt.Errorf("The state for era %d was already added", ew.era)
+	}
+	offset, err := ew.writeCompressed(TypeCompressedBeaconState, ssz)
+	if err != nil {
+		return err
+	}
+	ew.state = offset
+	ew.hasState = true
+	return nil
+}
+
+// Finish the era file by writing the slot indices. The underlying writer is not closed.
+func (ew *Writer) Close() error {
+	if ew.closed {
+		return nil
+	}
+	if !ew.hasState {
+		return fmt.Errorf("The era file for era %d has no state", ew.era)
+	}
+	if ew.era > 0 {
+		if err := ew.writeIndex(ew.StartSlot(), ew.blocks); err != nil {
+			return err
+		}
+	}
+	if err := ew.writeIndex(ew.StateSlot(), []int64{ew.state}); err != nil {
+		return err
+	}
+	ew.closed = true
+	return nil
+}
+
+// Compress the SSZ object and write it as a single entry.
+func (ew *Writer) writeCompressed(entryType [2]byte, ssz []byte) (int64, error) {
+	compressed, err := CompressSnappyFramed(ssz)
+	if err != nil {
+		return 0, err
+	}
+	return ew.e2.Write(entryType, compressed)
+}
+
+// Write a slot index. The offsets of the entries are made relative to the start of the index entry.
+func (ew *Writer) writeIndex(startSlot uint64, offsets []int64) error {
+	indexOffset := ew.e2.offset
+	data := make([]byte, 16+8*len(offsets))
+	binary.LittleEndian.PutUint64(data, startSlot)
+	for i, offset := range offsets {
+		if offset != 0 {
+			binary.LittleEndian.PutUint64(data[8+8*i:], uint64(offset-indexOffset))
+		}
+	}
+	binary.LittleEndian.PutUint64(data[len(data)-8:], uint64(len(offsets)))
+	_, err := ew.e2.Write(TypeSlotIndex, data)
+	return err
+}
+
+// The standard name of an era file: <network>-<era number>-<the first 4 bytes of the historical root>.era
+func FileName(network string, era uint64, historicalRoot [32]byte) string {
+	return fmt.Sprintf("%s-%05d-%x.era", network, era, historicalRoot[:4])
+}
+
+// Compress data using the snappy framing format.
+func CompressSnappyFramed(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
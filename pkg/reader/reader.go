@@ -0,0 +1,222 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+// This file contains a Reader for the SignedBeaconBlocks and BeaconStates written to the DB by the indexer.
+
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/loghelper"
+)
+
+// Returned when the requested object is not in the DB.
+var ErrNotFound = errors.New("The object is not in the DB")
+
+var (
+	// Get the canonical block at a slot.
+	blockBySlotStmt string = `SELECT sb.slot, sb.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.signed_block sb ON sb.slot=s.slot AND sb.block_root=s.block_root
+	WHERE s.slot=$1 AND s.status='proposed';`
+	// Get a block by its root, the canonical block first.
+	blockByRootStmt string = `SELECT sb.slot, sb.mh_key
+	FROM eth_beacon.signed_block sb
+	LEFT JOIN eth_beacon.slots s ON s.slot=sb.slot AND s.block_root=sb.block_root AND s.status='proposed'
+	WHERE sb.block_root=$1
+	ORDER BY s.slot IS NOT NULL DESC
+	LIMIT 1;`
+	// Get a block by its key in public.blocks.
+	blockByMhKeyStmt string = `SELECT slot, mh_key FROM eth_beacon.signed_block WHERE mh_key=$1 LIMIT 1;`
+	// Get the state of the canonical block at a slot.
+	stateBySlotStmt string = `SELECT st.slot, st.mh_key
+	FROM eth_beacon.slots s
+	JOIN eth_beacon.state st ON st.slot=s.slot AND st.state_root=s.state_root
+	WHERE s.slot=$1 AND s.status='proposed';`
+	// Get a state by its root.
+	stateByRootStmt string = `SELECT slot, mh_key FROM eth_beacon.state WHERE state_root=$1 LIMIT 1;`
+	// Get a state by its key in public.blocks.
+	stateByMhKeyStmt string = `SELECT slot, mh_key FROM eth_beacon.state WHERE mh_key=$1 LIMIT 1;`
+	// Get the SSZ encoded object for a key.
+	blocksDataStmt string = `SELECT data FROM public.blocks WHERE key=$1;`
+	// Get the canonical slots within a range, a proposed row is preferred to a skipped one. Skipped rows store an
+	// empty block root, and an empty state root when the state was not written.
+	canonicalSlotsStmt string = `SELECT DISTINCT ON (slot) epoch, slot, NULLIF(block_root, '') AS block_root, NULLIF(state_root, '') AS state_root, status
+	FROM eth_beacon.slots
+	WHERE slot >= $1 AND slot <= $2 AND status IN ('proposed', 'skipped')
+	ORDER BY slot ASC, status ASC;`
+)
+
+// A canonical slot, as stored in eth_beacon.slots.
+type CanonicalSlot struct {
+	Epoch     uint64  // The epoch of the slot.
+	Slot      uint64  // The slot.
+	BlockRoot *string // The root of the canonical block, nil for a skipped slot.
+	StateRoot *string // The state root at the slot, nil when it is not known.
+	Status    string  // Either proposed or skipped.
+}
+
+// Reader retrieves decoded beacon objects from the DB. With a spec, objects are decoded as the fork active at their
+// slot. Without one, each fork is tried in turn, the same way the indexer decodes them.
+type Reader struct {
+	db   sql.Database
+	spec *common.Spec
+}
+
+// Create a new Reader. The spec must schedule the forks of the network, nil tries each fork with the spec the
+// indexer writes objects with.
+func NewReader(db sql.Database, spec *common.Spec) *Reader {
+	return &Reader{db: db, spec: spec}
+}
+
+// The spec used to decode objects.
+func (r *Reader) Spec() *common.Spec {
+	if r.spec == nil {
+		return beaconclient.DefaultSpec()
+	}
+	return r.spec
+}
+
+// The name of the fork active at a slot, as used by the beacon API. Only the forks scheduled by the spec are
+// returned.
+func (r *Reader) ForkAtSlot(slot uint64) string {
+	return beaconclient.ForkAtSlot(r.spec, beaconclient.Slot(slot))
+}
+
+// Decode a SignedBeaconBlock as the fork active at its slot, or as the first fork it decodes as without a spec.
+func (r *Reader) DecodeSignedBeaconBlock(slot uint64, ssz []byte) (*beaconclient.SignedBeaconBlock, error) {
+	var block beaconclient.SignedBeaconBlock
+	if r.spec == nil {
+		if err := block.UnmarshalSSZ(ssz); err != nil {
+			loghelper.LogSlotError(slot, err).Error("Unable to decode the SignedBeaconBlock")
+			return nil, err
+		}
+		return &block, nil
+	}
+	if err := block.UnmarshalSSZForFork(r.spec, r.ForkAtSlot(slot), ssz); err != nil {
+		loghelper.LogSlotError(slot, err).WithField("fork", r.ForkAtSlot(slot)).Error("Unable to decode the SignedBeaconBlock")
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Decode a BeaconState as the fork active at its slot, or as the first fork it decodes as without a spec.
+func (r *Reader) DecodeBeaconState(slot uint64, ssz []byte) (*beaconclient.BeaconState, error) {
+	var state beaconclient.BeaconState
+	if r.spec == nil {
+		if err := state.UnmarshalSSZ(ssz); err != nil {
+			loghelper.LogSlotError(slot, err).Error("Unable to decode the BeaconState")
+			return nil, err
+		}
+		return &state, nil
+	}
+	if err := state.UnmarshalSSZForFork(r.spec, r.ForkAtSlot(slot), ssz); err != nil {
+		loghelper.LogSlotError(slot, err).WithField("fork", r.ForkAtSlot(slot)).Error("Unable to decode the BeaconState")
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Get the canonical SignedBeaconBlock at a slot.
+func (r *Reader) SignedBeaconBlockBySlot(ctx context.Context, slot uint64) (*beaconclient.SignedBeaconBlock, error) {
+	return r.signedBeaconBlock(ctx, blockBySlotStmt, slot)
+}
+
+// Get a SignedBeaconBlock by its 0x prefixed root. The canonical block is returned if the root was seen more than once.
+func (r *Reader) SignedBeaconBlockByRoot(ctx context.Context, root string) (*beaconclient.SignedBeaconBlock, error) {
+	return r.signedBeaconBlock(ctx, blockByRootStmt, root)
+}
+
+// Get a SignedBeaconBlock by its key in public.blocks.
+func (r *Reader) SignedBeaconBlockByMhKey(ctx context.Context, mhKey string) (*beaconclient.SignedBeaconBlock, error) {
+	return r.signedBeaconBlock(ctx, blockByMhKeyStmt, mhKey)
+}
+
+// Get the BeaconState of the canonical block at a slot.
+func (r *Reader) BeaconStateBySlot(ctx context.Context, slot uint64) (*beaconclient.BeaconState, error) {
+	return r.beaconState(ctx, stateBySlotStmt, slot)
+}
+
+// Get a BeaconState by its 0x prefixed root.
+func (r *Reader) BeaconStateByRoot(ctx context.Context, root string) (*beaconclient.BeaconState, error) {
+	return r.beaconState(ctx, stateByRootStmt, root)
+}
+
+// Get a BeaconState by its key in public.blocks.
+func (r *Reader) BeaconStateByMhKey(ctx context.Context, mhKey string) (*beaconclient.BeaconState, error) {
+	return r.beaconState(ctx, stateByMhKeyStmt, mhKey)
+}
+
+// List the canonical slots from startSlot to endSlot, inclusive, ordered by slot. Slots that are not in the DB
+// are left out.
+func (r *Reader) CanonicalSlots(ctx context.Context, startSlot uint64, endSlot uint64) ([]CanonicalSlot, error) {
+	if endSlot < startSlot {
+		return nil, fmt.Errorf("The end slot (%d) must not be lower than the start slot (%d)", endSlot, startSlot)
+	}
+	var slots []CanonicalSlot
+	if err := r.db.Select(ctx, &slots, canonicalSlotsStmt, startSlot, endSlot); err != nil {
+		loghelper.LogSlotRangeError(startSlot, endSlot, err).Error("Unable to get the canonical slots")
+		return nil, err
+	}
+	return slots, nil
+}
+
+func (r *Reader) signedBeaconBlock(ctx context.Context, stmt string, arg interface{}) (*beaconclient.SignedBeaconBlock, error) {
+	slot, ssz, err := r.load(ctx, stmt, arg)
+	if err != nil {
+		return nil, err
+	}
+	return r.DecodeSignedBeaconBlock(slot, ssz)
+}
+
+func (r *Reader) beaconState(ctx context.Context, stmt string, arg interface{}) (*beaconclient.BeaconState, error) {
+	slot, ssz, err := r.load(ctx, stmt, arg)
+	if err != nil {
+		return nil, err
+	}
+	return r.DecodeBeaconState(slot, ssz)
+}
+
+// Find the slot and key of an object with stmt, and load its SSZ encoding from public.blocks.
+func (r *Reader) load(ctx context.Context, stmt string, arg interface{}) (uint64, []byte, error) {
+	var slot uint64
+	var mhKey string
+	err := r.db.QueryRow(ctx, stmt, arg).Scan(&slot, &mhKey)
+	if err == pgx.ErrNoRows {
+		return 0, nil, ErrNotFound
+	}
+	if err != nil {
+		loghelper.LogError(err).WithField("arg", arg).Error("Unable to find the object in the DB")
+		return 0, nil, err
+	}
+
+	var ssz []byte
+	err = r.db.QueryRow(ctx, blocksDataStmt, mhKey).Scan(&ssz)
+	if err == pgx.ErrNoRows {
+		return 0, nil, ErrNotFound
+	}
+	if err != nil {
+		loghelper.LogError(err).WithField("key", mhKey).Error("Unable to load the object from public.blocks")
+		return 0, nil, err
+	}
+	return slot, ssz, nil
+}
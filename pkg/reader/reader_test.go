@@ -0,0 +1,153 @@
+// VulcanizeDB
+// Copyright © 2022 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package reader_test
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/beaconclient"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/database/sql/postgres"
+	"github.com/vulcanize/ipld-eth-beacon-indexer/pkg/reader"
+)
+
+// Serialize an object with the given spec.
+func serialize(spec *common.Spec, obj interface {
+	Serialize(*common.Spec, *codec.EncodingWriter) error
+}) []byte {
+	var buf bytes.Buffer
+	Expect(obj.Serialize(spec, codec.NewEncodingWriter(&buf))).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Reader", Label("unit"), func() {
+	// The mainnet config of the spec library does not schedule Bellatrix, so it is scheduled at its mainnet epoch.
+	spec := *configs.Mainnet
+	spec.BELLATRIX_FORK_EPOCH = 144896
+	mainnet := reader.NewReader(nil, &spec)
+	anyFork := reader.NewReader(nil, nil)
+	slotsPerEpoch := uint64(configs.Mainnet.SLOTS_PER_EPOCH)
+	altairSlot := uint64(configs.Mainnet.ALTAIR_FORK_EPOCH) * slotsPerEpoch
+	bellatrixSlot := uint64(spec.BELLATRIX_FORK_EPOCH) * slotsPerEpoch
+	syncCommitteeBits := make(altair.SyncCommitteeBits, configs.Mainnet.SYNC_COMMITTEE_SIZE/8)
+
+	Describe("Choosing the fork of a slot", func() {
+		It("Should use the fork epochs of the spec", func() {
+			Expect(anyFork.Spec()).To(Equal(configs.Mainnet))
+			Expect(mainnet.Spec().SLOTS_PER_HISTORICAL_ROOT).To(Equal(configs.Mainnet.SLOTS_PER_HISTORICAL_ROOT))
+			Expect(mainnet.ForkAtSlot(0)).To(Equal("phase0"))
+			Expect(mainnet.ForkAtSlot(altairSlot - 1)).To(Equal("phase0"))
+			Expect(mainnet.ForkAtSlot(altairSlot)).To(Equal("altair"))
+			Expect(mainnet.ForkAtSlot(bellatrixSlot - 1)).To(Equal("altair"))
+			Expect(mainnet.ForkAtSlot(bellatrixSlot)).To(Equal("bellatrix"))
+
+			customSpec := *configs.Mainnet
+			customSpec.ALTAIR_FORK_EPOCH = 0
+			customSpec.BELLATRIX_FORK_EPOCH = 1
+			custom := reader.NewReader(nil, &customSpec)
+			Expect(custom.ForkAtSlot(0)).To(Equal("altair"))
+			Expect(custom.ForkAtSlot(slotsPerEpoch)).To(Equal("bellatrix"))
+		})
+	})
+
+	Describe("Decoding a SignedBeaconBlock", func() {
+		It("Should decode it as the fork of its slot", func() {
+			ssz := serialize(configs.Mainnet, &phase0.SignedBeaconBlock{})
+			block, err := mainnet.DecodeSignedBeaconBlock(0, ssz)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Version()).To(Equal("phase0"))
+
+			ssz = serialize(configs.Mainnet, &altair.SignedBeaconBlock{
+				Message: altair.BeaconBlock{Body: altair.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: syncCommitteeBits}}},
+			})
+			block, err = mainnet.DecodeSignedBeaconBlock(altairSlot, ssz)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Version()).To(Equal("altair"))
+
+			ssz = serialize(configs.Mainnet, &bellatrix.SignedBeaconBlock{
+				Message: bellatrix.BeaconBlock{Body: bellatrix.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: syncCommitteeBits}}},
+			})
+			block, err = mainnet.DecodeSignedBeaconBlock(bellatrixSlot, ssz)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Version()).To(Equal("bellatrix"))
+		})
+		It("Should not decode a block of another fork", func() {
+			ssz := serialize(configs.Mainnet, &bellatrix.SignedBeaconBlock{
+				Message: bellatrix.BeaconBlock{Body: bellatrix.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: syncCommitteeBits}}},
+			})
+			_, err := mainnet.DecodeSignedBeaconBlock(0, ssz)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should try each fork without a spec", func() {
+			ssz := serialize(configs.Mainnet, &bellatrix.SignedBeaconBlock{
+				Message: bellatrix.BeaconBlock{Body: bellatrix.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: syncCommitteeBits}}},
+			})
+			block, err := anyFork.DecodeSignedBeaconBlock(0, ssz)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Version()).To(Equal("bellatrix"))
+
+			ssz = serialize(configs.Mainnet, &altair.SignedBeaconBlock{
+				Message: altair.BeaconBlock{Body: altair.BeaconBlockBody{SyncAggregate: altair.SyncAggregate{SyncCommitteeBits: syncCommitteeBits}}},
+			})
+			block, err = anyFork.DecodeSignedBeaconBlock(bellatrixSlot, ssz)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(block.Version()).To(Equal("altair"))
+		})
+	})
+
+	Describe("Listing the canonical slots", func() {
+		It("Should return nil roots for a skipped slot", func() {
+			db, err := postgres.NewPostgresDB(postgres.DefaultConfig)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(db.Close)
+			ctx := context.Background()
+			cleanUp := func() {
+				_, err := db.Exec(ctx, `DELETE FROM eth_beacon.slots WHERE slot >= 900000 AND slot <= 900002`)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			cleanUp()
+			DeferCleanup(cleanUp)
+			for _, row := range [][]interface{}{
+				{"28125", "900000", "0x01", "0x02", "proposed"},
+				{"28125", "900001", "", "", "skipped"},
+				{"28125", "900002", "", "0x03", "skipped"},
+			} {
+				_, err := db.Exec(ctx, beaconclient.UpsertSlotsStmt, row...)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			slots, err := reader.NewReader(db, nil).CanonicalSlots(ctx, 900000, 900002)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(slots).To(HaveLen(3))
+			Expect(*slots[0].BlockRoot).To(Equal("0x01"))
+			Expect(*slots[0].StateRoot).To(Equal("0x02"))
+			Expect(slots[1].Status).To(Equal("skipped"))
+			Expect(slots[1].BlockRoot).To(BeNil())
+			Expect(slots[1].StateRoot).To(BeNil())
+			Expect(slots[2].BlockRoot).To(BeNil())
+			Expect(*slots[2].StateRoot).To(Equal("0x03"))
+		})
+	})
+})